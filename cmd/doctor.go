@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"duna/internal/config"
+	"duna/internal/database"
+	"duna/internal/database/postgres"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// outcomes of a doctor check, warnings don't fail the command
+const (
+	CHECK_OK   = "ok"
+	CHECK_WARN = "warn"
+	CHECK_FAIL = "FAIL"
+	CHECK_SKIP = "skip"
+)
+
+const (
+	// DOCTOR_TIMEOUT bounds every check talking to the database, doctor
+	// must not hang on an unreachable host like serve waiting for it
+	DOCTOR_TIMEOUT = 5 * time.Second
+	// MAX_CLOCK_SKEW between the application and the database, sessions
+	// and lobbies expire by comparing timestamps from both
+	MAX_CLOCK_SKEW = 2 * time.Second
+)
+
+// checkResult is a line of the doctor report, Fix tells how to solve a
+// warning or a failure
+type checkResult struct {
+	Name   string
+	Status string
+	Detail string
+	Fix    string
+}
+
+func (c *cli) doctorCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose the configuration and the environment",
+		Long: `Diagnose the configuration and the environment: config loading,
+credential files, database connectivity, migrations, clock skew and the
+HTTP port. Prints how to fix every problem found, exits 1 on a failure.`,
+		Args: cobra.NoArgs,
+		RunE: runE(func(cmd *cobra.Command, args []string) error {
+			results := c.diagnose(cmd)
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			failed := 0
+			for _, result := range results {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", result.Status, result.Name,
+					result.Detail)
+				if result.Fix != "" {
+					fmt.Fprintf(w, "\t\tfix: %s\n", result.Fix)
+				}
+				if result.Status == CHECK_FAIL {
+					failed++
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d checks failed", failed, len(results))
+			}
+			return nil
+		}),
+	}
+}
+
+// diagnose runs the checks in order, the ones depending on a failed check
+// are skipped
+func (c *cli) diagnose(cmd *cobra.Command) []checkResult {
+	skipAll := func(reason string, names ...string) []checkResult {
+		var results []checkResult
+		for _, name := range names {
+			results = append(results, checkResult{
+				Name: name, Status: CHECK_SKIP, Detail: reason})
+		}
+		return results
+	}
+
+	cfg, result := c.checkConfig(cmd)
+	results := []checkResult{result}
+	if cfg == nil {
+		return append(results, skipAll("needs the configuration",
+			"credentials", "database", "migrations", "clock", "port")...)
+	}
+
+	result = checkCredentials(cfg.Database)
+	results = append(results, result)
+	if result.Status == CHECK_FAIL {
+		results = append(results, skipAll("needs the credentials",
+			"database", "migrations", "clock")...)
+		return append(results, checkPort(cfg.HTTP))
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), DOCTOR_TIMEOUT)
+	defer cancel()
+
+	db, result := c.checkDatabase(ctx, cfg.Database)
+	results = append(results, result)
+	if db == nil {
+		results = append(results, skipAll("needs the database",
+			"migrations", "clock")...)
+		return append(results, checkPort(cfg.HTTP))
+	}
+
+	return append(results,
+		checkMigrations(ctx, db),
+		checkClock(ctx, db),
+		checkPort(cfg.HTTP),
+	)
+}
+
+func (c *cli) checkConfig(cmd *cobra.Command) (*config.Config, checkResult) {
+	result := checkResult{Name: "config"}
+
+	cfg, err := c.loadConfig(cmd)
+	if err != nil {
+		result.Status = CHECK_FAIL
+		result.Detail = err.Error()
+		result.Fix = "compare your .env, environment and config file with" +
+			" config.example.yaml, `duna --help` lists every flag"
+		return nil, result
+	}
+
+	envFile := "no .env file"
+	if _, err := os.Stat(".env"); err == nil {
+		envFile = ".env loaded"
+	}
+
+	result.Status = CHECK_OK
+	result.Detail = fmt.Sprintf("%s environment, %s driver, %s", cfg.Env,
+		cfg.Database.Driver, envFile)
+	return cfg, result
+}
+
+func checkCredentials(cfg config.DatabaseConfig) checkResult {
+	result := checkResult{Name: "credentials"}
+	if cfg.Driver != database.POSTGRES_DRIVER {
+		result.Status = CHECK_SKIP
+		result.Detail = fmt.Sprintf("the %s driver has none", cfg.Driver)
+		return result
+	}
+
+	pgConfig, err := postgres.NewPostgresConfig(cfg)
+	if err != nil {
+		result.Status = CHECK_FAIL
+		result.Detail = err.Error()
+		result.Fix = credentialsFix(err)
+		return result
+	}
+
+	result.Status = CHECK_OK
+	result.Detail = fmt.Sprintf("user %s with a password for %s:%d/%s",
+		pgConfig.User(), pgConfig.Host(), pgConfig.Port(), pgConfig.DBName())
+	return result
+}
+
+func credentialsFix(err error) string {
+	var source *postgres.CredentialSourceError
+	if !errors.As(err, &source) {
+		return "set PG_USER and PG_PASSWORD, or PG_CREDS_FILE to a file" +
+			" holding the user and the password on two lines"
+	}
+
+	switch {
+	case errors.Is(err, postgres.ErrInsecurePermissions):
+		return fmt.Sprintf("chmod 600 %s", source.Path)
+	case errors.Is(err, fs.ErrNotExist) &&
+		source.Source == postgres.PG_CREDS_FILE_SOURCE:
+		return fmt.Sprintf("create %s with the user on the first line and"+
+			" the password on the second, the docker compose database uses"+
+			" postgres and postgres, then chmod 600 it", source.Path)
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Sprintf("create %s or unset %s", source.Path, source.Source)
+	default:
+		return fmt.Sprintf("fix the content of %s or unset %s", source.Path,
+			source.Source)
+	}
+}
+
+func (c *cli) checkDatabase(
+	ctx context.Context,
+	cfg config.DatabaseConfig,
+) (database.Database, checkResult) {
+	result := checkResult{Name: "database"}
+
+	// a single attempt, DOCTOR_TIMEOUT is the limit
+	cfg.ConnectTimeout = 0
+	db, err := c.openDatabase(ctx, cfg)
+	if err == nil {
+		err = db.Ping(ctx)
+	}
+	if err != nil {
+		result.Status = CHECK_FAIL
+		result.Detail = err.Error()
+		result.Fix = "check the credentials and the database name"
+		if errors.Is(err, database.ErrUnavailable) ||
+			errors.Is(err, context.DeadlineExceeded) {
+			result.Fix = fmt.Sprintf("start postgres with `docker compose up"+
+				" -d database` or fix PG_HOST and PG_PORT, currently %s",
+				net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+		}
+		return nil, result
+	}
+
+	result.Status = CHECK_OK
+	result.Detail = "reachable"
+	return db, result
+}
+
+func checkMigrations(ctx context.Context, db database.Database) checkResult {
+	result := checkResult{Name: "migrations"}
+
+	versioner, ok := db.(database.SchemaVersioner)
+	if !ok {
+		result.Status = CHECK_SKIP
+		result.Detail = "the database has no migrations"
+		return result
+	}
+
+	known, err := postgres.KnownSchemaVersion()
+	if err != nil {
+		result.Status = CHECK_FAIL
+		result.Detail = err.Error()
+		result.Fix = "rebuild the binary, its migrations are unreadable"
+		return result
+	}
+
+	applied, err := versioner.SchemaVersion(ctx)
+	switch {
+	case err != nil:
+		result.Status = CHECK_FAIL
+		result.Detail = err.Error()
+		result.Fix = "check the database user may read the migrations table"
+	case applied == 0:
+		result.Status = CHECK_FAIL
+		result.Detail = "the database was never migrated"
+		result.Fix = "run `duna migrate`"
+	case applied < known:
+		result.Status = CHECK_WARN
+		result.Detail = fmt.Sprintf("schema version %d, the latest is %d",
+			applied, known)
+		result.Fix = "run `duna migrate`"
+	case applied > known:
+		result.Status = CHECK_FAIL
+		result.Detail = (&database.SchemaTooNewError{
+			Applied: applied, Known: known}).Error()
+		result.Fix = "rebuild from an up to date checkout"
+	default:
+		result.Status = CHECK_OK
+		result.Detail = fmt.Sprintf("schema version %d, up to date", applied)
+	}
+
+	return result
+}
+
+func checkClock(ctx context.Context, db database.Database) checkResult {
+	result := checkResult{Name: "clock"}
+
+	clock, ok := db.(database.ServerClock)
+	if !ok {
+		result.Status = CHECK_SKIP
+		result.Detail = "the database shares the clock of the application"
+		return result
+	}
+
+	before := time.Now()
+	serverTime, err := clock.ServerTime(ctx)
+	if err != nil {
+		result.Status = CHECK_FAIL
+		result.Detail = err.Error()
+		result.Fix = "check the database connection"
+		return result
+	}
+	roundTrip := time.Since(before)
+
+	// the server read its clock about halfway through the round trip
+	skew := serverTime.Sub(before.Add(roundTrip / 2))
+	result.Detail = fmt.Sprintf("database clock %s from the local one",
+		skew.Round(time.Millisecond))
+	if skew.Abs() > MAX_CLOCK_SKEW {
+		result.Status = CHECK_WARN
+		result.Fix = fmt.Sprintf("sync both clocks with NTP, more than %s"+
+			" apart sessions expire early or late", MAX_CLOCK_SKEW)
+		return result
+	}
+
+	result.Status = CHECK_OK
+	return result
+}
+
+func checkPort(cfg config.HTTPConfig) checkResult {
+	result := checkResult{Name: "port"}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		result.Status = CHECK_FAIL
+		result.Detail = err.Error()
+		result.Fix = fmt.Sprintf("stop whatever listens on %s (`lsof -i"+
+			" :%d`) or pick another port with HTTP_PORT", addr, cfg.Port)
+		return result
+	}
+	listener.Close()
+
+	result.Status = CHECK_OK
+	result.Detail = addr + " is free"
+	return result
+}
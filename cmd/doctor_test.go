@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"duna/internal/config"
+	"duna/internal/database"
+	"duna/internal/database/memory"
+	"duna/internal/database/postgres"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoctor(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer listener.Close()
+	busyPort := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	out, err := runWithDatabase(t, memory.NewMemoryDatabase(), "", "doctor",
+		"--env", "test", "--host", "127.0.0.1", "--port", busyPort)
+	if err == nil || !strings.Contains(err.Error(), "1 of 6 checks failed") {
+		t.Errorf("expected the port check to fail, got %v", err)
+	}
+
+	for _, want := range []string{
+		"ok    config       test environment, memory driver",
+		"skip  credentials  the memory driver has none",
+		"ok    database     reachable",
+		"FAIL  port",
+		"fix: stop whatever listens on 127.0.0.1:" + busyPort,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestCredentialsFix(t *testing.T) {
+	dir := t.TempDir()
+	insecure := filepath.Join(dir, "insecure")
+	if err := os.WriteFile(insecure, []byte("duna\nsecret\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name string
+		cfg  config.DatabaseConfig
+		want string
+	}{
+		{"no source", config.DatabaseConfig{}, "set PG_USER and PG_PASSWORD"},
+		{"insecure creds file", config.DatabaseConfig{CredsFile: insecure},
+			"chmod 600 " + insecure},
+		{"missing creds file", config.DatabaseConfig{CredsFile: missing},
+			"create " + missing + " with the user on the first line"},
+		{"missing user file", config.DatabaseConfig{UserFile: missing},
+			"create " + missing + " or unset PG_USER_FILE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Driver = database.POSTGRES_DRIVER
+			// keeps a ~/.pgpass of the machine out of the test
+			tt.cfg.PassFile = missing
+
+			result := checkCredentials(tt.cfg)
+			if result.Status != CHECK_FAIL {
+				t.Fatalf("expected a failure, got %+v", result)
+			}
+			if !strings.Contains(result.Fix, tt.want) {
+				t.Errorf("expected %q in the fix %q", tt.want, result.Fix)
+			}
+		})
+	}
+}
+
+// versionedDatabase reports a fixed schema version and server time
+type versionedDatabase struct {
+	*memory.MemoryDatabase
+	version    int64
+	serverTime time.Time
+}
+
+func (v versionedDatabase) SchemaVersion(ctx context.Context) (int64, error) {
+	return v.version, nil
+}
+
+func (v versionedDatabase) ServerTime(ctx context.Context) (time.Time, error) {
+	return v.serverTime, nil
+}
+
+func TestCheckMigrations(t *testing.T) {
+	known, err := postgres.KnownSchemaVersion()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		version int64
+		want    string
+	}{
+		{"never migrated", 0, CHECK_FAIL},
+		{"pending migrations", known - 1, CHECK_WARN},
+		{"up to date", known, CHECK_OK},
+		{"newer binary", known + 1, CHECK_FAIL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkMigrations(context.Background(), versionedDatabase{
+				MemoryDatabase: memory.NewMemoryDatabase(),
+				version:        tt.version,
+			})
+			if result.Status != tt.want {
+				t.Errorf("status = %s, want %s (%s)", result.Status, tt.want,
+					result.Detail)
+			}
+		})
+	}
+}
+
+func TestCheckClock(t *testing.T) {
+	tests := []struct {
+		name string
+		skew time.Duration
+		want string
+	}{
+		{"in sync", 0, CHECK_OK},
+		{"database ahead", time.Minute, CHECK_WARN},
+		{"database behind", -time.Minute, CHECK_WARN},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkClock(context.Background(), versionedDatabase{
+				MemoryDatabase: memory.NewMemoryDatabase(),
+				serverTime:     time.Now().Add(tt.skew),
+			})
+			if result.Status != tt.want {
+				t.Errorf("status = %s, want %s (%s)", result.Status, tt.want,
+					result.Detail)
+			}
+		})
+	}
+}
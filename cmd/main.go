@@ -1,56 +1,212 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"duna/internal/config"
 	"duna/internal/database"
+	_ "duna/internal/database/memory"
+	_ "duna/internal/database/postgres"
 
 	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-const HELP_MESSAGE = `
-Usage: duna <command> [options]
+// exit codes, scripts can tell a failed command from a mistyped one
+const (
+	EXIT_OK      = 0
+	EXIT_FAILURE = 1
+	EXIT_USAGE   = 2
+)
 
-Commands:
-	migrate 	Run database migrations
+// set by the makefile with -ldflags "-X main.Version=..."
+var (
+	Version   string
+	BuildTime string
+	GitCommit string
+)
 
-	rollback // TODO
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	serve      Start the application server
-     options:
-       -port int   port to listen on (default 8080)
-       -env string environment (default 'development') // TODO
-`
+// run executes the command line and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	c := newCLI()
+	root := c.rootCommand()
+	root.SetArgs(args)
+	root.SetOut(stdout)
+	root.SetErr(stderr)
 
-func main() {
-	if len(os.Args) < 2 {
-		println(HELP_MESSAGE)
-		os.Exit(1)
+	// ctrl-c cancels the context of every command, aborting the running
+	// query instead of leaving it hanging
+	ctx, stop := signal.NotifyContext(
+		context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cmd, err := root.ExecuteContextC(ctx)
+	if err == nil {
+		return EXIT_OK
 	}
 
-	// Load .env file
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Println("Error loading .env file")
+	fmt.Fprintf(stderr, "Error: %v\n", err)
+
+	var failed *commandError
+	if !errors.As(err, &failed) {
+		fmt.Fprintf(stderr, "Run '%s --help' for usage\n", cmd.CommandPath())
+		return EXIT_USAGE
+	}
+
+	if errors.Is(err, database.ErrUnavailable) {
+		fmt.Fprintln(stderr, "could not reach the database, is it running?")
 	}
+	return EXIT_FAILURE
+}
+
+// cli holds what the commands share
+type cli struct {
+	// configFlags is bound by config.BindFlags, its flags are global
+	configFlags *flag.FlagSet
+	// openDatabase is database.NewDatabase, tests share a single memory
+	// database between commands
+	openDatabase func(ctx context.Context,
+		cfg config.DatabaseConfig) (database.Database, error)
+}
+
+func newCLI() *cli {
+	configFlags := flag.NewFlagSet("duna", flag.ContinueOnError)
+	config.BindFlags(configFlags)
+
+	return &cli{
+		configFlags:  configFlags,
+		openDatabase: database.NewDatabase,
+	}
+}
+
+func (c *cli) rootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "duna",
+		Short: "Dune board game server",
+		Long: `Dune board game server.
 
-	switch os.Args[1] {
-	case "migrate":
-		handleMigrate()
-	default:
-		fmt.Println("unknown command")
+Every setting can come from the config file, the environment or a flag, see
+config.example.yaml. A .env file in the working directory is loaded first.`,
+		// errors and usage hints are printed by run
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE:          requireSubcommand,
 	}
+
+	root.PersistentFlags().AddGoFlagSet(c.configFlags)
+	root.RegisterFlagCompletionFunc(config.ENV_FLAG, cobra.FixedCompletions(
+		[]string{config.DEVELOPMENT, config.TEST, config.PRODUCTION},
+		cobra.ShellCompDirectiveNoFileComp))
+	root.RegisterFlagCompletionFunc("log-level", cobra.FixedCompletions(
+		[]string{"debug", "info", "warn", "error"},
+		cobra.ShellCompDirectiveNoFileComp))
+	root.RegisterFlagCompletionFunc("db-driver", cobra.FixedCompletions(
+		[]string{database.POSTGRES_DRIVER, database.MEMORY_DRIVER},
+		cobra.ShellCompDirectiveNoFileComp))
+
+	root.AddCommand(
+		c.migrateCommand(),
+		c.configCommand(),
+		c.seedCommand(),
+		c.schemaCommand(),
+		c.retentionCommand(),
+		c.serveCommand(),
+		c.versionCommand(),
+		c.userCommand(),
+		c.doctorCommand(),
+	)
+
+	return root
 }
 
-func handleMigrate() {
-	db, err := database.NewDatabase()
+// loadConfig resolves the configuration and sets up the default logger,
+// commands call it first unless they don't need any
+func (c *cli) loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env: %w", err)
+	}
+
+	// pflag parsed the command line, config.Load looks at the flags set on
+	// the standard flag set
+	var err error
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if c.configFlags.Lookup(f.Name) != nil && err == nil {
+			err = c.configFlags.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.Load(config.Options{Flags: c.configFlags})
 	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+		return nil, err
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(cmd.ErrOrStderr(),
+		&slog.HandlerOptions{Level: cfg.Log.SlogLevel()})))
+
+	return cfg, nil
+}
+
+// commandError is a failure of a command that ran, the other errors come
+// from parsing the command line
+type commandError struct {
+	err error
+}
+
+func (e *commandError) Error() string { return e.err.Error() }
+func (e *commandError) Unwrap() error { return e.err }
+
+// runE marks the errors of fn as command errors
+func runE(
+	fn func(cmd *cobra.Command, args []string) error,
+) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := fn(cmd, args); err != nil {
+			return &commandError{err: err}
+		}
+		return nil
+	}
+}
+
+// requireSubcommand runs for commands that only group others
+func requireSubcommand(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unknown command %q for %q", args[0],
+			cmd.CommandPath())
 	}
 
-	if err := db.Migrate(); err != nil {
-		fmt.Println(err.Error())
+	return errors.New("missing command")
+}
+
+func (c *cli) configCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "config",
+		Short: "Print the effective configuration, secrets redacted",
+		Args:  cobra.NoArgs,
+		RunE: runE(func(cmd *cobra.Command, args []string) error {
+			cfg, err := c.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), cfg)
+			return nil
+		}),
 	}
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"duna/internal/config"
+	"duna/internal/database"
+	"strings"
+	"testing"
+)
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		want       int
+		wantStdout string
+		wantStderr string
+	}{
+		{"missing command", nil, EXIT_USAGE, "", "missing command"},
+		{"unknown command", []string{"serv"}, EXIT_USAGE, "",
+			`unknown command "serv"`},
+		{"unknown subcommand", []string{"schema", "chek"}, EXIT_USAGE, "",
+			"Run 'duna schema --help'"},
+		{"unknown flag", []string{"seed", "--fil", "x"}, EXIT_USAGE, "",
+			"unknown flag: --fil"},
+		{"stray argument", []string{"migrate", "now"}, EXIT_USAGE, "",
+			"unknown command"},
+		{"help", []string{"--help"}, EXIT_OK, "Available Commands", ""},
+		{"version", []string{"version"}, EXIT_OK, "schema ", ""},
+		{"config", []string{"config", "--db-driver", "memory",
+			"--log-level", "debug"}, EXIT_OK, "level: debug", ""},
+		{"invalid config", []string{"config", "--log-level", "verbose"},
+			EXIT_FAILURE, "", "log.level"},
+		{"command failure", []string{"schema", "check", "--db-driver",
+			"memory"}, EXIT_FAILURE, "", "no schema to check"},
+		{"missing user argument", []string{"user", "show"}, EXIT_USAGE, "",
+			"accepts 1 arg(s)"},
+		{"completion", []string{"completion", "bash"}, EXIT_OK,
+			"bash completion", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if got := run(tt.args, &stdout, &stderr); got != tt.want {
+				t.Errorf("exit code = %d, want %d\nstderr: %s", got, tt.want,
+					stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Errorf("expected %q in stdout %q", tt.wantStdout,
+					stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("expected %q in stderr %q", tt.wantStderr,
+					stderr.String())
+			}
+		})
+	}
+}
+
+// runWithDatabase runs the command line with db as the database of every
+// command, it returns the standard output
+func runWithDatabase(
+	t *testing.T,
+	db database.Database,
+	stdin string,
+	args ...string,
+) (string, error) {
+	t.Helper()
+
+	c := newCLI()
+	c.openDatabase = func(
+		ctx context.Context,
+		cfg config.DatabaseConfig,
+	) (database.Database, error) {
+		return db, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	root := c.rootCommand()
+	root.SetArgs(args)
+	root.SetIn(strings.NewReader(stdin))
+	root.SetOut(&stdout)
+	root.SetErr(&stderr)
+
+	err := root.ExecuteContext(context.Background())
+	return stdout.String(), err
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func (c *cli) migrateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Run database migrations",
+		Long: `Run the migrations not applied yet. A database migrated by a newer
+binary is left alone.`,
+		Args: cobra.NoArgs,
+		RunE: runE(func(cmd *cobra.Command, args []string) error {
+			cfg, err := c.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := c.openDatabase(ctx, cfg.Database)
+			if err != nil {
+				return err
+			}
+
+			return db.Migrate(ctx)
+		}),
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"duna/internal/config"
+	"duna/internal/database"
+	"duna/internal/retention"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// scheduleRetention runs the retention job from serve until ctx is done,
+// logging every run
+func scheduleRetention(
+	ctx context.Context,
+	cfg config.RetentionConfig,
+	db database.Database,
+) {
+	retention.NewPolicy(cfg).Schedule(ctx, db, cfg.Interval,
+		func(result retention.Result, err error) {
+			if err != nil {
+				slog.Error("retention failed", "archived", result.Archived,
+					"deleted_lobbies", result.DeletedLobbies, "error", err)
+				return
+			}
+			slog.Info("retention done", "archived", result.Archived,
+				"deleted_lobbies", result.DeletedLobbies)
+		})
+}
+
+func (c *cli) retentionCommand() *cobra.Command {
+	schedule := false
+
+	cmd := &cobra.Command{
+		Use:   "retention",
+		Short: "Archive old finished matches and delete abandoned lobbies",
+		Long: `Archive old finished matches and delete abandoned lobbies, see the
+retention section of the configuration. serve runs it as well when
+retention.schedule is set, otherwise run it with --schedule in its own
+process or from cron.`,
+		Args: cobra.NoArgs,
+		RunE: runE(func(cmd *cobra.Command, args []string) error {
+			cfg, err := c.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := c.openDatabase(ctx, cfg.Database)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			policy := retention.NewPolicy(cfg.Retention)
+			report := func(result retention.Result, err error) {
+				fmt.Fprintf(out, "%s archived %d finished matches, deleted"+
+					" %d abandoned lobbies\n", time.Now().Format(time.RFC3339),
+					result.Archived, result.DeletedLobbies)
+				if err != nil {
+					fmt.Fprintln(cmd.ErrOrStderr(), err.Error())
+				}
+			}
+
+			if schedule {
+				// failed runs are retried at the next interval
+				policy.Schedule(ctx, db, cfg.Retention.Interval, report)
+				return nil
+			}
+
+			result, err := policy.Run(ctx, db, time.Now())
+			report(result, nil)
+			return err
+		}),
+	}
+
+	cmd.Flags().BoolVar(&schedule, "schedule", false,
+		"keep running, every retention interval")
+
+	return cmd
+}
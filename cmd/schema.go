@@ -0,0 +1,63 @@
+package main
+
+import (
+	"duna/internal/database"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func (c *cli) schemaCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Inspect the database schema",
+		RunE:  requireSubcommand,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "check",
+		Short: "Compare the live schema with the one the migrations build",
+		Long: `Compare the live schema with the one the migrations build in a scratch
+schema, exits 1 on any difference. Needs the CREATE privilege on the
+database.`,
+		Args: cobra.NoArgs,
+		RunE: runE(func(cmd *cobra.Command, args []string) error {
+			cfg, err := c.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := c.openDatabase(ctx, cfg.Database)
+			if err != nil {
+				return err
+			}
+
+			checker, ok := db.(database.SchemaChecker)
+			if !ok {
+				return fmt.Errorf("the %s driver has no schema to check",
+					cfg.Database.Driver)
+			}
+
+			differences, err := checker.CheckSchema(ctx)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if len(differences) == 0 {
+				fmt.Fprintln(out, "schema matches the migrations")
+				return nil
+			}
+
+			fmt.Fprintln(out, "- missing, + unexpected, ~ changed:")
+			for _, difference := range differences {
+				fmt.Fprintln(out, difference)
+			}
+			return fmt.Errorf("schema differs from the migrations in %d"+
+				" places", len(differences))
+		}),
+	})
+
+	return cmd
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/game"
+	"duna/internal/models"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// DEFAULT_CONTENT_FILE holds the factions, leaders, cards and territories,
+// relative to the repository root
+const DEFAULT_CONTENT_FILE = "data/game.yaml"
+
+func (c *cli) seedCommand() *cobra.Command {
+	file := DEFAULT_CONTENT_FILE
+
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Write the game content to the database",
+		Long: `Validate the game content and write it to the database, seeding again
+only updates what changed.`,
+		Args: cobra.NoArgs,
+		RunE: runE(func(cmd *cobra.Command, args []string) error {
+			cfg, err := c.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+
+			content, err := game.ParseContent(data)
+			if err != nil {
+				return fmt.Errorf("invalid game content in %s:\n%w", file, err)
+			}
+
+			ctx := cmd.Context()
+			db, err := c.openDatabase(ctx, cfg.Database)
+			if err != nil {
+				return err
+			}
+
+			written, err := seedContent(ctx, db, content)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "seeded %s: %d entries written\n",
+				file, written)
+			return nil
+		}),
+	}
+
+	cmd.Flags().StringVar(&file, "file", DEFAULT_CONTENT_FILE,
+		"game content file, YAML or JSON")
+	cmd.MarkFlagFilename("file", "yaml", "yml", "json")
+
+	return cmd
+}
+
+// seedContent writes content all or nothing, a half seeded database would
+// reference missing rows
+func seedContent(
+	ctx context.Context,
+	db database.Database,
+	content models.GameContent,
+) (int, error) {
+	var written int
+	err := db.WithTx(ctx, func(repos database.Repos) error {
+		var err error
+		written, err = repos.UpsertContent(ctx, content)
+		return err
+	})
+
+	return written, err
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"duna/data"
+	"duna/internal/auth"
+	"duna/internal/config"
+	"duna/internal/database"
+	"duna/internal/game"
+	"duna/internal/hash"
+	"duna/internal/pubsub"
+	"duna/internal/server"
+	"duna/internal/version"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func (c *cli) serveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Start the application server",
+		Long: `Start the application server, it stops on ctrl-c or SIGTERM after the
+requests in flight are done. It refuses to start on a database migrated by a
+newer binary, like migrate does. The memory database starts seeded with the
+game content built into the binary. With retention.schedule set it also runs
+the retention job every retention interval, see duna retention.`,
+		Args: cobra.NoArgs,
+		RunE: runE(func(cmd *cobra.Command, args []string) error {
+			cfg, err := c.loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			info, err := buildInfo()
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := c.openServeDatabase(ctx, cfg, info)
+			if err != nil {
+				return err
+			}
+
+			if cfg.Retention.Schedule {
+				go scheduleRetention(ctx, cfg.Retention, db)
+			}
+
+			// other instances on the same postgres database hear about the
+			// matches changed here
+			hub := pubsub.New(db, func(err error) {
+				slog.Warn("pubsub connection lost", "error", err)
+			})
+			defer hub.Close()
+
+			httpServer := &http.Server{
+				Addr: net.JoinHostPort(cfg.HTTP.Host,
+					strconv.Itoa(cfg.HTTP.Port)),
+				Handler:      newHandler(cfg, db, hub, info),
+				ReadTimeout:  cfg.HTTP.ReadTimeout,
+				WriteTimeout: cfg.HTTP.WriteTimeout,
+			}
+
+			serveErr := make(chan error, 1)
+			go func() {
+				slog.Info("listening", "addr", httpServer.Addr,
+					"version", info.Version)
+				serveErr <- httpServer.ListenAndServe()
+			}()
+
+			select {
+			case err := <-serveErr:
+				return err
+			case <-ctx.Done():
+			}
+
+			slog.Info("shutting down", "timeout", cfg.HTTP.ShutdownTimeout)
+			shutdownCtx, cancel := context.WithTimeout(
+				context.WithoutCancel(ctx), cfg.HTTP.ShutdownTimeout)
+			defer cancel()
+			if err := httpServer.Shutdown(shutdownCtx); err != nil &&
+				!errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+
+			return nil
+		}),
+	}
+}
+
+// openServeDatabase refuses a database migrated by a newer binary. A memory
+// database is seeded with the embedded content, `duna seed` runs in its
+// own process and can't reach it
+func (c *cli) openServeDatabase(
+	ctx context.Context,
+	cfg *config.Config,
+	info version.Info,
+) (database.Database, error) {
+	db, err := c.openDatabase(ctx, cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	if versioner, ok := db.(database.SchemaVersioner); ok {
+		applied, err := versioner.SchemaVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if applied > info.SchemaVersion {
+			return nil, &database.SchemaTooNewError{
+				Applied: applied, Known: info.SchemaVersion}
+		}
+	}
+
+	if cfg.Database.Driver == database.MEMORY_DRIVER {
+		content, err := game.ParseContent(data.GameContent)
+		if err != nil {
+			return nil, fmt.Errorf("invalid embedded game content: %w", err)
+		}
+
+		written, err := seedContent(ctx, db, content)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("seeded the memory database", "entries", written)
+	}
+
+	return db, nil
+}
+
+func newHandler(
+	cfg *config.Config,
+	db database.Database,
+	hub pubsub.PubSub,
+	info version.Info,
+) http.Handler {
+	hasher := hash.BcryptStrategy{Cost: cfg.Auth.BcryptCost}
+	usernames, emails := registrationPolicies(cfg.Auth)
+
+	return server.New(db, info, server.Options{
+		Auth: auth.New(db,
+			auth.DatabaseSessionStore(db, cfg.Session.MaxAge), hasher),
+		Hash:      hasher,
+		Session:   cfg.Session,
+		Game:      cfg.Game,
+		PubSub:    hub,
+		Usernames: &usernames,
+		Emails:    &emails,
+	})
+}
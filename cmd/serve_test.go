@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"duna/internal/config"
+	"duna/internal/pubsub"
+	"duna/internal/server"
+	"duna/internal/version"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeSeedsMemoryDatabase(t *testing.T) {
+	cfg := config.Defaults(config.TEST)
+	c := newCLI()
+
+	db, err := c.openServeDatabase(context.Background(), &cfg, version.Info{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	httpServer := httptest.NewServer(newHandler(&cfg, db,
+		pubsub.NewMemoryPubSub(), version.Info{}))
+	defer httpServer.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := &http.Client{Jar: jar}
+	var csrfToken string
+
+	post := func(path string, body, out any) int {
+		t.Helper()
+
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		request, err := http.NewRequest(http.MethodPost,
+			httpServer.URL+path, bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		request.Header.Set(server.CSRF_HEADER, csrfToken)
+
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer response.Body.Close()
+
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+			t.Fatalf("%s: unexpected error decoding: %v", path, err)
+		}
+		return response.StatusCode
+	}
+
+	var user server.UserResponse
+	if status := post("/auth/register", server.RegisterRequest{
+		Username: "paul",
+		Email:    "paul@arrakis.com",
+		Password: "Sp1ce-must-flow",
+	}, &user); status != http.StatusCreated {
+		t.Fatalf("register: status = %d", status)
+	}
+
+	if status := post("/auth/login", server.LoginRequest{
+		Username: "paul",
+		Password: "Sp1ce-must-flow",
+	}, &user); status != http.StatusOK {
+		t.Fatalf("login: status = %d", status)
+	}
+	csrfToken = user.CSRFToken
+
+	var match server.MatchResponse
+	if status := post("/matches", server.CreateMatchRequest{
+		Faction: "atreides",
+	}, &match); status != http.StatusCreated {
+		t.Fatalf("create match: status = %d", status)
+	}
+	if len(match.Seats) != 1 || match.Seats[0].Faction != "atreides" {
+		t.Errorf("unexpected match %+v", match)
+	}
+}
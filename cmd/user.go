@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"duna/internal/auth"
+	"duna/internal/config"
+	"duna/internal/database"
+	"duna/internal/hash"
+	"duna/internal/models"
+	"duna/internal/uuid"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	googleuuid "github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// userOutput is what the user commands print with --json
+type userOutput struct {
+	User            models.User      `json:"user"`
+	Sessions        []models.Session `json:"sessions,omitempty"`
+	RevokedSessions *int             `json:"revoked_sessions,omitempty"`
+}
+
+// userCLI is what the user commands share once the configuration is loaded
+type userCLI struct {
+	cfg    *config.Config
+	db     database.Database
+	hash   hash.HashStrategy
+	asJSON bool
+}
+
+// registrationPolicies validates new usernames and emails against the
+// configured lists, the reserved usernames add to the built in ones
+func registrationPolicies(
+	cfg config.AuthConfig,
+) (models.UsernamePolicy, models.EmailPolicy) {
+	usernames := models.DefaultUsernamePolicy
+	usernames.Reserved = slices.Concat(models.DefaultReservedUsernames,
+		cfg.ReservedUsernames)
+	if len(cfg.ProfaneWords) > 0 {
+		usernames.Profanity = models.NewWordListProfanityFilter(cfg.ProfaneWords)
+	}
+
+	return usernames, models.EmailPolicy{DeniedDomains: cfg.DeniedEmailDomains}
+}
+
+func (c *cli) userCommand() *cobra.Command {
+	asJSON := false
+
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage user accounts",
+		Long: `Manage user accounts. A <user> is an email when it holds an @, a uuid
+when it parses as one and a username otherwise.`,
+		RunE: requireSubcommand,
+	}
+
+	cmd.PersistentFlags().BoolVar(&asJSON, "json", false,
+		"print JSON instead of text")
+
+	cmd.AddCommand(
+		c.userCreateCommand(&asJSON),
+		c.userListCommand(&asJSON),
+		&cobra.Command{
+			Use:   "show <user>",
+			Short: "Show a user and their active sessions",
+			Args:  cobra.ExactArgs(1),
+			RunE:  c.withUser(&asJSON, (*userCLI).show),
+		},
+		&cobra.Command{
+			Use:   "disable <user>",
+			Short: "Stop a user from logging in and revoke their sessions",
+			Args:  cobra.ExactArgs(1),
+			RunE:  c.withUser(&asJSON, (*userCLI).disable),
+		},
+		&cobra.Command{
+			Use:   "enable <user>",
+			Short: "Let a disabled user log in again",
+			Args:  cobra.ExactArgs(1),
+			RunE:  c.withUser(&asJSON, (*userCLI).enable),
+		},
+		&cobra.Command{
+			Use:   "reset-password <user>",
+			Short: "Set a new password and revoke the user's sessions",
+			Long: `Set a new password and revoke the user's sessions. The password is
+prompted for on a terminal, otherwise it is read from the first line of the
+standard input.`,
+			Args: cobra.ExactArgs(1),
+			RunE: c.withUser(&asJSON, (*userCLI).resetPassword),
+		},
+		&cobra.Command{
+			Use:   "set-role <user> <role>",
+			Short: "Make a user a player or an admin",
+			Args:  cobra.ExactArgs(2),
+			ValidArgsFunction: func(
+				cmd *cobra.Command,
+				args []string,
+				toComplete string,
+			) ([]string, cobra.ShellCompDirective) {
+				if len(args) != 1 {
+					return nil, cobra.ShellCompDirectiveNoFileComp
+				}
+				return roleCompletion(cmd, args, toComplete)
+			},
+			RunE: c.withUser(&asJSON, (*userCLI).setRole),
+		},
+		&cobra.Command{
+			Use:   "revoke-sessions <user>",
+			Short: "Log a user out everywhere",
+			Args:  cobra.ExactArgs(1),
+			RunE:  c.withUser(&asJSON, (*userCLI).revokeSessions),
+		},
+	)
+
+	return cmd
+}
+
+func (c *cli) userCreateCommand(asJSON *bool) *cobra.Command {
+	var username, email, role string
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a user",
+		Long: `Create a user. The password is prompted for on a terminal, otherwise
+it is read from the first line of the standard input.`,
+		Args: cobra.NoArgs,
+		RunE: c.withUser(asJSON, func(
+			u *userCLI,
+			cmd *cobra.Command,
+			args []string,
+		) error {
+			usernames, emails := registrationPolicies(u.cfg.Auth)
+			validUsername, err := usernames.NewUsername(username)
+			if err != nil {
+				return err
+			}
+
+			validEmail, err := emails.NewEmail(email)
+			if err != nil {
+				return err
+			}
+
+			validRole, err := models.ParseRole(role)
+			if err != nil {
+				return err
+			}
+
+			password, err := u.readPassword(cmd)
+			if err != nil {
+				return err
+			}
+
+			user := models.CreateUser(
+				uuid.V7Strategy{}, validUsername, validEmail, password)
+			user.Role = validRole
+			err = u.db.InsertUser(cmd.Context(), user)
+			var conflict *database.ConflictError
+			if errors.As(err, &conflict) {
+				switch conflict.Constraint {
+				case "users_username_canonical_key":
+					return fmt.Errorf("username %s is taken", username)
+				case "users_email_canonical_key":
+					return fmt.Errorf("email %s is already registered", email)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			return u.print(cmd, userOutput{User: user},
+				"created %s %s (%s)\n", user.Role, user.Username, user.UUID)
+		}),
+	}
+
+	cmd.Flags().StringVar(&username, "username", "", "username, required")
+	cmd.Flags().StringVar(&email, "email", "", "email, required")
+	cmd.Flags().StringVar(&role, "role", string(models.PLAYER_ROLE),
+		"player or admin")
+	cmd.MarkFlagRequired("username")
+	cmd.MarkFlagRequired("email")
+	cmd.RegisterFlagCompletionFunc("role", roleCompletion)
+
+	return cmd
+}
+
+func (c *cli) userListCommand(asJSON *bool) *cobra.Command {
+	var prefix string
+	limit := 0
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List users ordered by username",
+		Args:  cobra.NoArgs,
+		RunE: c.withUser(asJSON, func(
+			u *userCLI,
+			cmd *cobra.Command,
+			args []string,
+		) error {
+			if limit < 0 {
+				return fmt.Errorf("invalid limit %d", limit)
+			}
+
+			users := []models.User{}
+			request := database.PageRequest{Limit: database.MAX_PAGE_LIMIT}
+			for {
+				page, err := u.db.ListUsers(cmd.Context(),
+					database.UserFilter{UsernamePrefix: prefix}, request, u.hash)
+				if err != nil {
+					return err
+				}
+
+				users = append(users, page.Items...)
+				if page.NextCursor == "" || (limit > 0 && len(users) >= limit) {
+					break
+				}
+				request.Cursor = page.NextCursor
+			}
+			if limit > 0 && len(users) > limit {
+				users = users[:limit]
+			}
+
+			out := cmd.OutOrStdout()
+			if u.asJSON {
+				return writeJSON(out, users)
+			}
+
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "UUID\tUSERNAME\tEMAIL\tROLE\tSTATUS")
+			for _, user := range users {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", user.UUID,
+					user.Username, user.Email, user.Role, userStatus(user))
+			}
+			return w.Flush()
+		}),
+	}
+
+	cmd.Flags().StringVar(&prefix, "prefix", "",
+		"only usernames starting with prefix, ignoring case")
+	cmd.Flags().IntVar(&limit, "limit", 0, "at most limit users, 0 for all")
+
+	return cmd
+}
+
+// withUser loads the configuration and opens the database before fn
+func (c *cli) withUser(
+	asJSON *bool,
+	fn func(u *userCLI, cmd *cobra.Command, args []string) error,
+) func(cmd *cobra.Command, args []string) error {
+	return runE(func(cmd *cobra.Command, args []string) error {
+		cfg, err := c.loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		db, err := c.openDatabase(cmd.Context(), cfg.Database)
+		if err != nil {
+			return err
+		}
+
+		return fn(&userCLI{
+			cfg:    cfg,
+			db:     db,
+			hash:   hash.BcryptStrategy{Cost: cfg.Auth.BcryptCost},
+			asJSON: *asJSON,
+		}, cmd, args)
+	})
+}
+
+func (u *userCLI) show(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	user, err := u.resolveUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	sessions, err := u.db.ListUserSessions(ctx, user.UUID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if u.asJSON {
+		return writeJSON(out, userOutput{User: user, Sessions: sessions})
+	}
+
+	fmt.Fprintf(out, "uuid:     %s\nusername: %s\nemail:    %s\nrole:     %s\n"+
+		"status:   %s\nsessions: %d\n", user.UUID, user.Username, user.Email,
+		user.Role, userStatus(user), len(sessions))
+	for _, session := range sessions {
+		fmt.Fprintf(out, "  created %s, expires %s\n",
+			session.CreatedAt.Format(time.RFC3339),
+			session.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (u *userCLI) disable(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	user, err := u.resolveUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	revoked := 0
+	if err := u.db.WithTx(ctx, func(repos database.Repos) error {
+		if err := repos.SetUserDisabled(ctx, user.UUID, true); err != nil {
+			return err
+		}
+
+		revoked, err = u.sessionStore(repos).RemoveUser(ctx, user.UUID)
+		return err
+	}); err != nil {
+		return err
+	}
+	user.Disabled = true
+
+	return u.print(cmd, userOutput{User: user, RevokedSessions: &revoked},
+		"disabled %s, revoked %d sessions\n", user.Username, revoked)
+}
+
+func (u *userCLI) enable(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	user, err := u.resolveUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := u.db.SetUserDisabled(ctx, user.UUID, false); err != nil {
+		return err
+	}
+	user.Disabled = false
+
+	return u.print(cmd, userOutput{User: user}, "enabled %s\n", user.Username)
+}
+
+func (u *userCLI) resetPassword(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	user, err := u.resolveUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	password, err := u.readPassword(cmd)
+	if err != nil {
+		return err
+	}
+
+	revoked := 0
+	if err := u.db.WithTx(ctx, func(repos database.Repos) error {
+		if err := repos.UpdateUserPassword(ctx, user.UUID, password); err != nil {
+			return err
+		}
+
+		revoked, err = u.sessionStore(repos).RemoveUser(ctx, user.UUID)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return u.print(cmd, userOutput{User: user, RevokedSessions: &revoked},
+		"reset the password of %s, revoked %d sessions\n", user.Username,
+		revoked)
+}
+
+func (u *userCLI) setRole(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	user, err := u.resolveUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	role, err := models.ParseRole(args[1])
+	if err != nil {
+		return err
+	}
+
+	if err := u.db.SetUserRole(ctx, user.UUID, role); err != nil {
+		return err
+	}
+	user.Role = role
+
+	return u.print(cmd, userOutput{User: user}, "%s is now %s\n",
+		user.Username, user.Role)
+}
+
+func (u *userCLI) revokeSessions(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	user, err := u.resolveUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	revoked, err := auth.New(u.db, u.sessionStore(u.db), u.hash).
+		RevokeSessions(ctx, user.UUID)
+	if err != nil {
+		return err
+	}
+
+	return u.print(cmd, userOutput{User: user, RevokedSessions: &revoked},
+		"revoked %d sessions of %s\n", revoked, user.Username)
+}
+
+func (u *userCLI) sessionStore(
+	repo database.SessionRepository,
+) auth.SessionStore {
+	return auth.DatabaseSessionStore(repo, u.cfg.Session.MaxAge)
+}
+
+// resolveUser finds a user by email, uuid or username, see userCommand
+func (u *userCLI) resolveUser(
+	ctx context.Context,
+	ref string,
+) (models.User, error) {
+	if strings.Contains(ref, "@") {
+		return u.db.GetUserByEmail(ctx, ref, u.hash)
+	}
+
+	if _, err := googleuuid.Parse(ref); err == nil {
+		return u.db.GetUserByUUID(ctx, ref, u.hash)
+	}
+
+	return u.db.GetUserByUsername(ctx, ref, u.hash)
+}
+
+// readPassword prompts twice for a password without echoing it when the
+// standard input is a terminal, scripts pipe it on a single line instead
+func (u *userCLI) readPassword(cmd *cobra.Command) (models.Password, error) {
+	var plain string
+
+	if file, ok := cmd.InOrStdin().(*os.File); ok &&
+		term.IsTerminal(int(file.Fd())) {
+		prompt := func(label string) (string, error) {
+			fmt.Fprint(cmd.ErrOrStderr(), label)
+			value, err := term.ReadPassword(int(file.Fd()))
+			fmt.Fprintln(cmd.ErrOrStderr())
+			return string(value), err
+		}
+
+		first, err := prompt("Password: ")
+		if err != nil {
+			return models.Password{}, err
+		}
+		second, err := prompt("Repeat password: ")
+		if err != nil {
+			return models.Password{}, err
+		}
+		if first != second {
+			return models.Password{}, errors.New("passwords don't match")
+		}
+		plain = first
+	} else {
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return models.Password{}, fmt.Errorf(
+				"failed to read the password: %w", err)
+		}
+		plain = strings.TrimRight(line, "\r\n")
+	}
+
+	if plain == "" {
+		return models.Password{}, errors.New("empty password")
+	}
+
+	return models.NewPassword(plain, false, u.hash)
+}
+
+// print writes output as JSON with --json, the formatted text otherwise
+func (u *userCLI) print(
+	cmd *cobra.Command,
+	output userOutput,
+	format string,
+	args ...any,
+) error {
+	if u.asJSON {
+		return writeJSON(cmd.OutOrStdout(), output)
+	}
+
+	_, err := fmt.Fprintf(cmd.OutOrStdout(), format, args...)
+	return err
+}
+
+func userStatus(user models.User) string {
+	if user.Disabled {
+		return "disabled"
+	}
+
+	return "active"
+}
+
+func roleCompletion(
+	cmd *cobra.Command,
+	args []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	var roles []string
+	for _, role := range models.ROLES {
+		roles = append(roles, string(role))
+	}
+
+	return roles, cobra.ShellCompDirectiveNoFileComp
+}
+
+func writeJSON(out io.Writer, value any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
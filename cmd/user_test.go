@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/database/memory"
+	"duna/internal/hash"
+	"duna/internal/models"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runUser runs a user command against db, feeding stdin to the password
+// prompt
+func runUser(
+	t *testing.T,
+	db database.Database,
+	stdin string,
+	args ...string,
+) (string, error) {
+	t.Helper()
+
+	return runWithDatabase(t, db, stdin,
+		append(append([]string{"user"}, args...), "--env", "test")...)
+}
+
+func TestUserCommands(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDatabase()
+
+	out, err := runUser(t, db, "Sp1ce-must-flow\n", "create", "--json",
+		"--username", "Paul", "--email", "paul@arrakis.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var created userOutput
+	if err := json.Unmarshal([]byte(out), &created); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	paul := created.User
+	if paul.Username != "Paul" || paul.Role != models.PLAYER_ROLE {
+		t.Fatalf("unexpected user %+v", paul)
+	}
+
+	for _, session := range []string{"a", "b"} {
+		if err := db.InsertSession(ctx, models.Session{
+			TokenHash: session,
+			UserUUID:  paul.UUID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		stdin   string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{"show by email", "", []string{"show", "PAUL@arrakis.com"},
+			"sessions: 2", ""},
+		{"show by uuid", "", []string{"show", paul.UUID}, "status:   active", ""},
+		{"list", "", []string{"list", "--prefix", "pa"}, "paul@arrakis.com", ""},
+		{"duplicate", "Sp1ce-must-flow\n", []string{"create",
+			"--username", "paul", "--email", "other@arrakis.com"}, "",
+			"username paul is taken"},
+		{"weak password", "spice\n", []string{"create", "--username",
+			"Alia", "--email", "alia@arrakis.com"}, "", "at least 8"},
+		{"configured reserved username", "Sp1ce-must-flow\n", []string{
+			"create", "--username", "Muad-Dib", "--email", "paul2@arrakis.com",
+			"--auth-reserved-usernames", "muaddib"}, "", "username is reserved"},
+		{"configured denied domain", "Sp1ce-must-flow\n", []string{"create",
+			"--username", "Alia", "--email", "alia@tempmail.org",
+			"--auth-denied-email-domains", "tempmail.org"}, "",
+			"email domain is not allowed"},
+		{"invalid role", "", []string{"set-role", "paul", "emperor"}, "",
+			`unknown role "emperor"`},
+		{"set role", "", []string{"set-role", "paul", "admin"},
+			"Paul is now admin", ""},
+		{"disable", "", []string{"disable", "paul"},
+			"disabled Paul, revoked 2 sessions", ""},
+		{"disabled in list", "", []string{"list"}, "disabled", ""},
+		{"enable", "", []string{"enable", "paul"}, "enabled Paul", ""},
+		{"reset password", "Sh4i-hulud\n", []string{"reset-password", "paul"},
+			"revoked 0 sessions", ""},
+		{"revoke sessions", "", []string{"revoke-sessions", "paul", "--json"},
+			`"revoked_sessions": 0`, ""},
+		{"unknown user", "", []string{"show", "feyd"}, "", "user not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runUser(t, db, tt.stdin, tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v",
+						tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("expected %q in %q", tt.want, out)
+			}
+		})
+	}
+
+	user, err := db.GetUserByUUID(ctx, paul.UUID, hash.BcryptStrategy{Cost: 4})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Role != models.ADMIN_ROLE || user.Disabled ||
+		!user.Password().Compare("Sh4i-hulud") {
+		t.Errorf("unexpected user after the commands %+v", user)
+	}
+}
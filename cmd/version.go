@@ -0,0 +1,39 @@
+package main
+
+import (
+	"duna/internal/database/postgres"
+	"duna/internal/version"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func (c *cli) versionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the build, go and schema versions",
+		Long: `Print the build, go and schema versions. The configuration is not
+loaded, it works without a database.`,
+		Args: cobra.NoArgs,
+		RunE: runE(func(cmd *cobra.Command, args []string) error {
+			info, err := buildInfo()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), info)
+			return nil
+		}),
+	}
+}
+
+// buildInfo fails when the embedded migrations are unreadable, the binary
+// itself is broken then
+func buildInfo() (version.Info, error) {
+	schemaVersion, err := postgres.KnownSchemaVersion()
+	if err != nil {
+		return version.Info{}, err
+	}
+
+	return version.New(Version, BuildTime, GitCommit, schemaVersion), nil
+}
@@ -0,0 +1,10 @@
+// Package data embeds the game content, binaries run away from the
+// repository can still seed it
+package data
+
+import _ "embed"
+
+// GameContent is game.yaml, the content seeded by default
+//
+//go:embed game.yaml
+var GameContent []byte
@@ -1,17 +1,35 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"duna/internal/database"
 	"duna/internal/hash"
 	"encoding/base64"
 	"errors"
+	"sync"
+)
+
+var (
+	// ErrUserDisabled is returned when a disabled user tries to log in
+	ErrUserDisabled = errors.New("user is disabled")
+	// ErrWrongPassword is returned by Authenticate for a wrong password
+	ErrWrongPassword = errors.New("passwords don´t match")
+	// ErrWrongCsrftToken is returned by GetUserUUID when the csrft token
+	// is not the one of the session
+	ErrWrongCsrftToken = errors.New("wrong creadentials")
 )
 
 type SessionAuthenticator interface {
-	Authenticate(username, password string) (string, string, error)
-	GetUserUUID(sessionToken, csrftToken string) (string, error)
-	Logout(sessionToken string) error
+	Authenticate(ctx context.Context,
+		username, password string) (string, string, error)
+	GetUserUUID(ctx context.Context,
+		sessionToken, csrftToken string) (string, error)
+	Logout(ctx context.Context, sessionToken string) error
+	// RevokeSessions logs a user out everywhere and returns the number of
+	// sessions removed
+	RevokeSessions(ctx context.Context, userUUID string) (int, error)
 }
 
 type SessionUserUUIDAndCsrftTokenPair struct {
@@ -20,15 +38,24 @@ type SessionUserUUIDAndCsrftTokenPair struct {
 }
 
 type SessionStore interface {
-	Set(key string, value SessionUserUUIDAndCsrftTokenPair) error
-	Get(key string) (SessionUserUUIDAndCsrftTokenPair, error)
-	Remove(key string) error
+	Set(ctx context.Context, key string,
+		value SessionUserUUIDAndCsrftTokenPair) error
+	Get(ctx context.Context, key string) (SessionUserUUIDAndCsrftTokenPair, error)
+	Remove(ctx context.Context, key string) error
+	// RemoveUser removes every session of a user and returns their number
+	RemoveUser(ctx context.Context, userUUID string) (int, error)
 }
 
 type sessionAuthenticator struct {
 	db    database.Database
 	store SessionStore
 	hash  hash.HashStrategy
+
+	// dummyHash is compared against when the username is unknown so the
+	// lookup takes as long as for a wrong password, it is encoded once
+	// with the same strategy to cost the same
+	dummyHash     string
+	dummyHashOnce sync.Once
 }
 
 func New(db database.Database, store SessionStore, hash hash.HashStrategy) SessionAuthenticator {
@@ -39,46 +66,76 @@ func New(db database.Database, store SessionStore, hash hash.HashStrategy) Sessi
 	}
 }
 
-func (s *sessionAuthenticator) Authenticate(
+func (s *sessionAuthenticator) Authenticate(ctx context.Context,
 	username, password string) (string, string, error) {
-	user, err := s.db.GetUserByUsername(username, s.hash)
+	user, err := s.db.GetUserByUsername(ctx, username, s.hash)
+	if errors.Is(err, database.ErrNotFound) {
+		s.hash.Compare(s.getDummyHash(), password)
+		return "", "", ErrWrongPassword
+	}
 	if err != nil {
 		return "", "", err
 	}
 
 	if !user.Password().Compare(password) {
-		return "", "", errors.New("passwords don´t match")
+		return "", "", ErrWrongPassword
+	}
+
+	// checked after the password so it does not tell which accounts exist
+	if user.Disabled {
+		return "", "", ErrUserDisabled
 	}
 
 	session, csrft := s.generateToken(), s.generateToken()
-	s.store.Set(session, SessionUserUUIDAndCsrftTokenPair{
+	if err := s.store.Set(ctx, session, SessionUserUUIDAndCsrftTokenPair{
 		CsrftToken: csrft,
 		UserUUID:   user.UUID,
-	})
+	}); err != nil {
+		return "", "", err
+	}
 
 	return session, csrft, nil
 }
 
+func (s *sessionAuthenticator) getDummyHash() string {
+	s.dummyHashOnce.Do(func() {
+		// the error is left out, an empty hash only makes the comparison
+		// faster
+		s.dummyHash, _ = s.hash.Encode(s.generateToken())
+	})
+
+	return s.dummyHash
+}
+
 func (s *sessionAuthenticator) generateToken() string {
 	b := make([]byte, 32)
 	rand.Read(b)
 	return base64.StdEncoding.EncodeToString(b)
 }
 
-func (s *sessionAuthenticator) GetUserUUID(
+func (s *sessionAuthenticator) GetUserUUID(ctx context.Context,
 	sessionToken, csrftToken string) (string, error) {
-	pair, err := s.store.Get(sessionToken)
+	pair, err := s.store.Get(ctx, sessionToken)
 	if err != nil {
 		return "", err
 	}
 
-	if pair.CsrftToken != csrftToken {
-		return "", errors.New("wrong creadentials")
+	// constant time, the comparison must not leak how much of the token
+	// was guessed right
+	if subtle.ConstantTimeCompare(
+		[]byte(pair.CsrftToken), []byte(csrftToken)) != 1 {
+		return "", ErrWrongCsrftToken
 	}
 
 	return pair.UserUUID, nil
 }
 
-func (s *sessionAuthenticator) Logout(sessionToken string) error {
-	return s.store.Remove(sessionToken)
+func (s *sessionAuthenticator) Logout(ctx context.Context,
+	sessionToken string) error {
+	return s.store.Remove(ctx, sessionToken)
+}
+
+func (s *sessionAuthenticator) RevokeSessions(ctx context.Context,
+	userUUID string) (int, error) {
+	return s.store.RemoveUser(ctx, userUUID)
 }
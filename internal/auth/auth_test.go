@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"duna/internal/database"
 	"duna/internal/hash"
 	"duna/internal/models"
@@ -53,7 +54,7 @@ func TestAuthenticate_Success(t *testing.T) {
 	}
 
 	mockDB := &database.MockDatabase{
-		FuncGetUserByUsername: func(username string, hash hash.HashStrategy) (models.User, error) {
+		FuncGetUserByUsername: func(ctx context.Context, username string, hash hash.HashStrategy) (models.User, error) {
 			assert.Equal(t, testingUserUsername, username)
 			return testUser, nil
 		},
@@ -66,7 +67,7 @@ func TestAuthenticate_Success(t *testing.T) {
 	}
 
 	auth := New(mockDB, mockStore, mockHash)
-	sessionToken, csrfToken, err := auth.Authenticate(
+	sessionToken, csrfToken, err := auth.Authenticate(context.Background(),
 		testingUserUsername, testingUserPassword)
 
 	assert.NoError(t, err)
@@ -89,14 +90,14 @@ func TestAuthenticate_PasswordsDontMatch(t *testing.T) {
 	}
 
 	mockDB := &database.MockDatabase{
-		FuncGetUserByUsername: func(username string, hash hash.HashStrategy) (models.User, error) {
+		FuncGetUserByUsername: func(ctx context.Context, username string, hash hash.HashStrategy) (models.User, error) {
 			assert.Equal(t, testingUserUsername, username)
 			return testUser, nil
 		},
 	}
 
 	auth := New(mockDB, nil, mockHash)
-	sessionToken, csrfToken, err := auth.Authenticate(
+	sessionToken, csrfToken, err := auth.Authenticate(context.Background(),
 		testingUserUsername, testingUserPassword)
 
 	assert.Equal(t, errors.New("passwords don´t match"), err)
@@ -106,7 +107,7 @@ func TestAuthenticate_PasswordsDontMatch(t *testing.T) {
 
 func TestAuthenticate_UserNotFound(t *testing.T) {
 	mockDB := &database.MockDatabase{
-		FuncGetUserByUsername: func(username string, hash hash.HashStrategy) (models.User, error) {
+		FuncGetUserByUsername: func(ctx context.Context, username string, hash hash.HashStrategy) (models.User, error) {
 			return models.User{}, errors.New("user not found")
 		},
 	}
@@ -116,12 +117,44 @@ func TestAuthenticate_UserNotFound(t *testing.T) {
 
 	auth := New(mockDB, mockStore, mockHash)
 
-	_, _, err := auth.Authenticate("nonexistent", "password123")
+	_, _, err := auth.Authenticate(context.Background(), "nonexistent", "password123")
 
 	assert.Error(t, err)
 	assert.EqualError(t, err, "user not found")
 }
 
+func TestAuthenticate_UnknownUsernameComparesDummyHash(t *testing.T) {
+	mockDB := &database.MockDatabase{
+		FuncGetUserByUsername: func(ctx context.Context, username string, hash hash.HashStrategy) (models.User, error) {
+			return models.User{}, fmt.Errorf("user %w", database.ErrNotFound)
+		},
+	}
+
+	encoded, compared := 0, 0
+	mockHash := models.HashStrategyMock{
+		FuncEncode: func(str string) (string, error) {
+			encoded++
+			return "dummy", nil
+		},
+		FuncCompare: func(enconded, str string) bool {
+			compared++
+			assert.Equal(t, "dummy", enconded)
+			assert.Equal(t, "password123", str)
+			return false
+		},
+	}
+
+	auth := New(mockDB, &MockSessionStore{}, mockHash)
+	for range 2 {
+		_, _, err := auth.Authenticate(context.Background(), "nonexistent",
+			"password123")
+		assert.ErrorIs(t, err, ErrWrongPassword)
+	}
+
+	assert.Equal(t, 1, encoded)
+	assert.Equal(t, 2, compared)
+}
+
 func TestAuthenticate_generateTokenShouldNotGenerateSameTokenMoreThanOnce(t *testing.T) {
 	auth := sessionAuthenticator{}
 
@@ -157,7 +190,7 @@ func TestGetUserUUID_Success(t *testing.T) {
 	}
 
 	auth := New(nil, mockStore, nil)
-	uuid, err := auth.GetUserUUID(testSessionToken, testCsrftToken)
+	uuid, err := auth.GetUserUUID(context.Background(), testSessionToken, testCsrftToken)
 
 	assert.NoError(t, err)
 	assert.Equal(t, uuid, testUser.UUID)
@@ -177,7 +210,7 @@ func TestGetUserUUID_TokenNotFound(t *testing.T) {
 	}
 
 	auth := New(nil, mockStore, nil)
-	uuid, err := auth.GetUserUUID("test token", "test token")
+	uuid, err := auth.GetUserUUID(context.Background(), "test token", "test token")
 
 	assert.Equal(t, err, expectedError)
 	assert.Equal(t, uuid, "")
@@ -203,7 +236,7 @@ func TestGetUserUUID_CSFRTNotMatch(t *testing.T) {
 	}
 
 	auth := New(nil, mockStore, nil)
-	uuid, err := auth.GetUserUUID("test token", "test token")
+	uuid, err := auth.GetUserUUID(context.Background(), "test token", "test token")
 
 	assert.Equal(t, errors.New("wrong creadentials"), err)
 	assert.Equal(t, uuid, "")
@@ -225,7 +258,7 @@ func TestLogout_Success(t *testing.T) {
 	}
 
 	auth := New(nil, mockStore, nil)
-	err := auth.Logout(testToken)
+	err := auth.Logout(context.Background(), testToken)
 
 	assert.NoError(t, err)
 	assert.Equal(t, storeRemoveCalledWith, testToken)
@@ -249,9 +282,60 @@ func TestLogout_Fail(t *testing.T) {
 	}
 
 	auth := New(nil, mockStore, nil)
-	err := auth.Logout(testToken)
+	err := auth.Logout(context.Background(), testToken)
 
 	assert.Equal(t, err, expectedError)
 	assert.Equal(t, storeRemoveCalledWith, testToken)
 	assert.Equal(t, storeRemoveWasCalledTimes, 1)
 }
+
+func TestAuthenticate_UserDisabled(t *testing.T) {
+	mockHash := models.HashStrategyMock{
+		FuncCompare: func(enconded, str string) bool {
+			return true
+		},
+	}
+
+	testUser, err := getTestUser(mockHash)
+	if err != nil {
+		t.Errorf("error creating testing password: %s", err.Error())
+		return
+	}
+	testUser.Disabled = true
+
+	mockDB := &database.MockDatabase{
+		FuncGetUserByUsername: func(ctx context.Context, username string, hash hash.HashStrategy) (models.User, error) {
+			return testUser, nil
+		},
+	}
+
+	storeSetWasCalledTimes := 0
+	mockStore := &MockSessionStore{
+		FuncSet: func(key string, value SessionUserUUIDAndCsrftTokenPair) error {
+			storeSetWasCalledTimes++
+			return nil
+		},
+	}
+
+	auth := New(mockDB, mockStore, mockHash)
+	_, _, err = auth.Authenticate(context.Background(),
+		testingUserUsername, testingUserPassword)
+
+	assert.ErrorIs(t, err, ErrUserDisabled)
+	assert.Equal(t, storeSetWasCalledTimes, 0)
+}
+
+func TestRevokeSessions(t *testing.T) {
+	mockStore := &MockSessionStore{
+		FuncRemoveUser: func(userUUID string) (int, error) {
+			assert.Equal(t, testingUserUUID, userUUID)
+			return 3, nil
+		},
+	}
+
+	auth := New(nil, mockStore, nil)
+	revoked, err := auth.RevokeSessions(context.Background(), testingUserUUID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, revoked)
+}
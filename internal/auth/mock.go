@@ -1,29 +1,39 @@
 package auth
 
+import "context"
+
 // MockSessionStore implementation matching your style
 type MockSessionStore struct {
-	FuncSet    func(key string, value SessionUserUUIDAndCsrftTokenPair) error
-	FuncGet    func(key string) (SessionUserUUIDAndCsrftTokenPair, error)
-	FuncRemove func(key string) error
+	FuncSet        func(key string, value SessionUserUUIDAndCsrftTokenPair) error
+	FuncGet        func(key string) (SessionUserUUIDAndCsrftTokenPair, error)
+	FuncRemove     func(key string) error
+	FuncRemoveUser func(userUUID string) (int, error)
 }
 
-func (m *MockSessionStore) Set(key string, value SessionUserUUIDAndCsrftTokenPair) error {
+func (m *MockSessionStore) Set(ctx context.Context, key string, value SessionUserUUIDAndCsrftTokenPair) error {
 	if m.FuncSet != nil {
 		return m.FuncSet(key, value)
 	}
 	return nil
 }
 
-func (m *MockSessionStore) Get(key string) (SessionUserUUIDAndCsrftTokenPair, error) {
+func (m *MockSessionStore) Get(ctx context.Context, key string) (SessionUserUUIDAndCsrftTokenPair, error) {
 	if m.FuncGet != nil {
 		return m.FuncGet(key)
 	}
 	return SessionUserUUIDAndCsrftTokenPair{}, nil
 }
 
-func (m *MockSessionStore) Remove(key string) error {
+func (m *MockSessionStore) Remove(ctx context.Context, key string) error {
 	if m.FuncRemove != nil {
 		return m.FuncRemove(key)
 	}
 	return nil
 }
+
+func (m *MockSessionStore) RemoveUser(ctx context.Context, userUUID string) (int, error) {
+	if m.FuncRemoveUser != nil {
+		return m.FuncRemoveUser(userUUID)
+	}
+	return 0, nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"duna/internal/database"
+	"duna/internal/models"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrSessionExpired is returned for a session older than its max age
+var ErrSessionExpired = errors.New("session expired")
+
+// HashToken is the key a session token is stored under, a leaked sessions
+// table does not let anyone log in
+func HashToken(sessionToken string) string {
+	sum := sha256.Sum256([]byte(sessionToken))
+	return hex.EncodeToString(sum[:])
+}
+
+type databaseSessionStore struct {
+	repo   database.SessionRepository
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// DatabaseSessionStore keeps the sessions in the database so they survive
+// restarts and can be listed and revoked per user
+func DatabaseSessionStore(
+	repo database.SessionRepository,
+	maxAge time.Duration,
+) SessionStore {
+	return &databaseSessionStore{repo: repo, maxAge: maxAge, now: time.Now}
+}
+
+func (d *databaseSessionStore) Set(
+	ctx context.Context,
+	key string,
+	value SessionUserUUIDAndCsrftTokenPair,
+) error {
+	now := d.now()
+
+	return d.repo.InsertSession(ctx, models.Session{
+		TokenHash: HashToken(key),
+		UserUUID:  value.UserUUID,
+		CSRFToken: value.CsrftToken,
+		CreatedAt: now,
+		ExpiresAt: now.Add(d.maxAge),
+	})
+}
+
+func (d *databaseSessionStore) Get(
+	ctx context.Context,
+	key string,
+) (SessionUserUUIDAndCsrftTokenPair, error) {
+	session, err := d.repo.GetSession(ctx, HashToken(key))
+	if err != nil {
+		return SessionUserUUIDAndCsrftTokenPair{}, err
+	}
+
+	if session.Expired(d.now()) {
+		// best effort, the retention job does not know about sessions
+		d.repo.DeleteSession(ctx, session.TokenHash)
+		return SessionUserUUIDAndCsrftTokenPair{}, ErrSessionExpired
+	}
+
+	return SessionUserUUIDAndCsrftTokenPair{
+		CsrftToken: session.CSRFToken,
+		UserUUID:   session.UserUUID,
+	}, nil
+}
+
+func (d *databaseSessionStore) Remove(ctx context.Context, key string) error {
+	return d.repo.DeleteSession(ctx, HashToken(key))
+}
+
+func (d *databaseSessionStore) RemoveUser(
+	ctx context.Context,
+	userUUID string,
+) (int, error) {
+	return d.repo.DeleteUserSessions(ctx, userUUID)
+}
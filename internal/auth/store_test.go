@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/database/memory"
+	"duna/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabaseSessionStore(t *testing.T) {
+	ctx := context.Background()
+
+	db := memory.NewMemoryDatabase()
+	testUser, err := getTestUser(models.HashStrategyMock{})
+	require.NoError(t, err)
+	require.NoError(t, db.InsertUser(ctx, testUser))
+
+	now := time.Now()
+	store := &databaseSessionStore{
+		repo:   db,
+		maxAge: time.Hour,
+		now:    func() time.Time { return now },
+	}
+
+	pair := SessionUserUUIDAndCsrftTokenPair{
+		CsrftToken: "csrft token",
+		UserUUID:   testUser.UUID,
+	}
+	require.NoError(t, store.Set(ctx, "session token", pair))
+
+	t.Run("only the hash is stored", func(t *testing.T) {
+		session, err := db.GetSession(ctx, HashToken("session token"))
+		require.NoError(t, err)
+		assert.Equal(t, testUser.UUID, session.UserUUID)
+		assert.NotContains(t, session.TokenHash, "session token")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		got, err := store.Get(ctx, "session token")
+		require.NoError(t, err)
+		assert.Equal(t, pair, got)
+
+		_, err = store.Get(ctx, "other token")
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "old token", pair))
+
+		later := &databaseSessionStore{
+			repo:   db,
+			maxAge: time.Hour,
+			now:    func() time.Time { return now.Add(time.Hour) },
+		}
+		_, err := later.Get(ctx, "old token")
+		assert.ErrorIs(t, err, ErrSessionExpired)
+
+		// and removed on the way
+		_, err = db.GetSession(ctx, HashToken("old token"))
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("remove user", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "other session", pair))
+
+		removed, err := store.RemoveUser(ctx, testUser.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, removed)
+
+		assert.ErrorIs(t, store.Remove(ctx, "session token"),
+			database.ErrNotFound)
+	})
+}
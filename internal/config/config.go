@@ -0,0 +1,530 @@
+// Package config resolves the application configuration. Every setting is
+// looked up in these sources, later ones win:
+//
+//  1. the defaults of the selected environment, see Defaults
+//  2. the config file: its top level keys, then the keys under
+//     profiles.<env>
+//  3. environment variables, main loads .env into the environment first
+//     without overriding variables that are already set
+//  4. command line flags registered with BindFlags
+//
+// The environment comes from the --env flag, then DUNA_ENV, and defaults to
+// development. The file comes from the --config flag, then DUNA_CONFIG, and
+// defaults to config.yaml, which may be missing
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ENV_ENV_VAR         = "DUNA_ENV"
+	CONFIG_FILE_ENV_VAR = "DUNA_CONFIG"
+	ENV_FLAG            = "env"
+	CONFIG_FILE_FLAG    = "config"
+
+	DEFAULT_CONFIG_FILE = "config.yaml"
+
+	DEVELOPMENT = "development"
+	TEST        = "test"
+	PRODUCTION  = "production"
+)
+
+// Config is the whole application configuration. The tags wire each field
+// to its sources: yaml is the key in the config file, env the environment
+// variable and flag the command line flag. Fields without env or flag tags
+// can't be set from that source
+type Config struct {
+	Env       string          `yaml:"-"`
+	Database  DatabaseConfig  `yaml:"database"`
+	HTTP      HTTPConfig      `yaml:"http"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Session   SessionConfig   `yaml:"session"`
+	Game      GameConfig      `yaml:"game"`
+	Retention RetentionConfig `yaml:"retention"`
+	Log       LogConfig       `yaml:"log"`
+}
+
+type DatabaseConfig struct {
+	// Driver selects the database.Database implementation
+	Driver  string `yaml:"driver" env:"DB_DRIVER" flag:"db-driver" usage:"database driver, postgres or memory"`
+	Host    string `yaml:"host" env:"PG_HOST" flag:"db-host" usage:"postgres host"`
+	Port    int    `yaml:"port" env:"PG_PORT" flag:"db-port" usage:"postgres port"`
+	Name    string `yaml:"name" env:"PG_DBNAME" flag:"db-name" usage:"postgres database name"`
+	SSLMode string `yaml:"sslmode" env:"PG_SSLMODE" flag:"db-sslmode" usage:"postgres sslmode"`
+
+	// credentials, see the postgres package for how the sources are picked.
+	// URL and Password have no flag to keep them out of the process list
+	URL          Secret `yaml:"url" env:"DATABASE_URL"`
+	User         string `yaml:"user" env:"PG_USER" flag:"db-user" usage:"postgres user"`
+	Password     Secret `yaml:"password" env:"PG_PASSWORD"`
+	UserFile     string `yaml:"user_file" env:"PG_USER_FILE" flag:"db-user-file" usage:"file holding the postgres user, like a docker or kubernetes secret"`
+	PasswordFile string `yaml:"password_file" env:"PG_PASSWORD_FILE" flag:"db-password-file" usage:"file holding the postgres password, like a docker or kubernetes secret"`
+	CredsFile    string `yaml:"creds_file" env:"PG_CREDS_FILE" flag:"db-creds-file" usage:"file holding the postgres user and password, one per line"`
+	PassFile     string `yaml:"passfile" env:"PGPASSFILE" flag:"db-passfile" usage:"libpq password file (default ~/.pgpass)"`
+	// ReplicaURLs lists read replicas as comma separated postgres:// urls,
+	// user, password and database default to the primary ones
+	ReplicaURLs Secret `yaml:"replica_urls" env:"DATABASE_REPLICA_URLS"`
+	// InsecureCredsFiles skips the check that credential files are only
+	// readable by their owner
+	InsecureCredsFiles bool `yaml:"insecure_creds_files" env:"PG_INSECURE_CREDS_FILES" flag:"db-insecure-creds-files" usage:"accept credential files readable by other users"`
+
+	QueryTimeout    time.Duration `yaml:"query_timeout" env:"PG_QUERY_TIMEOUT" flag:"db-query-timeout" usage:"default timeout of every query, 0 disables it"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"PG_MAX_OPEN_CONNS" flag:"db-max-open-conns" usage:"connection pool size, 0 is unlimited"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"PG_MAX_IDLE_CONNS" flag:"db-max-idle-conns" usage:"idle connections kept in the pool"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"PG_CONN_MAX_LIFETIME" flag:"db-conn-max-lifetime" usage:"connections are closed after this long, 0 keeps them"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"PG_CONN_MAX_IDLE_TIME" flag:"db-conn-max-idle-time" usage:"idle connections are closed after this long, 0 keeps them"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" env:"PG_CONNECT_TIMEOUT" flag:"db-connect-timeout" usage:"how long startup waits for postgres, 0 tries once"`
+}
+
+type HTTPConfig struct {
+	Host            string        `yaml:"host" env:"HTTP_HOST" flag:"host" usage:"address to listen on, empty is every interface"`
+	Port            int           `yaml:"port" env:"HTTP_PORT" flag:"port" usage:"port to listen on"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" flag:"http-read-timeout" usage:"maximum duration for reading a request"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" flag:"http-write-timeout" usage:"maximum duration for writing a response"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" flag:"http-shutdown-timeout" usage:"how long in flight requests get on shutdown"`
+}
+
+type AuthConfig struct {
+	BcryptCost int `yaml:"bcrypt_cost" env:"AUTH_BCRYPT_COST" flag:"auth-bcrypt-cost" usage:"bcrypt cost of password hashes"`
+	// ReservedUsernames are reserved on top of the built in
+	// models.DefaultReservedUsernames. Lists are comma separated in the
+	// environment and on the command line
+	ReservedUsernames  []string `yaml:"reserved_usernames" env:"AUTH_RESERVED_USERNAMES" flag:"auth-reserved-usernames" usage:"usernames nobody can register on top of the built in ones, comma separated"`
+	ProfaneWords       []string `yaml:"profane_words" env:"AUTH_PROFANE_WORDS" flag:"auth-profane-words" usage:"words a username may not contain, comma separated"`
+	DeniedEmailDomains []string `yaml:"denied_email_domains" env:"AUTH_DENIED_EMAIL_DOMAINS" flag:"auth-denied-email-domains" usage:"email domains, subdomains included, nobody can register with, comma separated"`
+}
+
+type SessionConfig struct {
+	CookieName string        `yaml:"cookie_name" env:"SESSION_COOKIE_NAME" flag:"session-cookie-name" usage:"name of the session cookie"`
+	MaxAge     time.Duration `yaml:"max_age" env:"SESSION_MAX_AGE" flag:"session-max-age" usage:"how long a session lasts"`
+	Secure     bool          `yaml:"secure" env:"SESSION_SECURE" flag:"session-secure" usage:"only send the session cookie over https"`
+}
+
+type GameConfig struct {
+	MinPlayers int `yaml:"min_players" env:"GAME_MIN_PLAYERS" flag:"game-min-players" usage:"players needed to start a match"`
+	MaxPlayers int `yaml:"max_players" env:"GAME_MAX_PLAYERS" flag:"game-max-players" usage:"seats in a match"`
+}
+
+type RetentionConfig struct {
+	ArchiveAfterDays   int           `yaml:"archive_after_days" env:"RETENTION_ARCHIVE_AFTER_DAYS" flag:"retention-archive-after-days" usage:"days before a finished match is moved to the archive"`
+	AbandonedLobbyDays int           `yaml:"abandoned_lobby_days" env:"RETENTION_ABANDONED_LOBBY_DAYS" flag:"retention-abandoned-lobby-days" usage:"days before a lobby still waiting for players is deleted"`
+	Interval           time.Duration `yaml:"interval" env:"RETENTION_INTERVAL" flag:"retention-interval" usage:"how often the scheduled retention job runs"`
+	// Schedule runs the job inside serve, leave it off when `duna retention
+	// --schedule` runs on its own or several servers share the database
+	Schedule bool `yaml:"schedule" env:"RETENTION_SCHEDULE" flag:"retention-schedule" usage:"run the retention job every interval inside serve"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"lowest level logged: debug, info, warn or error"`
+}
+
+// SlogLevel expects a validated level, anything else is info
+func (c LogConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return slog.LevelInfo
+	}
+
+	return level
+}
+
+// Options tells Load where to look besides the config file
+type Options struct {
+	// Flags must have been registered with BindFlags and parsed, nil skips
+	// the flags
+	Flags *flag.FlagSet
+	// LookupEnv reads the environment, os.LookupEnv when nil
+	LookupEnv func(key string) (string, bool)
+}
+
+// Load resolves and validates the configuration, see the package doc for
+// the precedence of the sources
+func Load(opts Options) (*Config, error) {
+	if opts.LookupEnv == nil {
+		opts.LookupEnv = os.LookupEnv
+	}
+
+	env := lookup(opts, ENV_FLAG, ENV_ENV_VAR, DEVELOPMENT)
+	cfg := Defaults(env)
+
+	path := lookup(opts, CONFIG_FILE_FLAG, CONFIG_FILE_ENV_VAR, "")
+	if err := loadFile(&cfg, path); err != nil {
+		return nil, err
+	}
+
+	if err := loadEnv(&cfg, opts.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if opts.Flags != nil {
+		if err := loadFlags(&cfg, opts.Flags); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// Defaults returns the built in configuration of env, production only sends
+// session cookies over https and test runs on the memory database
+func Defaults(env string) Config {
+	cfg := Config{
+		Env: env,
+		Database: DatabaseConfig{
+			Driver:          "postgres",
+			Host:            "localhost",
+			Port:            5432,
+			Name:            "postgres",
+			SSLMode:         "disable",
+			QueryTimeout:    5 * time.Second,
+			MaxOpenConns:    20,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectTimeout:  30 * time.Second,
+		},
+		HTTP: HTTPConfig{
+			Port:            8080,
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Auth: AuthConfig{
+			BcryptCost: 12,
+		},
+		Session: SessionConfig{
+			CookieName: "duna_session",
+			MaxAge:     7 * 24 * time.Hour,
+		},
+		Game: GameConfig{
+			MinPlayers: 2,
+			MaxPlayers: 6,
+		},
+		Retention: RetentionConfig{
+			ArchiveAfterDays:   90,
+			AbandonedLobbyDays: 7,
+			Interval:           24 * time.Hour,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+	}
+
+	switch env {
+	case PRODUCTION:
+		cfg.Session.Secure = true
+	case TEST:
+		cfg.Database.Driver = "memory"
+		// cheap hashes keep the tests fast
+		cfg.Auth.BcryptCost = 4
+	}
+
+	return cfg
+}
+
+// String renders the configuration as yaml with the secrets redacted
+func (c Config) String() string {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return fmt.Sprintf("invalid configuration: %v", err)
+	}
+
+	return fmt.Sprintf("# env: %s\n%s", c.Env, buf.String())
+}
+
+// lookup resolves a setting needed before the others can be loaded
+func lookup(opts Options, flagName, envVar, defaultValue string) string {
+	if opts.Flags != nil {
+		if f := opts.Flags.Lookup(flagName); f != nil {
+			set := false
+			opts.Flags.Visit(func(visited *flag.Flag) {
+				set = set || visited.Name == flagName
+			})
+			if set {
+				return f.Value.String()
+			}
+		}
+	}
+
+	if value, ok := opts.LookupEnv(envVar); ok && value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+// configFile is the layout of the config file
+type configFile struct {
+	Config   `yaml:",inline"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+func loadFile(cfg *Config, path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = DEFAULT_CONFIG_FILE
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return checkKnownEnv(cfg.Env, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	file := configFile{Config: *cfg}
+	if err := decodeStrict(data, &file); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	*cfg = file.Config
+
+	if err := checkKnownEnv(cfg.Env, file.Profiles); err != nil {
+		return err
+	}
+
+	profile, ok := file.Profiles[cfg.Env]
+	if !ok {
+		return nil
+	}
+
+	// yaml.Node.Decode can't reject unknown keys, go through the encoder
+	data, err = yaml.Marshal(&profile)
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := decodeStrict(data, cfg); err != nil {
+		return fmt.Errorf("invalid profile %s in config file %s: %w",
+			cfg.Env, path, err)
+	}
+
+	return nil
+}
+
+// checkKnownEnv catches typos in the environment name, it has to be built
+// in or have a profile
+func checkKnownEnv(env string, profiles map[string]yaml.Node) error {
+	switch env {
+	case DEVELOPMENT, TEST, PRODUCTION:
+		return nil
+	}
+
+	if _, ok := profiles[env]; ok {
+		return nil
+	}
+
+	return fmt.Errorf("unknown environment %q, expected %s, %s, %s or a"+
+		" profile from the config file", env, DEVELOPMENT, TEST, PRODUCTION)
+}
+
+func decodeStrict(data []byte, out any) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+func loadEnv(
+	cfg *Config,
+	lookupEnv func(key string) (string, bool),
+) error {
+	for _, s := range settingsOf(cfg) {
+		if s.env == "" {
+			continue
+		}
+
+		value, ok := lookupEnv(s.env)
+		if !ok {
+			continue
+		}
+
+		if err := s.set(value); err != nil {
+			return fmt.Errorf("invalid %s: %w", s.env, err)
+		}
+	}
+
+	return nil
+}
+
+func loadFlags(cfg *Config, flags *flag.FlagSet) error {
+	byFlag := map[string]setting{}
+	for _, s := range settingsOf(cfg) {
+		if s.flag != "" {
+			byFlag[s.flag] = s
+		}
+	}
+
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		s, ok := byFlag[f.Name]
+		if !ok || err != nil {
+			return
+		}
+
+		if setErr := s.set(f.Value.String()); setErr != nil {
+			err = fmt.Errorf("invalid -%s: %w", f.Name, setErr)
+		}
+	})
+
+	return err
+}
+
+// BindFlags registers -env, -config and a flag for every setting with a
+// flag tag, the help shows the development defaults
+func BindFlags(flags *flag.FlagSet) {
+	flags.String(ENV_FLAG, DEVELOPMENT,
+		"environment, selects the defaults and the config file profile")
+	flags.String(CONFIG_FILE_FLAG, DEFAULT_CONFIG_FILE, "config file")
+
+	defaults := Defaults(DEVELOPMENT)
+	for _, s := range settingsOf(&defaults) {
+		if s.flag == "" {
+			continue
+		}
+
+		flags.Var(&rawFlag{
+			value:    s.String(),
+			isBool:   s.value.Kind() == reflect.Bool,
+			typeName: s.typeName(),
+		}, s.flag, s.usage)
+	}
+}
+
+// rawFlag keeps the text given on the command line, it is parsed by Load
+// along with the other sources
+type rawFlag struct {
+	value    string
+	isBool   bool
+	typeName string
+}
+
+func (f *rawFlag) String() string   { return f.value }
+func (f *rawFlag) IsBoolFlag() bool { return f.isBool }
+
+// Type names the value in the help of the cli, which uses pflag
+func (f *rawFlag) Type() string { return f.typeName }
+func (f *rawFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+// setting is a leaf field of Config along with its tags
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value reflect.Value
+}
+
+func settingsOf(cfg *Config) []setting {
+	var settings []setting
+
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		for i := range v.NumField() {
+			field, value := v.Type().Field(i), v.Field(i)
+			if value.Kind() == reflect.Struct {
+				walk(value)
+				continue
+			}
+
+			settings = append(settings, setting{
+				env:   field.Tag.Get("env"),
+				flag:  field.Tag.Get("flag"),
+				usage: field.Tag.Get("usage"),
+				value: value,
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+
+	return settings
+}
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	stringsType  = reflect.TypeFor[[]string]()
+)
+
+func (s setting) set(raw string) error {
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 30s or 5m", raw)
+		}
+		s.value.SetInt(int64(d))
+	case s.value.Type() == stringsType:
+		var values []string
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		s.value.Set(reflect.ValueOf(values))
+	case s.value.Kind() == reflect.String:
+		s.value.SetString(raw)
+	case s.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		s.value.SetInt(int64(n))
+	case s.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		s.value.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+
+	return nil
+}
+
+func (s setting) typeName() string {
+	switch s.value.Type() {
+	case durationType:
+		return "duration"
+	case stringsType:
+		return "strings"
+	}
+
+	return s.value.Kind().String()
+}
+
+func (s setting) String() string {
+	switch s.value.Type() {
+	case durationType:
+		return time.Duration(s.value.Int()).String()
+	case stringsType:
+		return strings.Join(s.value.Interface().([]string), ",")
+	}
+
+	return fmt.Sprint(s.value.Interface())
+}
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envFrom(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("unexpected error writing config file: %v", err)
+	}
+
+	return path
+}
+
+func parseFlags(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	BindFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("unexpected error parsing flags: %v", err)
+	}
+
+	return flags
+}
+
+const testConfigFile = `
+database:
+  host: file-host
+  port: 5433
+  creds_file: ./pgcreds
+http:
+  port: 9000
+  read_timeout: 3s
+profiles:
+  production:
+    database:
+      host: prod-host
+    session:
+      cookie_name: prod_session
+  staging:
+    http:
+      port: 9100
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, testConfigFile)
+
+	cfg, err := Load(Options{
+		Flags: parseFlags(t, "-env", "production", "-config", path,
+			"-port", "9443"),
+		LookupEnv: envFrom(map[string]string{
+			"PG_PORT":          "6543",
+			"HTTP_PORT":        "9200",
+			"PG_QUERY_TIMEOUT": "2s",
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"default", cfg.Database.Name, "postgres"},
+		{"env default", cfg.Session.Secure, true},
+		{"file", cfg.HTTP.ReadTimeout, 3 * time.Second},
+		{"profile over file", cfg.Database.Host, "prod-host"},
+		{"profile over default", cfg.Session.CookieName, "prod_session"},
+		{"env over file", cfg.Database.Port, 6543},
+		{"env over default", cfg.Database.QueryTimeout, 2 * time.Second},
+		{"flag over env", cfg.HTTP.Port, 9443},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	path := writeConfigFile(t, testConfigFile)
+
+	t.Run("from environment variable", func(t *testing.T) {
+		cfg, err := Load(Options{LookupEnv: envFrom(map[string]string{
+			ENV_ENV_VAR:         "staging",
+			CONFIG_FILE_ENV_VAR: path,
+		})})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if cfg.Env != "staging" || cfg.HTTP.Port != 9100 {
+			t.Errorf("expected the staging profile, got %s on %d",
+				cfg.Env, cfg.HTTP.Port)
+		}
+	})
+
+	t.Run("unknown environment", func(t *testing.T) {
+		_, err := Load(Options{LookupEnv: envFrom(map[string]string{
+			ENV_ENV_VAR:         "prod",
+			CONFIG_FILE_ENV_VAR: path,
+		})})
+		if err == nil || !strings.Contains(err.Error(), `"prod"`) {
+			t.Errorf("expected unknown environment error, got %v", err)
+		}
+	})
+
+	t.Run("test uses the memory database", func(t *testing.T) {
+		cfg, err := Load(Options{LookupEnv: envFrom(map[string]string{
+			ENV_ENV_VAR: TEST,
+		})})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if cfg.Database.Driver != "memory" {
+			t.Errorf("expected memory driver, got %s", cfg.Database.Driver)
+		}
+	})
+}
+
+func TestLoadLists(t *testing.T) {
+	path := writeConfigFile(t, `
+auth:
+  reserved_usernames: [muaddib, usul]
+  profane_words: [worm]
+`)
+
+	cfg, err := Load(Options{
+		Flags: parseFlags(t, "-config", path,
+			"-auth-denied-email-domains", "spam.com, ,tempmail.org"),
+		LookupEnv: envFrom(map[string]string{
+			"PG_CREDS_FILE":      "./pgcreds",
+			"AUTH_PROFANE_WORDS": "slug, gholam",
+		}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"file", cfg.Auth.ReservedUsernames, []string{"muaddib", "usul"}},
+		{"env over file", cfg.Auth.ProfaneWords, []string{"slug", "gholam"}},
+		{"flag drops empty entries", cfg.Auth.DeniedEmailDomains,
+			[]string{"spam.com", "tempmail.org"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !slices.Equal(tt.got, tt.want) {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFailsFast(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "malformed env integer",
+			env:     map[string]string{"PG_PORT": "five"},
+			wantErr: `invalid PG_PORT: "five" is not an integer`,
+		},
+		{
+			name:    "malformed env duration",
+			env:     map[string]string{"PG_QUERY_TIMEOUT": "5"},
+			wantErr: "invalid PG_QUERY_TIMEOUT",
+		},
+		{
+			name:    "malformed flag",
+			args:    []string{"-session-secure=maybe"},
+			wantErr: "invalid -session-secure",
+		},
+		{
+			name:    "unknown file key",
+			file:    "database:\n  hots: localhost\n",
+			wantErr: "field hots not found",
+		},
+		{
+			name:    "unknown profile key",
+			file:    "profiles:\n  production:\n    htp: {}\n",
+			env:     map[string]string{ENV_ENV_VAR: PRODUCTION},
+			wantErr: "invalid profile production",
+		},
+		{
+			name:    "missing explicit file",
+			env:     map[string]string{CONFIG_FILE_ENV_VAR: "missing.yaml"},
+			wantErr: "failed to read config file",
+		},
+		{
+			name:    "not a domain",
+			env:     map[string]string{"AUTH_DENIED_EMAIL_DOMAINS": "spice.com,a b"},
+			wantErr: `auth.denied_email_domains: "a b" is not a domain`,
+		},
+		{
+			name:    "empty list entry",
+			file:    "auth:\n  profane_words: [\"\"]\n",
+			wantErr: "auth.profane_words: must not hold empty entries",
+		},
+		{
+			name:    "out of range",
+			env:     map[string]string{"HTTP_PORT": "70000"},
+			wantErr: "http.port: 70000 is not a port",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"PG_CREDS_FILE": "./pgcreds"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			if tt.file != "" {
+				env[CONFIG_FILE_ENV_VAR] = writeConfigFile(t, tt.file)
+			}
+
+			_, err := Load(Options{
+				Flags:     parseFlags(t, tt.args...),
+				LookupEnv: envFrom(env),
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := Defaults(DEVELOPMENT)
+	cfg.Database.CredsFile = "./pgcreds"
+	cfg.Database.SSLMode = "sometimes"
+	cfg.Game.MaxPlayers = 7
+	cfg.Retention.ArchiveAfterDays = 0
+	cfg.Log.Level = "verbose"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, key := range []string{"database.sslmode", "game.max_players",
+		"retention.archive_after_days", "log.level"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected %s in %q", key, err)
+		}
+	}
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	cfg := Defaults(DEVELOPMENT)
+	cfg.Database.Password = "0123456789abcdef0123456789abcdef"
+
+	for name, printed := range map[string]string{
+		"String": cfg.String(),
+		"%v":     fmt.Sprintf("%v", cfg.Database),
+		"%#v":    fmt.Sprintf("%#v", cfg.Database),
+	} {
+		if strings.Contains(printed, cfg.Database.Password.Reveal()) {
+			t.Errorf("%s leaks the secret: %s", name, printed)
+		}
+	}
+
+	if !strings.Contains(cfg.String(), REDACTED) {
+		t.Errorf("expected a redacted secret in %s", cfg.String())
+	}
+}
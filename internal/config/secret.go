@@ -0,0 +1,35 @@
+package config
+
+import "encoding/json"
+
+const REDACTED = "[redacted]"
+
+// Secret is a setting that must never be printed or logged, every
+// formatting and marshalling redacts it. Reveal returns the actual value
+type Secret string
+
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String keeps telling whether the secret is set
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return REDACTED
+}
+
+// Obfuscate in %#v formatting
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	MIN_BCRYPT_COST = 4
+	MAX_BCRYPT_COST = 31
+	// ABSOLUTE_MAX_PLAYERS is the number of factions in the game
+	ABSOLUTE_MAX_PLAYERS = 6
+)
+
+var (
+	envNameRegex = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	sslModes     = []string{
+		"disable", "allow", "prefer", "require", "verify-ca", "verify-full",
+	}
+	logLevels = []string{"debug", "info", "warn", "error"}
+)
+
+// Validate reports every invalid setting at once, so a broken deployment is
+// fixed in a single round
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs,
+				fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(envNameRegex.MatchString(c.Env), "env",
+		"%q must be lowercase letters, digits and dashes", c.Env)
+
+	db := c.Database
+	check(db.Driver != "", "database.driver", "must be set")
+	check(validPort(db.Port), "database.port", "%d is not a port", db.Port)
+	check(slices.Contains(sslModes, db.SSLMode), "database.sslmode",
+		"%q is not one of %v", db.SSLMode, sslModes)
+	check(db.MaxOpenConns >= 0, "database.max_open_conns",
+		"must not be negative")
+	check(db.MaxIdleConns >= 0, "database.max_idle_conns",
+		"must not be negative")
+	check(db.MaxOpenConns == 0 || db.MaxIdleConns <= db.MaxOpenConns,
+		"database.max_idle_conns", "must not exceed max_open_conns")
+	checkNotNegative(check, "database.query_timeout", db.QueryTimeout)
+	checkNotNegative(check, "database.conn_max_lifetime", db.ConnMaxLifetime)
+	checkNotNegative(check, "database.conn_max_idle_time", db.ConnMaxIdleTime)
+	checkNotNegative(check, "database.connect_timeout", db.ConnectTimeout)
+
+	http := c.HTTP
+	check(validPort(http.Port), "http.port", "%d is not a port", http.Port)
+	checkPositive(check, "http.read_timeout", http.ReadTimeout)
+	checkPositive(check, "http.write_timeout", http.WriteTimeout)
+	checkNotNegative(check, "http.shutdown_timeout", http.ShutdownTimeout)
+
+	check(c.Auth.BcryptCost >= MIN_BCRYPT_COST &&
+		c.Auth.BcryptCost <= MAX_BCRYPT_COST, "auth.bcrypt_cost",
+		"%d is not between %d and %d",
+		c.Auth.BcryptCost, MIN_BCRYPT_COST, MAX_BCRYPT_COST)
+
+	for _, list := range []struct {
+		key    string
+		values []string
+	}{
+		{"auth.reserved_usernames", c.Auth.ReservedUsernames},
+		{"auth.profane_words", c.Auth.ProfaneWords},
+		{"auth.denied_email_domains", c.Auth.DeniedEmailDomains},
+	} {
+		for _, value := range list.values {
+			check(strings.TrimSpace(value) != "", list.key,
+				"must not hold empty entries")
+		}
+	}
+	for _, domain := range c.Auth.DeniedEmailDomains {
+		if strings.TrimSpace(domain) == "" {
+			continue
+		}
+		_, err := idna.Lookup.ToASCII(strings.TrimSpace(domain))
+		check(err == nil, "auth.denied_email_domains",
+			"%q is not a domain", domain)
+	}
+
+	session := c.Session
+	check(session.CookieName != "", "session.cookie_name", "must be set")
+	checkPositive(check, "session.max_age", session.MaxAge)
+
+	game := c.Game
+	check(game.MinPlayers >= 2, "game.min_players", "must be at least 2")
+	check(game.MaxPlayers >= game.MinPlayers &&
+		game.MaxPlayers <= ABSOLUTE_MAX_PLAYERS, "game.max_players",
+		"%d is not between min_players and %d",
+		game.MaxPlayers, ABSOLUTE_MAX_PLAYERS)
+
+	retention := c.Retention
+	check(retention.ArchiveAfterDays > 0, "retention.archive_after_days",
+		"must be positive")
+	check(retention.AbandonedLobbyDays > 0,
+		"retention.abandoned_lobby_days", "must be positive")
+	checkPositive(check, "retention.interval", retention.Interval)
+
+	check(slices.Contains(logLevels, c.Log.Level), "log.level",
+		"%q is not one of %v", c.Log.Level, logLevels)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func checkPositive(
+	check func(ok bool, key, format string, args ...any),
+	key string,
+	d time.Duration,
+) {
+	check(d > 0, key, "must be positive")
+}
+
+func checkNotNegative(
+	check func(ok bool, key, format string, args ...any),
+	key string,
+	d time.Duration,
+) {
+	check(d >= 0, key, "must not be negative")
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	CONNECT_RETRY_DELAY     = 100 * time.Millisecond
+	MAX_CONNECT_RETRY_DELAY = 5 * time.Second
+)
+
+// WaitUntilAvailable calls ping until it succeeds, fails with an error other
+// than ErrUnavailable or timeout elapses. It lets the application start
+// before the database is up, as happens with docker compose. The delay
+// between attempts doubles up to MAX_CONNECT_RETRY_DELAY, a zero timeout
+// tries only once
+func WaitUntilAvailable(
+	ctx context.Context,
+	timeout time.Duration,
+	ping func(ctx context.Context) error,
+) error {
+	deadline := time.Now().Add(timeout)
+	delay := CONNECT_RETRY_DELAY
+
+	for {
+		err := ping(ctx)
+		if !errors.Is(err, ErrUnavailable) {
+			return err
+		}
+
+		wait := delay/2 + rand.N(delay/2)
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("gave up after %s: %w", timeout, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		delay = min(delay*2, MAX_CONNECT_RETRY_DELAY)
+	}
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWaitUntilAvailable(t *testing.T) {
+	t.Run("succeeds once reachable", func(t *testing.T) {
+		calls := 0
+		err := WaitUntilAvailable(context.Background(), time.Second,
+			func(ctx context.Context) error {
+				calls++
+				if calls < 3 {
+					return fmt.Errorf("dial: %w", ErrUnavailable)
+				}
+				return nil
+			})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 calls, got %d", calls)
+		}
+	})
+
+	t.Run("gives up after timeout", func(t *testing.T) {
+		start := time.Now()
+		err := WaitUntilAvailable(context.Background(), 300*time.Millisecond,
+			func(ctx context.Context) error {
+				return ErrUnavailable
+			})
+
+		if !errors.Is(err, ErrUnavailable) {
+			t.Errorf("expected unavailable error, got %v", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Errorf("expected to give up, took %s", time.Since(start))
+		}
+	})
+
+	t.Run("zero timeout tries once", func(t *testing.T) {
+		calls := 0
+		WaitUntilAvailable(context.Background(), 0,
+			func(ctx context.Context) error {
+				calls++
+				return ErrUnavailable
+			})
+
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		calls := 0
+		wrongPassword := errors.New("password authentication failed")
+		err := WaitUntilAvailable(context.Background(), time.Second,
+			func(ctx context.Context) error {
+				calls++
+				return wrongPassword
+			})
+
+		if !errors.Is(err, wrongPassword) {
+			t.Errorf("expected authentication error, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("stops when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := WaitUntilAvailable(ctx, time.Minute,
+			func(ctx context.Context) error {
+				cancel()
+				return ErrUnavailable
+			})
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context canceled, got %v", err)
+		}
+	})
+}
@@ -1,27 +1,216 @@
 package database
 
 import (
-	"duna/internal/database/postgres"
+	"context"
+	"duna/internal/config"
 	"duna/internal/hash"
+	"fmt"
+	"sync"
+	"time"
 
 	"duna/internal/models"
 )
 
+const (
+	POSTGRES_DRIVER = "postgres"
+	// MEMORY_DRIVER loses everything on exit, it lets the server run without
+	// any external service during development and integration tests
+	MEMORY_DRIVER = "memory"
+)
+
+// Database is the persistence layer of the application. Every method takes a
+// context, cancelling it aborts the query in flight, implementations also
+// bound each query with a default timeout when the context has no deadline.
+// Reads outside of WithTx may be served by a lagging replica, see
+// WithPrimaryReads
 type Database interface {
-	Migrate() error
-	// users
-	InsertUser(user models.User) error
-	GetUserByUsername(username string, hash hash.HashStrategy) (models.User, error)
+	Repos
+
+	Migrate(ctx context.Context) error
+
+	// Ping checks the database can serve queries right now, readiness probes
+	// call it. Failures to reach the database wrap ErrUnavailable
+	Ping(ctx context.Context) error
+
+	// WithTx runs fn inside a transaction, every repository handed to fn
+	// shares it. The transaction commits when fn returns nil and rolls back
+	// otherwise. When it fails with ErrSerialization fn runs again from
+	// scratch, so it must not have side effects outside of repos
+	WithTx(ctx context.Context, fn func(repos Repos) error) error
+}
+
+// Repos groups every repository, Database implements it outside of any
+// transaction and WithTx hands out a transactional version
+type Repos interface {
+	UserRepository
+	MatchRepository
+	EventRepository
+	ContentRepository
+	ArchiveRepository
+	SessionRepository
+}
+
+type UserRepository interface {
+	InsertUser(ctx context.Context, user models.User) error
+	GetUserByUsername(ctx context.Context, username string,
+		hash hash.HashStrategy) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string,
+		hash hash.HashStrategy) (models.User, error)
+	GetUserByUUID(ctx context.Context, uuid string,
+		hash hash.HashStrategy) (models.User, error)
+	ListUsers(ctx context.Context, filter UserFilter, page PageRequest,
+		hash hash.HashStrategy) (Page[models.User], error)
+	// UpdateUserPassword stores the hash held by password
+	UpdateUserPassword(ctx context.Context, uuid string,
+		password models.Password) error
+	SetUserDisabled(ctx context.Context, uuid string, disabled bool) error
+	SetUserRole(ctx context.Context, uuid string, role models.Role) error
+}
+
+// UserFilter narrows ListUsers, zero values match everything
+type UserFilter struct {
+	// UsernamePrefix is compared against the canonical username
+	UsernamePrefix string
+}
+
+// MatchRepository stores matches and their seats (the users_matches
+// table). Matches are always returned with their seats loaded
+type MatchRepository interface {
+	// InsertMatch ignores match.Version, new matches start at version 1
+	InsertMatch(ctx context.Context, match models.Match) error
+	GetMatch(ctx context.Context, uuid string) (models.Match, error)
+	// ListMatches pages through matches newest first
+	ListMatches(ctx context.Context, filter MatchFilter,
+		page PageRequest) (Page[models.Match], error)
+	// UpdateMatchState changes the state if the match is still at version
+	// and returns the new version, a *StaleError otherwise. Moving to
+	// models.Finish sets FinishedAt. Legal transitions are up to the game
+	// layer
+	UpdateMatchState(ctx context.Context, uuid string, version int64,
+		state models.MatchState) (int64, error)
+	// DeleteMatch removes the match along with its seats
+	DeleteMatch(ctx context.Context, uuid string) error
+
+	AddPlayer(ctx context.Context, matchUUID, userUUID string) error
+	RemovePlayer(ctx context.Context, matchUUID, userUUID string) error
+	PlayersInMatch(ctx context.Context, matchUUID string) ([]models.Seat, error)
+	MatchesForUser(ctx context.Context, userUUID string) ([]models.Match, error)
+}
+
+// MatchFilter narrows ListMatches, zero values match everything
+type MatchFilter struct {
+	State         *models.MatchState
+	CreatedByUser string
+	Player        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// FinishedBefore keeps matches finished before it, unfinished matches
+	// never match
+	FinishedBefore time.Time
+	// OpenSeats keeps matches with less than models.MAX_PLAYERS seated
+	OpenSeats bool
+}
+
+// EventRepository is the append-only log of match events and the snapshots
+// folded from it. Events are never updated, they go away with their match
+type EventRepository interface {
+	// AppendEvents stores the events atomically. A seq already taken fails
+	// with a *ConflictError on match_events_pkey, the writer lost a race
+	// and must reload the match before acting again
+	AppendEvents(ctx context.Context, events ...models.MatchEvent) error
+	// LoadEvents returns the events of a match with a seq above afterSeq,
+	// in seq order
+	LoadEvents(ctx context.Context, matchUUID string,
+		afterSeq int64) ([]models.MatchEvent, error)
+	// SaveSnapshot stores the state of a match at snapshot.Seq, saving the
+	// same seq twice keeps the first one
+	SaveSnapshot(ctx context.Context, snapshot models.MatchSnapshot) error
+	// LatestSnapshot returns the snapshot with the highest seq, ErrNotFound
+	// when the match has none
+	LatestSnapshot(ctx context.Context,
+		matchUUID string) (models.MatchSnapshot, error)
+}
+
+// ContentRepository holds the static game content, see models.GameContent
+type ContentRepository interface {
+	// UpsertContent inserts the entries missing and updates the ones that
+	// changed, matching them by key, and returns how many were written.
+	// Entries absent from content are left alone
+	UpsertContent(ctx context.Context, content models.GameContent) (int, error)
+	// LoadContent returns every entry, each kind ordered by key
+	LoadContent(ctx context.Context) (models.GameContent, error)
+}
+
+// ArchiveRepository keeps a summary and the compressed event log of the
+// matches moved out of the matches table, see the retention package
+type ArchiveRepository interface {
+	// InsertMatchArchive stores the archive, deleting the match is up to
+	// the caller, in the same transaction
+	InsertMatchArchive(ctx context.Context, archive models.MatchArchive) error
+	GetMatchArchive(ctx context.Context,
+		matchUUID string) (models.MatchArchive, error)
+}
+
+// SessionRepository stores the sessions of logged in users keyed by the
+// hash of their token, see auth.DatabaseSessionStore
+type SessionRepository interface {
+	InsertSession(ctx context.Context, session models.Session) error
+	// GetSession returns expired sessions too, it is up to the caller to
+	// reject them
+	GetSession(ctx context.Context, tokenHash string) (models.Session, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	// ListUserSessions returns the sessions of a user still valid at now,
+	// newest first
+	ListUserSessions(ctx context.Context, userUUID string,
+		now time.Time) ([]models.Session, error)
+	// DeleteUserSessions logs a user out everywhere and returns the number
+	// of sessions deleted, expired ones included
+	DeleteUserSessions(ctx context.Context, userUUID string) (int, error)
+}
+
+// ServerClock is implemented by databases running on another host, whose
+// clock may drift from the one of the application
+type ServerClock interface {
+	ServerTime(ctx context.Context) (time.Time, error)
+}
+
+// Driver builds a Database from its configuration, ctx bounds the wait for
+// the database to become reachable
+type Driver func(
+	ctx context.Context,
+	cfg config.DatabaseConfig,
+) (Database, error)
 
-	// matches
-	InsertMatch(match models.Match) error
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{}
+)
+
+// Register makes a driver available by name, implementations call it from
+// their init function the same way database/sql drivers do, so they can
+// depend on this package for the interface and errors
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, exists := drivers[name]; exists {
+		panic("database: Register called twice for driver " + name)
+	}
+	drivers[name] = driver
 }
 
-func NewDatabase() (Database, error) {
-	config, err := postgres.NewPostgresConfig()
-	if err != nil {
-		return nil, err
+// NewDatabase builds the implementation selected by cfg.Driver
+func NewDatabase(
+	ctx context.Context,
+	cfg config.DatabaseConfig,
+) (Database, error) {
+	driversMu.RLock()
+	driver, ok := drivers[cfg.Driver]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown database driver %q (forgotten import?)",
+			cfg.Driver)
 	}
 
-	return postgres.NewPostgresDatabase(*config)
+	return driver(ctx, cfg)
 }
@@ -0,0 +1,1181 @@
+// Package databasetest holds the behaviour every database.Database
+// implementation must share, each implementation runs it from its own tests
+package databasetest
+
+import (
+	"context"
+	"crypto/sha256"
+	"duna/internal/database"
+	"duna/internal/models"
+	"duna/internal/uuid"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a migrated database ready to be used by a single test.
+// Tests never assume the database is empty, every row they create uses
+// fresh identifiers so a shared postgres instance can be reused
+type Factory func(t *testing.T) database.Database
+
+var testHash = models.HashStrategyMock{
+	FuncEncode: func(str string) (string, error) {
+		return "hashed:" + str, nil
+	},
+	FuncCompare: func(enconded, str string) bool {
+		return enconded == "hashed:"+str
+	},
+}
+
+func RunContractTests(t *testing.T, newDatabase Factory) {
+	t.Run("ping", func(t *testing.T) {
+		assert.NoError(t, newDatabase(t).Ping(context.Background()))
+	})
+	t.Run("users", func(t *testing.T) { testUsers(t, newDatabase) })
+	t.Run("matches", func(t *testing.T) { testMatches(t, newDatabase) })
+	t.Run("events", func(t *testing.T) { testEvents(t, newDatabase) })
+	t.Run("content", func(t *testing.T) { testContent(t, newDatabase) })
+	t.Run("archives", func(t *testing.T) { testArchives(t, newDatabase) })
+	t.Run("sessions", func(t *testing.T) { testSessions(t, newDatabase) })
+	t.Run("transactions", func(t *testing.T) {
+		testTransactions(t, newDatabase)
+	})
+	t.Run("cancelled context", func(t *testing.T) {
+		testCancelledContext(t, newDatabase)
+	})
+}
+
+// NewTestUser builds a valid user with a unique username and email
+func NewTestUser(t *testing.T) models.User {
+	suffix := strings.ReplaceAll(uuid.V4Strategy{}.New(), "-", "")[:12]
+
+	username, err := models.NewUsername("Player_" + suffix)
+	require.NoError(t, err)
+
+	email, err := models.NewEmail("Player." + suffix + "@Arrakis.com")
+	require.NoError(t, err)
+
+	password, err := models.NewPassword("Sp1ce-must-flow", false, testHash)
+	require.NoError(t, err)
+
+	return models.CreateUser(uuid.V7Strategy{}, username, email, password)
+}
+
+func testUsers(t *testing.T, newDatabase Factory) {
+	ctx := context.Background()
+
+	t.Run("insert and get by username", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		got, err := db.GetUserByUsername(
+			ctx, strings.ToUpper(user.Username.String()), testHash)
+		require.NoError(t, err)
+
+		assert.Equal(t, user.UUID, got.UUID)
+		assert.Equal(t, user.Username, got.Username)
+		assert.Equal(t, user.Email, got.Email)
+		assert.True(t, got.Password().Compare("Sp1ce-must-flow"))
+	})
+
+	t.Run("insert and get by email", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		got, err := db.GetUserByEmail(
+			ctx, strings.ToLower(user.Email.String()), testHash)
+		require.NoError(t, err)
+
+		assert.Equal(t, user.UUID, got.UUID)
+		assert.Equal(t, user.Email, got.Email)
+	})
+
+	t.Run("get user stored under older email rules", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		// accepted before emails were parsed as addr-specs
+		user.Email = models.Email("Player..Two@arrakis.com")
+		_, err := models.NewEmail(user.Email.String())
+		require.Error(t, err)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		got, err := db.GetUserByUsername(
+			ctx, user.Username.String(), testHash)
+		require.NoError(t, err)
+		assert.Equal(t, user.Email, got.Email)
+
+		got, err = db.GetUserByEmail(ctx, "player..two@arrakis.com", testHash)
+		require.NoError(t, err)
+		assert.Equal(t, user.UUID, got.UUID)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		db := newDatabase(t)
+
+		_, err := db.GetUserByUsername(ctx, "nobody_"+uuid.V4Strategy{}.New()[:8],
+			testHash)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+		assert.EqualError(t, err, "user not found")
+
+		_, err = db.GetUserByEmail(ctx, "nobody@nowhere.com", testHash)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("duplicate uuid", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		other := NewTestUser(t)
+		duplicated := models.NewUser(
+			user.UUID, other.Username, other.Email, other.Password())
+		assertConflict(t, db.InsertUser(ctx, duplicated), "users_pkey")
+	})
+
+	t.Run("duplicate username ignoring case", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		other := NewTestUser(t)
+		duplicated := models.NewUser(other.UUID,
+			models.Username(strings.ToUpper(user.Username.String())),
+			other.Email, other.Password())
+		assertConflict(t, db.InsertUser(ctx, duplicated),
+			"users_username_canonical_key")
+	})
+
+	t.Run("duplicate email ignoring case", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		other := NewTestUser(t)
+		duplicated := models.NewUser(other.UUID, other.Username,
+			models.Email(strings.ToUpper(user.Email.String())),
+			other.Password())
+		assertConflict(t, db.InsertUser(ctx, duplicated),
+			"users_email_canonical_key")
+	})
+
+	t.Run("list users by prefix", func(t *testing.T) {
+		db := newDatabase(t)
+		prefix := "list_" + strings.ReplaceAll(
+			uuid.V4Strategy{}.New(), "-", "")[:8]
+
+		var want []string
+		for _, suffix := range []string{"_c", "_A", "_b"} {
+			user := NewTestUser(t)
+			user = models.NewUser(user.UUID,
+				models.Username(prefix+suffix), user.Email, user.Password())
+			require.NoError(t, db.InsertUser(ctx, user))
+			want = append(want, user.UUID)
+		}
+		want = []string{want[1], want[2], want[0]}
+
+		var got []string
+		request := database.PageRequest{Limit: 2}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 2, "pagination does not terminate")
+
+			page, err := db.ListUsers(ctx, database.UserFilter{
+				UsernamePrefix: strings.ToUpper(prefix),
+			}, request, testHash)
+			require.NoError(t, err)
+			for _, user := range page.Items {
+				got = append(got, user.UUID)
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			request.Cursor = page.NextCursor
+		}
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("list users escapes like patterns", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		page, err := db.ListUsers(ctx, database.UserFilter{
+			UsernamePrefix: "player%" + user.Username.String()[len("Player_"):],
+		}, database.PageRequest{}, testHash)
+		require.NoError(t, err)
+		assert.Empty(t, page.Items)
+	})
+
+	t.Run("new users are enabled players", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		got, err := db.GetUserByUUID(ctx, user.UUID, testHash)
+		require.NoError(t, err)
+		assert.Equal(t, user.Username, got.Username)
+		assert.Equal(t, models.PLAYER_ROLE, got.Role)
+		assert.False(t, got.Disabled)
+	})
+
+	t.Run("update user", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		password, err := models.NewPassword("Sh4i-hulud", false, testHash)
+		require.NoError(t, err)
+		require.NoError(t, db.UpdateUserPassword(ctx, user.UUID, password))
+		require.NoError(t, db.SetUserDisabled(ctx, user.UUID, true))
+		require.NoError(t, db.SetUserRole(ctx, user.UUID, models.ADMIN_ROLE))
+
+		got, err := db.GetUserByEmail(ctx, user.Email.String(), testHash)
+		require.NoError(t, err)
+		assert.True(t, got.Password().Compare("Sh4i-hulud"))
+		assert.True(t, got.Disabled)
+		assert.Equal(t, models.ADMIN_ROLE, got.Role)
+	})
+
+	t.Run("invalid role", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		assertInvalid(t, db.SetUserRole(ctx, user.UUID, "emperor"),
+			"users_role_valid")
+	})
+
+	t.Run("update missing user", func(t *testing.T) {
+		db := newDatabase(t)
+		missing := uuid.V4Strategy{}.New()
+
+		_, err := db.GetUserByUUID(ctx, missing, testHash)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+		assert.ErrorIs(t, db.SetUserDisabled(ctx, missing, true),
+			database.ErrNotFound)
+		assert.ErrorIs(t, db.SetUserRole(ctx, missing, models.ADMIN_ROLE),
+			database.ErrNotFound)
+	})
+}
+
+// newTestSession builds a session of user expiring after ttl
+func newTestSession(user models.User, ttl time.Duration) models.Session {
+	token := sha256.Sum256([]byte(uuid.V4Strategy{}.New()))
+	now := time.Now()
+
+	return models.Session{
+		TokenHash: hex.EncodeToString(token[:]),
+		UserUUID:  user.UUID,
+		CSRFToken: uuid.V4Strategy{}.New(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+func testSessions(t *testing.T, newDatabase Factory) {
+	ctx := context.Background()
+
+	t.Run("insert, get and delete", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		session := newTestSession(user, time.Hour)
+		require.NoError(t, db.InsertSession(ctx, session))
+		assertConflict(t, db.InsertSession(ctx, session), "sessions_pkey")
+
+		got, err := db.GetSession(ctx, session.TokenHash)
+		require.NoError(t, err)
+		assert.Equal(t, session.UserUUID, got.UserUUID)
+		assert.Equal(t, session.CSRFToken, got.CSRFToken)
+		assert.True(t, session.ExpiresAt.Truncate(time.Microsecond).
+			Equal(got.ExpiresAt))
+
+		require.NoError(t, db.DeleteSession(ctx, session.TokenHash))
+		_, err = db.GetSession(ctx, session.TokenHash)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+		assert.ErrorIs(t, db.DeleteSession(ctx, session.TokenHash),
+			database.ErrNotFound)
+	})
+
+	t.Run("session of a missing user", func(t *testing.T) {
+		db := newDatabase(t)
+		session := newTestSession(NewTestUser(t), time.Hour)
+
+		assertInvalid(t, db.InsertSession(ctx, session),
+			"sessions_user_uuid_fkey")
+	})
+
+	t.Run("list and delete user sessions", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		older := newTestSession(user, time.Hour)
+		older.CreatedAt = older.CreatedAt.Add(-time.Minute)
+		newer := newTestSession(user, time.Hour)
+		expired := newTestSession(user, -time.Minute)
+		for _, session := range []models.Session{older, newer, expired} {
+			require.NoError(t, db.InsertSession(ctx, session))
+		}
+
+		sessions, err := db.ListUserSessions(ctx, user.UUID, time.Now())
+		require.NoError(t, err)
+		var hashes []string
+		for _, session := range sessions {
+			hashes = append(hashes, session.TokenHash)
+		}
+		assert.Equal(t, []string{newer.TokenHash, older.TokenHash}, hashes)
+
+		// expired sessions are still read so the caller can tell them apart
+		_, err = db.GetSession(ctx, expired.TokenHash)
+		assert.NoError(t, err)
+
+		deleted, err := db.DeleteUserSessions(ctx, user.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, deleted)
+
+		sessions, err = db.ListUserSessions(ctx, user.UUID, time.Now())
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+}
+
+// newTestMatch builds a lobby owned by a random creator, so filtering by
+// creator isolates the matches of a single test
+func newTestMatch() models.Match {
+	match := models.NewMatch(uuid.V7Strategy{}.New(), models.WaitingPlayers)
+	match.CreatedByUser = uuid.V4Strategy{}.New()
+
+	return match
+}
+
+func testMatches(t *testing.T, newDatabase Factory) {
+	ctx := context.Background()
+
+	t.Run("insert and get", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		got, err := db.GetMatch(ctx, match.UUID)
+		require.NoError(t, err)
+
+		assert.Equal(t, match.UUID, got.UUID)
+		assert.Equal(t, match.MatchState, got.MatchState)
+		assert.Equal(t, match.CreatedByUser, got.CreatedByUser)
+		assert.Empty(t, got.Seats)
+	})
+
+	t.Run("match not found", func(t *testing.T) {
+		db := newDatabase(t)
+
+		_, err := db.GetMatch(ctx, uuid.V4Strategy{}.New())
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("duplicate uuid", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		assertConflict(t, db.InsertMatch(ctx, match), "matches_pkey")
+	})
+
+	t.Run("invalid state", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		match.MatchState = models.MatchState(42)
+
+		assertInvalid(t, db.InsertMatch(ctx, match), "match_state_valid")
+	})
+
+	t.Run("update state", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		match.Version = 42
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		got, err := db.GetMatch(ctx, match.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), got.Version)
+
+		version, err := db.UpdateMatchState(
+			ctx, match.UUID, got.Version, models.InGame)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), version)
+
+		got, err = db.GetMatch(ctx, match.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, models.MatchState(models.InGame), got.MatchState)
+		assert.Equal(t, version, got.Version)
+		assert.True(t, got.FinishedAt.IsZero())
+
+		_, err = db.UpdateMatchState(ctx, match.UUID, version, 42)
+		assertInvalid(t, err, "match_state_valid")
+
+		_, err = db.UpdateMatchState(
+			ctx, uuid.V4Strategy{}.New(), 1, models.Finish)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("stale state update", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		_, err := db.UpdateMatchState(ctx, match.UUID, 1, models.InGame)
+		require.NoError(t, err)
+
+		// a second writer still holding version 1 loses
+		_, err = db.UpdateMatchState(ctx, match.UUID, 1, models.Finish)
+		assert.ErrorIs(t, err, database.ErrStale)
+		assert.ErrorIs(t, err, database.ErrConflict)
+
+		var staleErr *database.StaleError
+		require.ErrorAs(t, err, &staleErr)
+		assert.Equal(t, int64(1), staleErr.Expected)
+		assert.Equal(t, int64(2), staleErr.Actual)
+
+		got, err := db.GetMatch(ctx, match.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, models.MatchState(models.InGame), got.MatchState)
+	})
+
+	t.Run("players", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		first, second := NewTestUser(t), NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, first))
+		require.NoError(t, db.InsertUser(ctx, second))
+
+		require.NoError(t, db.AddPlayer(ctx, match.UUID, first.UUID))
+		require.NoError(t, db.AddPlayer(ctx, match.UUID, second.UUID))
+		assertConflict(t, db.AddPlayer(ctx, match.UUID, first.UUID),
+			"users_matches_pkey")
+
+		seats, err := db.PlayersInMatch(ctx, match.UUID)
+		require.NoError(t, err)
+		require.Len(t, seats, 2)
+		assert.Equal(t, first.UUID, seats[0].UserUUID)
+		assert.Equal(t, second.UUID, seats[1].UserUUID)
+		assert.False(t, seats[0].JoinedAt.IsZero())
+
+		got, err := db.GetMatch(ctx, match.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, seats, got.Seats)
+
+		require.NoError(t, db.RemovePlayer(ctx, match.UUID, first.UUID))
+		assert.ErrorIs(t, db.RemovePlayer(ctx, match.UUID, first.UUID),
+			database.ErrNotFound)
+
+		seats, err = db.PlayersInMatch(ctx, match.UUID)
+		require.NoError(t, err)
+		require.Len(t, seats, 1)
+		assert.Equal(t, second.UUID, seats[0].UserUUID)
+	})
+
+	t.Run("add player to missing match or user", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		assertInvalid(t, db.AddPlayer(ctx, uuid.V4Strategy{}.New(), user.UUID),
+			"users_matches_match_uuid_fkey")
+		assertInvalid(t, db.AddPlayer(ctx, match.UUID, uuid.V4Strategy{}.New()),
+			"users_matches_user_uuid_fkey")
+	})
+
+	t.Run("list and matches for user", func(t *testing.T) {
+		db := newDatabase(t)
+		creator := uuid.V4Strategy{}.New()
+		now := time.Now().Truncate(time.Second)
+
+		lobby, running, other := newTestMatch(), newTestMatch(), newTestMatch()
+		lobby.CreatedByUser = creator
+		lobby.CreatedAt = now.Add(-2 * time.Minute)
+		running.CreatedByUser = creator
+		running.MatchState = models.InGame
+		running.CreatedAt = now.Add(-time.Minute)
+		other.CreatedAt = now.Add(-3 * time.Minute)
+		for _, match := range []models.Match{lobby, running, other} {
+			require.NoError(t, db.InsertMatch(ctx, match))
+		}
+
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+		require.NoError(t, db.AddPlayer(ctx, running.UUID, user.UUID))
+		require.NoError(t, db.AddPlayer(ctx, other.UUID, user.UUID))
+
+		page, err := db.ListMatches(ctx,
+			database.MatchFilter{CreatedByUser: creator}, database.PageRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{running.UUID, lobby.UUID},
+			matchUUIDs(page.Items))
+		assert.Empty(t, page.NextCursor)
+		assert.True(t, running.CreatedAt.Equal(page.Items[0].CreatedAt))
+
+		inGame := models.MatchState(models.InGame)
+		page, err = db.ListMatches(ctx, database.MatchFilter{
+			CreatedByUser: creator,
+			State:         &inGame,
+		}, database.PageRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{running.UUID}, matchUUIDs(page.Items))
+		assert.Len(t, page.Items[0].Seats, 1)
+
+		page, err = db.ListMatches(ctx, database.MatchFilter{
+			CreatedByUser: creator,
+			Player:        user.UUID,
+		}, database.PageRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{running.UUID}, matchUUIDs(page.Items))
+
+		page, err = db.ListMatches(ctx, database.MatchFilter{
+			CreatedByUser: creator,
+			CreatedAfter:  lobby.CreatedAt,
+		}, database.PageRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{running.UUID}, matchUUIDs(page.Items))
+
+		matches, err := db.MatchesForUser(ctx, user.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{running.UUID, other.UUID}, matchUUIDs(matches))
+	})
+
+	t.Run("paginate matches", func(t *testing.T) {
+		db := newDatabase(t)
+		creator := uuid.V4Strategy{}.New()
+		now := time.Now().Truncate(time.Second)
+
+		// pairs of matches share a timestamp so the uuid has to break the tie
+		var want []models.Match
+		for i := range 5 {
+			match := newTestMatch()
+			match.CreatedByUser = creator
+			match.CreatedAt = now.Add(-time.Duration(i/2) * time.Minute)
+			require.NoError(t, db.InsertMatch(ctx, match))
+			want = append(want, match)
+		}
+		slices.SortFunc(want, func(a, b models.Match) int {
+			if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+				return c
+			}
+			return strings.Compare(b.UUID, a.UUID)
+		})
+
+		filter := database.MatchFilter{CreatedByUser: creator}
+		var got []string
+		request := database.PageRequest{Limit: 2}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 3, "pagination does not terminate")
+
+			page, err := db.ListMatches(ctx, filter, request)
+			require.NoError(t, err)
+			got = append(got, matchUUIDs(page.Items)...)
+
+			if page.NextCursor == "" {
+				break
+			}
+			request.Cursor = page.NextCursor
+		}
+		assert.Equal(t, matchUUIDs(want), got)
+
+		_, err := db.ListMatches(ctx, filter, database.PageRequest{
+			Cursor: "not a cursor",
+		})
+		assert.ErrorIs(t, err, database.ErrInvalid)
+	})
+
+	t.Run("list matches with open seats", func(t *testing.T) {
+		db := newDatabase(t)
+		creator := uuid.V4Strategy{}.New()
+
+		full, open := newTestMatch(), newTestMatch()
+		full.CreatedByUser = creator
+		open.CreatedByUser = creator
+		require.NoError(t, db.InsertMatch(ctx, full))
+		require.NoError(t, db.InsertMatch(ctx, open))
+
+		for range models.MAX_PLAYERS {
+			user := NewTestUser(t)
+			require.NoError(t, db.InsertUser(ctx, user))
+			require.NoError(t, db.AddPlayer(ctx, full.UUID, user.UUID))
+		}
+
+		page, err := db.ListMatches(ctx, database.MatchFilter{
+			CreatedByUser: creator,
+			OpenSeats:     true,
+		}, database.PageRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{open.UUID}, matchUUIDs(page.Items))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+		require.NoError(t, db.AddPlayer(ctx, match.UUID, user.UUID))
+
+		require.NoError(t, db.DeleteMatch(ctx, match.UUID))
+
+		_, err := db.GetMatch(ctx, match.UUID)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+
+		matches, err := db.MatchesForUser(ctx, user.UUID)
+		require.NoError(t, err)
+		assert.Empty(t, matches)
+
+		assert.ErrorIs(t, db.DeleteMatch(ctx, match.UUID), database.ErrNotFound)
+	})
+
+	t.Run("create and seat creator atomically", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, user))
+
+		match := newTestMatch()
+		match.CreatedByUser = user.UUID
+		err := db.WithTx(ctx, func(repos database.Repos) error {
+			if err := repos.InsertMatch(ctx, match); err != nil {
+				return err
+			}
+			// a second seat for the same user fails, the match must go too
+			if err := repos.AddPlayer(ctx, match.UUID, user.UUID); err != nil {
+				return err
+			}
+			return repos.AddPlayer(ctx, match.UUID, user.UUID)
+		})
+		assert.ErrorIs(t, err, database.ErrConflict)
+
+		_, err = db.GetMatch(ctx, match.UUID)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+}
+
+func matchUUIDs(matches []models.Match) []string {
+	uuids := make([]string, 0, len(matches))
+	for _, match := range matches {
+		uuids = append(uuids, match.UUID)
+	}
+
+	return uuids
+}
+
+// newTestEvent builds the event seq of a match, with a payload the same
+// way postgres returns jsonb
+func newTestEvent(matchUUID string, seq int64) models.MatchEvent {
+	return models.MatchEvent{
+		MatchUUID: matchUUID,
+		Seq:       seq,
+		ActorUUID: uuid.V4Strategy{}.New(),
+		Faction:   "Atreides",
+		Type:      "spice",
+		Payload:   json.RawMessage(`{"amount": 2}`),
+	}
+}
+
+func testEvents(t *testing.T, newDatabase Factory) {
+	ctx := context.Background()
+
+	t.Run("append and load", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		require.NoError(t, db.AppendEvents(ctx,
+			newTestEvent(match.UUID, 1), newTestEvent(match.UUID, 2)))
+		game := newTestEvent(match.UUID, 3)
+		game.ActorUUID, game.Faction, game.Payload = "", "", nil
+		require.NoError(t, db.AppendEvents(ctx, game))
+
+		events, err := db.LoadEvents(ctx, match.UUID, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		for i, event := range events {
+			assert.Equal(t, int64(i+1), event.Seq)
+			assert.Equal(t, match.UUID, event.MatchUUID)
+			assert.False(t, event.CreatedAt.IsZero())
+		}
+		assert.Equal(t, "Atreides", events[0].Faction)
+		assert.JSONEq(t, `{"amount": 2}`, string(events[0].Payload))
+		assert.Empty(t, events[2].ActorUUID)
+		assert.Empty(t, events[2].Faction)
+		assert.JSONEq(t, `{}`, string(events[2].Payload))
+
+		events, err = db.LoadEvents(ctx, match.UUID, 2)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, int64(3), events[0].Seq)
+	})
+
+	t.Run("duplicate seq", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+		require.NoError(t, db.AppendEvents(ctx, newTestEvent(match.UUID, 1)))
+
+		// the batch goes in whole or not at all
+		err := db.AppendEvents(ctx,
+			newTestEvent(match.UUID, 2), newTestEvent(match.UUID, 1))
+		assertConflict(t, err, "match_events_pkey")
+
+		events, err := db.LoadEvents(ctx, match.UUID, 0)
+		require.NoError(t, err)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("invalid events", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		assertInvalid(t, db.AppendEvents(ctx, newTestEvent(match.UUID, 0)),
+			"match_events_seq_positive")
+		assertInvalid(t, db.AppendEvents(ctx,
+			newTestEvent(uuid.V4Strategy{}.New(), 1)),
+			"match_events_match_uuid_fkey")
+	})
+
+	t.Run("snapshots", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		_, err := db.LatestSnapshot(ctx, match.UUID)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+
+		for _, seq := range []int64{50, 100} {
+			require.NoError(t, db.SaveSnapshot(ctx, models.MatchSnapshot{
+				MatchUUID: match.UUID,
+				Seq:       seq,
+				State:     json.RawMessage(`{"seq": ` + fmt.Sprint(seq) + `}`),
+			}))
+		}
+		// saving a seq again keeps the first snapshot
+		require.NoError(t, db.SaveSnapshot(ctx, models.MatchSnapshot{
+			MatchUUID: match.UUID,
+			Seq:       100,
+			State:     json.RawMessage(`{"seq": 0}`),
+		}))
+
+		snapshot, err := db.LatestSnapshot(ctx, match.UUID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), snapshot.Seq)
+		assert.JSONEq(t, `{"seq": 100}`, string(snapshot.State))
+
+		assertInvalid(t, db.SaveSnapshot(ctx, models.MatchSnapshot{
+			MatchUUID: match.UUID,
+			Seq:       150,
+		}), "state")
+	})
+
+	t.Run("deleted with their match", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+		require.NoError(t, db.AppendEvents(ctx, newTestEvent(match.UUID, 1)))
+		require.NoError(t, db.SaveSnapshot(ctx, models.MatchSnapshot{
+			MatchUUID: match.UUID,
+			Seq:       1,
+			State:     json.RawMessage(`{}`),
+		}))
+
+		require.NoError(t, db.DeleteMatch(ctx, match.UUID))
+
+		events, err := db.LoadEvents(ctx, match.UUID, 0)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+
+		_, err = db.LatestSnapshot(ctx, match.UUID)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("rolled back with the transaction", func(t *testing.T) {
+		db := newDatabase(t)
+		match := newTestMatch()
+		require.NoError(t, db.InsertMatch(ctx, match))
+
+		expected := errors.New("abort")
+		err := db.WithTx(ctx, func(repos database.Repos) error {
+			if err := repos.AppendEvents(
+				ctx, newTestEvent(match.UUID, 1)); err != nil {
+				return err
+			}
+			return expected
+		})
+		assert.ErrorIs(t, err, expected)
+
+		events, err := db.LoadEvents(ctx, match.UUID, 0)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+}
+
+// newTestContent builds a small content set with fresh keys, content
+// tables are shared by every test
+func newTestContent() models.GameContent {
+	suffix := "_" + strings.ReplaceAll(uuid.V4Strategy{}.New(), "-", "")
+
+	return models.GameContent{
+		Territories: []models.TerritoryDef{
+			{Key: "arrakeen" + suffix, Name: "Arrakeen",
+				Kind: models.STRONGHOLD_TERRITORY, Sectors: []int{9}},
+			{Key: "polar_sink" + suffix, Name: "Polar Sink",
+				Kind: models.POLAR_SINK_TERRITORY},
+		},
+		Factions: []models.FactionDef{
+			{Key: "atreides" + suffix, Name: "Atreides", StartingSpice: 10,
+				Reserves: 20, HomeTerritory: "arrakeen" + suffix,
+				StartingTroops: 10},
+			{Key: "emperor" + suffix, Name: "Emperor", StartingSpice: 10,
+				Reserves: 20},
+		},
+		Leaders: []models.LeaderDef{
+			{Key: "duncan_idaho" + suffix, Name: "Duncan Idaho",
+				Faction: "atreides" + suffix, Strength: 2},
+		},
+		TreacheryCards: []models.TreacheryCardDef{
+			{Key: "shield" + suffix, Name: "Shield", Kind: models.DEFENSE_CARD,
+				Subtype: "projectile", Copies: 4},
+			{Key: "karama" + suffix, Name: "Karama", Kind: models.SPECIAL_CARD,
+				Copies: 2, Description: "Cancels a faction advantage once."},
+		},
+		SpiceCards: []models.SpiceCardDef{
+			{Key: "arrakeen" + suffix, Name: "Arrakeen",
+				Territory: "arrakeen" + suffix, Sector: 9, Amount: 6, Copies: 1},
+			{Key: "shai_hulud" + suffix, Name: "Shai-Hulud", Worm: true,
+				Copies: 6},
+		},
+	}
+}
+
+// contentWithKeys keeps the entries of content whose key is in keysOf, so a
+// test only looks at the rows it wrote
+func contentWithKeys(
+	content models.GameContent,
+	keysOf models.GameContent,
+) models.GameContent {
+	keep := func(key string) bool {
+		for _, keys := range [][]string{
+			contentKeys(keysOf.Territories, func(d models.TerritoryDef) string {
+				return d.Key
+			}),
+			contentKeys(keysOf.Factions, func(d models.FactionDef) string {
+				return d.Key
+			}),
+			contentKeys(keysOf.Leaders, func(d models.LeaderDef) string {
+				return d.Key
+			}),
+			contentKeys(keysOf.TreacheryCards,
+				func(d models.TreacheryCardDef) string { return d.Key }),
+			contentKeys(keysOf.SpiceCards, func(d models.SpiceCardDef) string {
+				return d.Key
+			}),
+		} {
+			if slices.Contains(keys, key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return models.GameContent{
+		Territories: slices.DeleteFunc(content.Territories,
+			func(d models.TerritoryDef) bool { return !keep(d.Key) }),
+		Factions: slices.DeleteFunc(content.Factions,
+			func(d models.FactionDef) bool { return !keep(d.Key) }),
+		Leaders: slices.DeleteFunc(content.Leaders,
+			func(d models.LeaderDef) bool { return !keep(d.Key) }),
+		TreacheryCards: slices.DeleteFunc(content.TreacheryCards,
+			func(d models.TreacheryCardDef) bool { return !keep(d.Key) }),
+		SpiceCards: slices.DeleteFunc(content.SpiceCards,
+			func(d models.SpiceCardDef) bool { return !keep(d.Key) }),
+	}
+}
+
+func contentKeys[T any](entries []T, key func(T) string) []string {
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		keys = append(keys, key(entry))
+	}
+
+	return keys
+}
+
+func testContent(t *testing.T, newDatabase Factory) {
+	ctx := context.Background()
+
+	t.Run("upsert is idempotent", func(t *testing.T) {
+		db := newDatabase(t)
+		content := newTestContent()
+
+		written, err := db.UpsertContent(ctx, content)
+		require.NoError(t, err)
+		assert.Equal(t, 9, written)
+
+		written, err = db.UpsertContent(ctx, content)
+		require.NoError(t, err)
+		assert.Equal(t, 0, written)
+
+		content.Leaders[0].Strength = 3
+		written, err = db.UpsertContent(ctx, content)
+		require.NoError(t, err)
+		assert.Equal(t, 1, written)
+
+		loaded, err := db.LoadContent(ctx)
+		require.NoError(t, err)
+		got := contentWithKeys(loaded, content)
+
+		// each kind comes back ordered by key
+		want := content
+		slices.SortFunc(want.Territories, func(a, b models.TerritoryDef) int {
+			return strings.Compare(a.Key, b.Key)
+		})
+		want.Territories[1].Sectors = []int{}
+		slices.SortFunc(want.Factions, func(a, b models.FactionDef) int {
+			return strings.Compare(a.Key, b.Key)
+		})
+		slices.SortFunc(want.TreacheryCards,
+			func(a, b models.TreacheryCardDef) int {
+				return strings.Compare(a.Key, b.Key)
+			})
+		slices.SortFunc(want.SpiceCards, func(a, b models.SpiceCardDef) int {
+			return strings.Compare(a.Key, b.Key)
+		})
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("missing references", func(t *testing.T) {
+		db := newDatabase(t)
+		content := newTestContent()
+		content.Leaders[0].Faction = "nobody"
+
+		err := db.WithTx(ctx, func(repos database.Repos) error {
+			_, err := repos.UpsertContent(ctx, content)
+			return err
+		})
+		assertInvalid(t, err, "leaders_faction_fkey")
+
+		loaded, err := db.LoadContent(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, contentWithKeys(loaded, content).Territories)
+	})
+}
+
+func testArchives(t *testing.T, newDatabase Factory) {
+	ctx := context.Background()
+
+	t.Run("insert and get", func(t *testing.T) {
+		db := newDatabase(t)
+		archive := models.MatchArchive{
+			MatchUUID:     uuid.V7Strategy{}.New(),
+			CreatedByUser: uuid.V4Strategy{}.New(),
+			CreatedAt:     time.Now().Add(-100 * 24 * time.Hour).UTC(),
+			ArchivedAt:    time.Now().UTC(),
+			Players: []models.ArchivedPlayer{
+				{UserUUID: uuid.V4Strategy{}.New(), Faction: "fremen"},
+			},
+			Winner:     "fremen",
+			EventCount: 12,
+			Events:     []byte{0x1f, 0x8b},
+		}
+		require.NoError(t, db.InsertMatchArchive(ctx, archive))
+
+		got, err := db.GetMatchArchive(ctx, archive.MatchUUID)
+		require.NoError(t, err)
+		assert.Equal(t, archive.CreatedByUser, got.CreatedByUser)
+		assert.True(t, archive.CreatedAt.Truncate(time.Microsecond).
+			Equal(got.CreatedAt))
+		assert.Equal(t, archive.Players, got.Players)
+		assert.Equal(t, archive.Winner, got.Winner)
+		assert.Equal(t, archive.EventCount, got.EventCount)
+		assert.Equal(t, archive.Events, got.Events)
+
+		assertConflict(t, db.InsertMatchArchive(ctx, archive),
+			"match_archives_pkey")
+	})
+
+	t.Run("archive not found", func(t *testing.T) {
+		db := newDatabase(t)
+
+		_, err := db.GetMatchArchive(ctx, uuid.V4Strategy{}.New())
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("list matches created before", func(t *testing.T) {
+		db := newDatabase(t)
+		creator := uuid.V4Strategy{}.New()
+		now := time.Now()
+
+		old, recent := newTestMatch(), newTestMatch()
+		old.CreatedByUser, recent.CreatedByUser = creator, creator
+		old.CreatedAt = now.Add(-48 * time.Hour)
+		recent.CreatedAt = now
+		require.NoError(t, db.InsertMatch(ctx, old))
+		require.NoError(t, db.InsertMatch(ctx, recent))
+
+		page, err := db.ListMatches(ctx, database.MatchFilter{
+			CreatedByUser: creator,
+			CreatedBefore: now.Add(-24 * time.Hour),
+		}, database.PageRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{old.UUID}, matchUUIDs(page.Items))
+	})
+
+	t.Run("list matches finished before", func(t *testing.T) {
+		db := newDatabase(t)
+		creator := uuid.V4Strategy{}.New()
+		now := time.Now()
+
+		// created long ago but finished recently, kept
+		finishing := newTestMatch()
+		finishing.CreatedByUser = creator
+		finishing.CreatedAt = now.Add(-48 * time.Hour)
+		require.NoError(t, db.InsertMatch(ctx, finishing))
+		version, err := db.UpdateMatchState(
+			ctx, finishing.UUID, 1, models.InGame)
+		require.NoError(t, err)
+		_, err = db.UpdateMatchState(
+			ctx, finishing.UUID, version, models.Finish)
+		require.NoError(t, err)
+
+		got, err := db.GetMatch(ctx, finishing.UUID)
+		require.NoError(t, err)
+		assert.WithinDuration(t, now, got.FinishedAt, time.Minute)
+
+		finished := newTestMatch()
+		finished.CreatedByUser = creator
+		finished.MatchState = models.Finish
+		finished.FinishedAt = now.Add(-48 * time.Hour)
+		require.NoError(t, db.InsertMatch(ctx, finished))
+
+		playing := newTestMatch()
+		playing.CreatedByUser = creator
+		playing.MatchState = models.InGame
+		require.NoError(t, db.InsertMatch(ctx, playing))
+
+		page, err := db.ListMatches(ctx, database.MatchFilter{
+			CreatedByUser:  creator,
+			FinishedBefore: now.Add(-24 * time.Hour),
+		}, database.PageRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{finished.UUID}, matchUUIDs(page.Items))
+	})
+}
+
+func testTransactions(t *testing.T, newDatabase Factory) {
+	ctx := context.Background()
+
+	t.Run("commit", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+
+		err := db.WithTx(ctx, func(repos database.Repos) error {
+			if err := repos.InsertUser(ctx, user); err != nil {
+				return err
+			}
+
+			// writes are visible inside the transaction
+			_, err := repos.GetUserByUsername(
+				ctx, user.Username.String(), testHash)
+			return err
+		})
+		require.NoError(t, err)
+
+		_, err = db.GetUserByUsername(ctx, user.Username.String(), testHash)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rollback on error", func(t *testing.T) {
+		db := newDatabase(t)
+		user := NewTestUser(t)
+		expected := errors.New("abort")
+
+		err := db.WithTx(ctx, func(repos database.Repos) error {
+			if err := repos.InsertUser(ctx, user); err != nil {
+				return err
+			}
+			return expected
+		})
+		assert.ErrorIs(t, err, expected)
+
+		_, err = db.GetUserByUsername(ctx, user.Username.String(), testHash)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("rollback on constraint violation", func(t *testing.T) {
+		db := newDatabase(t)
+		existing := NewTestUser(t)
+		require.NoError(t, db.InsertUser(ctx, existing))
+
+		user := NewTestUser(t)
+		err := db.WithTx(ctx, func(repos database.Repos) error {
+			if err := repos.InsertUser(ctx, user); err != nil {
+				return err
+			}
+
+			duplicated := models.NewUser(existing.UUID,
+				NewTestUser(t).Username, NewTestUser(t).Email, user.Password())
+			return repos.InsertUser(ctx, duplicated)
+		})
+		assert.ErrorIs(t, err, database.ErrConflict)
+
+		_, err = db.GetUserByUsername(ctx, user.Username.String(), testHash)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+	})
+}
+
+func testCancelledContext(t *testing.T, newDatabase Factory) {
+	db := newDatabase(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, db.InsertUser(ctx, NewTestUser(t)), context.Canceled)
+
+	_, err := db.GetUserByUsername(ctx, "anyone", testHash)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.ErrorIs(t, db.Ping(ctx), context.Canceled)
+}
+
+func assertInvalid(t *testing.T, err error, constraint string) {
+	t.Helper()
+
+	assert.ErrorIs(t, err, database.ErrInvalid)
+
+	var invalid *database.InvalidError
+	if assert.ErrorAs(t, err, &invalid) {
+		assert.Equal(t, constraint, invalid.Constraint)
+	}
+}
+
+func assertConflict(t *testing.T, err error, constraint string) {
+	t.Helper()
+
+	assert.ErrorIs(t, err, database.ErrConflict)
+
+	var conflict *database.ConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		assert.Equal(t, constraint, conflict.Constraint)
+	}
+}
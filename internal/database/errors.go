@@ -0,0 +1,77 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Implementations translate their native errors into these so callers can
+// tell a missing row from a constraint violation with errors.Is / errors.As
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned, as a *ConflictError, when a write collides
+	// with a unique constraint
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid is returned, as an *InvalidError, when a write breaks a
+	// check, not null or foreign key constraint
+	ErrInvalid = errors.New("invalid data")
+	// ErrSerialization means the transaction lost a race with a concurrent
+	// one (serialization failure or deadlock) and is safe to retry
+	ErrSerialization = errors.New("serialization failure")
+	// ErrUnavailable means the database could not be reached or refused
+	// the connection, the request may succeed later
+	ErrUnavailable = errors.New("database unavailable")
+	// ErrStale is returned, as a *StaleError, when a compare and swap
+	// update finds the row changed since it was read. It also matches
+	// ErrConflict
+	ErrStale = errors.New("stale write")
+)
+
+type ConflictError struct {
+	Constraint string
+	Err        error
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflict on constraint %q", e.Constraint)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+type InvalidError struct {
+	Constraint string
+	Err        error
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("invalid data, violates constraint %q", e.Constraint)
+}
+
+func (e *InvalidError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+func (e *InvalidError) Unwrap() error {
+	return e.Err
+}
+
+type StaleError struct {
+	Entity   string
+	Expected int64
+	Actual   int64
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("stale %s: expected version %d, found %d",
+		e.Entity, e.Expected, e.Actual)
+}
+
+func (e *StaleError) Is(target error) bool {
+	return target == ErrStale || target == ErrConflict
+}
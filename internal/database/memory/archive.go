@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/models"
+	"fmt"
+	"slices"
+	"time"
+)
+
+func (m *MemoryDatabase) InsertMatchArchive(
+	ctx context.Context,
+	archive models.MatchArchive,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// postgres reports not null violations by column
+	if archive.Events == nil {
+		return checkViolation("events")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.archives[archive.MatchUUID]; exists {
+		return uniqueViolation("match_archives_pkey")
+	}
+
+	if archive.ArchivedAt.IsZero() {
+		archive.ArchivedAt = time.Now()
+	}
+	archive.CreatedAt = archive.CreatedAt.Truncate(time.Microsecond)
+	archive.ArchivedAt = archive.ArchivedAt.Truncate(time.Microsecond)
+
+	m.archives[archive.MatchUUID] = cloneArchive(archive)
+	return nil
+}
+
+func (m *MemoryDatabase) GetMatchArchive(
+	ctx context.Context,
+	matchUUID string,
+) (models.MatchArchive, error) {
+	if err := ctx.Err(); err != nil {
+		return models.MatchArchive{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	archive, ok := m.archives[matchUUID]
+	if !ok {
+		return models.MatchArchive{}, fmt.Errorf(
+			"match archive %w", database.ErrNotFound)
+	}
+
+	return cloneArchive(archive), nil
+}
+
+func cloneArchive(archive models.MatchArchive) models.MatchArchive {
+	archive.Players = slices.Clone(archive.Players)
+	if archive.Players == nil {
+		archive.Players = []models.ArchivedPlayer{}
+	}
+	archive.Events = slices.Clone(archive.Events)
+
+	return archive
+}
@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"context"
+	"duna/internal/models"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// contentStore mirrors the static game content tables, keyed by key
+type contentStore struct {
+	territories    map[string]models.TerritoryDef
+	factions       map[string]models.FactionDef
+	leaders        map[string]models.LeaderDef
+	treacheryCards map[string]models.TreacheryCardDef
+	spiceCards     map[string]models.SpiceCardDef
+}
+
+func newContentStore() contentStore {
+	return contentStore{
+		territories:    map[string]models.TerritoryDef{},
+		factions:       map[string]models.FactionDef{},
+		leaders:        map[string]models.LeaderDef{},
+		treacheryCards: map[string]models.TreacheryCardDef{},
+		spiceCards:     map[string]models.SpiceCardDef{},
+	}
+}
+
+func (c contentStore) clone() contentStore {
+	return contentStore{
+		territories:    maps.Clone(c.territories),
+		factions:       maps.Clone(c.factions),
+		leaders:        maps.Clone(c.leaders),
+		treacheryCards: maps.Clone(c.treacheryCards),
+		spiceCards:     maps.Clone(c.spiceCards),
+	}
+}
+
+func (m *MemoryDatabase) UpsertContent(
+	ctx context.Context,
+	content models.GameContent,
+) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// postgres runs one statement per kind, work on a copy so a violation
+	// leaves nothing behind
+	store := m.content.clone()
+	written := 0
+
+	for _, territory := range content.Territories {
+		// sectors is a not null jsonb array
+		territory.Sectors = append([]int{}, territory.Sectors...)
+		written += upsert(store.territories, territory.Key, territory)
+	}
+
+	for _, faction := range content.Factions {
+		if _, ok := store.territories[faction.HomeTerritory]; !ok &&
+			faction.HomeTerritory != "" {
+			return 0, checkViolation("factions_home_territory_fkey")
+		}
+		written += upsert(store.factions, faction.Key, faction)
+	}
+
+	for _, leader := range content.Leaders {
+		if _, ok := store.factions[leader.Faction]; !ok {
+			return 0, checkViolation("leaders_faction_fkey")
+		}
+		written += upsert(store.leaders, leader.Key, leader)
+	}
+
+	for _, card := range content.TreacheryCards {
+		written += upsert(store.treacheryCards, card.Key, card)
+	}
+
+	for _, card := range content.SpiceCards {
+		if _, ok := store.territories[card.Territory]; !ok &&
+			card.Territory != "" {
+			return 0, checkViolation("spice_cards_territory_fkey")
+		}
+		written += upsert(store.spiceCards, card.Key, card)
+	}
+
+	m.content = store
+	return written, nil
+}
+
+// upsert stores value under key unless it is already there unchanged, it
+// returns the number of rows written like ON CONFLICT DO UPDATE WHERE
+func upsert[T any](rows map[string]T, key string, value T) int {
+	if current, ok := rows[key]; ok && reflect.DeepEqual(current, value) {
+		return 0
+	}
+
+	rows[key] = value
+	return 1
+}
+
+func (m *MemoryDatabase) LoadContent(
+	ctx context.Context,
+) (models.GameContent, error) {
+	if err := ctx.Err(); err != nil {
+		return models.GameContent{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	content := models.GameContent{
+		Territories:    sortedByKey(m.content.territories),
+		Factions:       sortedByKey(m.content.factions),
+		Leaders:        sortedByKey(m.content.leaders),
+		TreacheryCards: sortedByKey(m.content.treacheryCards),
+		SpiceCards:     sortedByKey(m.content.spiceCards),
+	}
+	for i := range content.Territories {
+		content.Territories[i].Sectors = slices.Clone(
+			content.Territories[i].Sectors)
+	}
+
+	return content, nil
+}
+
+func sortedByKey[T any](rows map[string]T) []T {
+	keys := slices.Sorted(maps.Keys(rows))
+
+	values := make([]T, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, rows[key])
+	}
+
+	return values
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/models"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// MemoryDatabase keeps everything in process memory, it is meant for
+// development and tests and behaves like the postgres implementation:
+// the same uniqueness rules and the same not found errors
+type MemoryDatabase struct {
+	mu      sync.RWMutex
+	users   map[string]userRecord
+	matches map[string]matchRecord
+	seats   []seatRecord
+
+	events    []models.MatchEvent
+	snapshots []models.MatchSnapshot
+
+	content  contentStore
+	archives map[string]models.MatchArchive
+	// sessions are keyed by token hash
+	sessions map[string]models.Session
+}
+
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{
+		users:    map[string]userRecord{},
+		matches:  map[string]matchRecord{},
+		content:  newContentStore(),
+		archives: map[string]models.MatchArchive{},
+		sessions: map[string]models.Session{},
+	}
+}
+
+// Migrate has nothing to do, the schema lives in the Go types
+func (m *MemoryDatabase) Migrate(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Ping always succeeds, there is nothing to reach
+func (m *MemoryDatabase) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// WithTx hands fn a copy of the data and swaps it in when fn succeeds. The
+// write lock is held meanwhile so transactions are trivially serializable,
+// they never fail with database.ErrSerialization
+func (m *MemoryDatabase) WithTx(
+	ctx context.Context,
+	fn func(repos database.Repos) error,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &MemoryDatabase{
+		users:   maps.Clone(m.users),
+		matches: maps.Clone(m.matches),
+		seats:   slices.Clone(m.seats),
+
+		events:    slices.Clone(m.events),
+		snapshots: slices.Clone(m.snapshots),
+
+		content:  m.content.clone(),
+		archives: maps.Clone(m.archives),
+		sessions: maps.Clone(m.sessions),
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	m.users = tx.users
+	m.matches = tx.matches
+	m.seats = tx.seats
+	m.events = tx.events
+	m.snapshots = tx.snapshots
+	m.content = tx.content
+	m.archives = tx.archives
+	m.sessions = tx.sessions
+	return nil
+}
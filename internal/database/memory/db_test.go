@@ -0,0 +1,14 @@
+package memory_test
+
+import (
+	"duna/internal/database"
+	"duna/internal/database/databasetest"
+	"duna/internal/database/memory"
+	"testing"
+)
+
+func TestMemoryDatabaseContract(t *testing.T) {
+	databasetest.RunContractTests(t, func(t *testing.T) database.Database {
+		return memory.NewMemoryDatabase()
+	})
+}
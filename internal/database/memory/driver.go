@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"context"
+	"duna/internal/config"
+	"duna/internal/database"
+)
+
+var _ database.Database = (*MemoryDatabase)(nil)
+
+func init() {
+	database.Register(database.MEMORY_DRIVER, func(
+		ctx context.Context,
+		cfg config.DatabaseConfig,
+	) (database.Database, error) {
+		return NewMemoryDatabase(), nil
+	})
+}
@@ -0,0 +1,14 @@
+package memory
+
+import "duna/internal/database"
+
+// constraint names match the ones postgres reports so callers can't tell
+// both implementations apart
+
+func uniqueViolation(constraint string) error {
+	return &database.ConflictError{Constraint: constraint}
+}
+
+func checkViolation(constraint string) error {
+	return &database.InvalidError{Constraint: constraint}
+}
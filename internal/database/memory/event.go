@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/models"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+func (m *MemoryDatabase) AppendEvents(
+	ctx context.Context,
+	events ...models.MatchEvent,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// check the whole batch first, postgres inserts it in one statement
+	now := time.Now().Truncate(time.Microsecond)
+	appended := make([]models.MatchEvent, 0, len(events))
+	for _, event := range events {
+		if event.Seq <= 0 {
+			return checkViolation("match_events_seq_positive")
+		}
+		if _, ok := m.matches[event.MatchUUID]; !ok {
+			return checkViolation("match_events_match_uuid_fkey")
+		}
+
+		taken := func(other models.MatchEvent) bool {
+			return other.MatchUUID == event.MatchUUID && other.Seq == event.Seq
+		}
+		if slices.ContainsFunc(m.events, taken) ||
+			slices.ContainsFunc(appended, taken) {
+			return uniqueViolation("match_events_pkey")
+		}
+
+		event.Payload = cloneJSON(event.Payload, "{}")
+		event.CreatedAt = now
+		appended = append(appended, event)
+	}
+
+	m.events = append(m.events, appended...)
+	return nil
+}
+
+func (m *MemoryDatabase) LoadEvents(
+	ctx context.Context,
+	matchUUID string,
+	afterSeq int64,
+) ([]models.MatchEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var events []models.MatchEvent
+	for _, event := range m.events {
+		if event.MatchUUID == matchUUID && event.Seq > afterSeq {
+			event.Payload = cloneJSON(event.Payload, "{}")
+			events = append(events, event)
+		}
+	}
+
+	slices.SortFunc(events, func(a, b models.MatchEvent) int {
+		return int(a.Seq - b.Seq)
+	})
+	return events, nil
+}
+
+func (m *MemoryDatabase) SaveSnapshot(
+	ctx context.Context,
+	snapshot models.MatchSnapshot,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// postgres reports not null violations by column
+	if len(snapshot.State) == 0 {
+		return checkViolation("state")
+	}
+	if _, ok := m.matches[snapshot.MatchUUID]; !ok {
+		return checkViolation("match_snapshots_match_uuid_fkey")
+	}
+
+	for _, other := range m.snapshots {
+		// ON CONFLICT DO NOTHING
+		if other.MatchUUID == snapshot.MatchUUID && other.Seq == snapshot.Seq {
+			return nil
+		}
+	}
+
+	snapshot.State = cloneJSON(snapshot.State, "")
+	snapshot.CreatedAt = time.Now().Truncate(time.Microsecond)
+	m.snapshots = append(m.snapshots, snapshot)
+	return nil
+}
+
+func (m *MemoryDatabase) LatestSnapshot(
+	ctx context.Context,
+	matchUUID string,
+) (models.MatchSnapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return models.MatchSnapshot{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var latest models.MatchSnapshot
+	found := false
+	for _, snapshot := range m.snapshots {
+		if snapshot.MatchUUID == matchUUID &&
+			(!found || snapshot.Seq > latest.Seq) {
+			latest = snapshot
+			found = true
+		}
+	}
+
+	if !found {
+		return models.MatchSnapshot{}, fmt.Errorf(
+			"snapshot %w", database.ErrNotFound)
+	}
+
+	latest.State = cloneJSON(latest.State, "")
+	return latest, nil
+}
+
+// cloneJSON copies a document so callers can't alter what is stored,
+// fallback replaces an empty one like a column default
+func cloneJSON(document json.RawMessage, fallback string) json.RawMessage {
+	if len(document) == 0 {
+		if fallback == "" {
+			return nil
+		}
+		return json.RawMessage(fallback)
+	}
+
+	return slices.Clone(document)
+}
@@ -0,0 +1,356 @@
+package memory
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/models"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// matchRecord mirrors a row of the matches table
+type matchRecord struct {
+	uuid          string
+	matchState    models.MatchState
+	createdByUser string
+	createdAt     time.Time
+	finishedAt    time.Time
+	version       int64
+}
+
+// seatRecord mirrors a row of the users_matches table
+type seatRecord struct {
+	matchUUID string
+	userUUID  string
+	joinedAt  time.Time
+}
+
+func (m *MemoryDatabase) InsertMatch(
+	ctx context.Context,
+	match models.Match,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !match.MatchState.Valid() {
+		return checkViolation("match_state_valid")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.matches[match.UUID]; exists {
+		return uniqueViolation("matches_pkey")
+	}
+
+	createdAt := match.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	m.matches[match.UUID] = matchRecord{
+		uuid:          match.UUID,
+		matchState:    match.MatchState,
+		createdByUser: match.CreatedByUser,
+		// postgres keeps microseconds
+		createdAt:  createdAt.Truncate(time.Microsecond),
+		finishedAt: match.FinishedAt.Truncate(time.Microsecond),
+		version:    1,
+	}
+
+	return nil
+}
+
+func (m *MemoryDatabase) GetMatch(
+	ctx context.Context,
+	uuid string,
+) (models.Match, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Match{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, ok := m.matches[uuid]
+	if !ok {
+		return models.Match{}, fmt.Errorf("match %w", database.ErrNotFound)
+	}
+
+	return m.toMatch(record), nil
+}
+
+func (m *MemoryDatabase) ListMatches(
+	ctx context.Context,
+	filter database.MatchFilter,
+	page database.PageRequest,
+) (database.Page[models.Match], error) {
+	if err := ctx.Err(); err != nil {
+		return database.Page[models.Match]{}, err
+	}
+
+	var cursor database.MatchCursor
+	hasCursor, err := database.DecodeCursor(page.Cursor, &cursor)
+	if err != nil {
+		return database.Page[models.Match]{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := m.filterMatches(filter)
+	if hasCursor {
+		matches = slices.DeleteFunc(matches, func(match models.Match) bool {
+			return compareMatches(match, models.Match{
+				CreatedAt: cursor.CreatedAt,
+				UUID:      cursor.UUID,
+			}) <= 0
+		})
+	}
+
+	limit := page.PageLimit()
+	if len(matches) <= limit {
+		return database.Page[models.Match]{Items: matches}, nil
+	}
+
+	last := matches[limit-1]
+	return database.Page[models.Match]{
+		Items: matches[:limit],
+		NextCursor: database.EncodeCursor(database.MatchCursor{
+			CreatedAt: last.CreatedAt,
+			UUID:      last.UUID,
+		}),
+	}, nil
+}
+
+func (m *MemoryDatabase) MatchesForUser(
+	ctx context.Context,
+	userUUID string,
+) ([]models.Match, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterMatches(database.MatchFilter{Player: userUUID}), nil
+}
+
+// filterMatches must be called with the lock held, matches are returned in
+// listing order
+func (m *MemoryDatabase) filterMatches(
+	filter database.MatchFilter,
+) []models.Match {
+	var matches []models.Match
+	for _, record := range m.matches {
+		if filter.State != nil && record.matchState != *filter.State {
+			continue
+		}
+		if filter.CreatedByUser != "" &&
+			record.createdByUser != filter.CreatedByUser {
+			continue
+		}
+		if !filter.CreatedAfter.IsZero() &&
+			!record.createdAt.After(filter.CreatedAfter) {
+			continue
+		}
+		if !filter.CreatedBefore.IsZero() &&
+			!record.createdAt.Before(filter.CreatedBefore) {
+			continue
+		}
+
+		if !filter.FinishedBefore.IsZero() && (record.finishedAt.IsZero() ||
+			!record.finishedAt.Before(filter.FinishedBefore)) {
+			continue
+		}
+
+		match := m.toMatch(record)
+		if filter.Player != "" && !match.HasPlayer(filter.Player) {
+			continue
+		}
+		if filter.OpenSeats && len(match.Seats) >= models.MAX_PLAYERS {
+			continue
+		}
+
+		matches = append(matches, match)
+	}
+
+	slices.SortFunc(matches, compareMatches)
+	return matches
+}
+
+// compareMatches orders newest first by (created_at, uuid) like postgres
+func compareMatches(a, b models.Match) int {
+	if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+		return c
+	}
+
+	return strings.Compare(b.UUID, a.UUID)
+}
+
+func (m *MemoryDatabase) UpdateMatchState(
+	ctx context.Context,
+	uuid string,
+	version int64,
+	state models.MatchState,
+) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.matches[uuid]
+	if !ok {
+		return 0, fmt.Errorf("match %w", database.ErrNotFound)
+	}
+
+	if record.version != version {
+		return 0, &database.StaleError{
+			Entity:   "match",
+			Expected: version,
+			Actual:   record.version,
+		}
+	}
+
+	if !state.Valid() {
+		return 0, checkViolation("match_state_valid")
+	}
+
+	record.matchState = state
+	if state == models.Finish {
+		record.finishedAt = time.Now().Truncate(time.Microsecond)
+	}
+	record.version++
+	m.matches[uuid] = record
+	return record.version, nil
+}
+
+func (m *MemoryDatabase) DeleteMatch(ctx context.Context, uuid string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.matches[uuid]; !ok {
+		return fmt.Errorf("match %w", database.ErrNotFound)
+	}
+
+	delete(m.matches, uuid)
+	// ON DELETE CASCADE
+	m.seats = slices.DeleteFunc(m.seats, func(seat seatRecord) bool {
+		return seat.matchUUID == uuid
+	})
+	m.events = slices.DeleteFunc(m.events, func(event models.MatchEvent) bool {
+		return event.MatchUUID == uuid
+	})
+	m.snapshots = slices.DeleteFunc(m.snapshots,
+		func(snapshot models.MatchSnapshot) bool {
+			return snapshot.MatchUUID == uuid
+		})
+
+	return nil
+}
+
+func (m *MemoryDatabase) AddPlayer(
+	ctx context.Context,
+	matchUUID, userUUID string,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.matches[matchUUID]; !ok {
+		return checkViolation("users_matches_match_uuid_fkey")
+	}
+	if _, ok := m.users[userUUID]; !ok {
+		return checkViolation("users_matches_user_uuid_fkey")
+	}
+
+	for _, seat := range m.seats {
+		if seat.matchUUID == matchUUID && seat.userUUID == userUUID {
+			return uniqueViolation("users_matches_pkey")
+		}
+	}
+
+	m.seats = append(m.seats, seatRecord{
+		matchUUID: matchUUID,
+		userUUID:  userUUID,
+		joinedAt:  time.Now(),
+	})
+
+	return nil
+}
+
+func (m *MemoryDatabase) RemovePlayer(
+	ctx context.Context,
+	matchUUID, userUUID string,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, seat := range m.seats {
+		if seat.matchUUID == matchUUID && seat.userUUID == userUUID {
+			m.seats = slices.Delete(m.seats, i, i+1)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("player %w", database.ErrNotFound)
+}
+
+func (m *MemoryDatabase) PlayersInMatch(
+	ctx context.Context,
+	matchUUID string,
+) ([]models.Seat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.seatsOf(matchUUID), nil
+}
+
+// toMatch must be called with the lock held
+func (m *MemoryDatabase) toMatch(record matchRecord) models.Match {
+	match := models.NewMatch(record.uuid, record.matchState)
+	match.CreatedByUser = record.createdByUser
+	match.CreatedAt = record.createdAt
+	match.FinishedAt = record.finishedAt
+	match.Version = record.version
+	match.Seats = m.seatsOf(record.uuid)
+
+	return match
+}
+
+// seatsOf must be called with the lock held, seats are kept in the order
+// players joined
+func (m *MemoryDatabase) seatsOf(matchUUID string) []models.Seat {
+	var seats []models.Seat
+	for _, seat := range m.seats {
+		if seat.matchUUID == matchUUID {
+			seats = append(seats, models.Seat{
+				UserUUID: seat.userUUID,
+				JoinedAt: seat.joinedAt,
+			})
+		}
+	}
+
+	return seats
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/models"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+func (m *MemoryDatabase) InsertSession(
+	ctx context.Context,
+	session models.Session,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[session.UserUUID]; !ok {
+		return checkViolation("sessions_user_uuid_fkey")
+	}
+	if _, exists := m.sessions[session.TokenHash]; exists {
+		return uniqueViolation("sessions_pkey")
+	}
+
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	session.CreatedAt = session.CreatedAt.Truncate(time.Microsecond)
+	session.ExpiresAt = session.ExpiresAt.Truncate(time.Microsecond)
+
+	m.sessions[session.TokenHash] = session
+	return nil
+}
+
+func (m *MemoryDatabase) GetSession(
+	ctx context.Context,
+	tokenHash string,
+) (models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Session{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[tokenHash]
+	if !ok {
+		return models.Session{}, fmt.Errorf("session %w", database.ErrNotFound)
+	}
+
+	return session, nil
+}
+
+func (m *MemoryDatabase) DeleteSession(
+	ctx context.Context,
+	tokenHash string,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[tokenHash]; !ok {
+		return fmt.Errorf("session %w", database.ErrNotFound)
+	}
+
+	delete(m.sessions, tokenHash)
+	return nil
+}
+
+func (m *MemoryDatabase) ListUserSessions(
+	ctx context.Context,
+	userUUID string,
+	now time.Time,
+) ([]models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []models.Session
+	for _, session := range m.sessions {
+		if session.UserUUID == userUUID && !session.Expired(now) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b models.Session) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (m *MemoryDatabase) DeleteUserSessions(
+	ctx context.Context,
+	userUUID string,
+) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := len(m.sessions)
+	maps.DeleteFunc(m.sessions, func(_ string, session models.Session) bool {
+		return session.UserUUID == userUUID
+	})
+
+	return deleted - len(m.sessions), nil
+}
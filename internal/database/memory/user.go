@@ -0,0 +1,241 @@
+package memory
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/hash"
+	"duna/internal/models"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// userRecord mirrors a row of the users table
+type userRecord struct {
+	uuid              string
+	username          string
+	usernameCanonical string
+	email             string
+	emailCanonical    string
+	password          string
+	role              models.Role
+	disabled          bool
+}
+
+func (m *MemoryDatabase) InsertUser(
+	ctx context.Context,
+	user models.User,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := userRecord{
+		uuid:              user.UUID,
+		username:          user.Username.String(),
+		usernameCanonical: user.Username.Canonical(),
+		email:             user.Email.String(),
+		emailCanonical:    user.Email.Canonical(),
+		password:          user.Password().Hashed(),
+		role:              user.Role,
+		disabled:          user.Disabled,
+	}
+	if record.role == "" {
+		// the column default
+		record.role = models.PLAYER_ROLE
+	}
+	if !record.role.Valid() {
+		return checkViolation("users_role_valid")
+	}
+
+	if _, exists := m.users[record.uuid]; exists {
+		return uniqueViolation("users_pkey")
+	}
+
+	for _, existing := range m.users {
+		if existing.usernameCanonical == record.usernameCanonical {
+			return uniqueViolation("users_username_canonical_key")
+		}
+		if existing.emailCanonical == record.emailCanonical {
+			return uniqueViolation("users_email_canonical_key")
+		}
+	}
+
+	m.users[record.uuid] = record
+	return nil
+}
+
+func (m *MemoryDatabase) GetUserByUsername(ctx context.Context,
+	username string, hash hash.HashStrategy) (models.User, error) {
+	canonical := models.CanonicalUsername(username)
+	return m.findUser(ctx, hash, func(record userRecord) bool {
+		return record.usernameCanonical == canonical
+	})
+}
+
+func (m *MemoryDatabase) GetUserByEmail(ctx context.Context,
+	email string, hash hash.HashStrategy) (models.User, error) {
+	canonical := models.CanonicalEmail(email)
+	return m.findUser(ctx, hash, func(record userRecord) bool {
+		return record.emailCanonical == canonical
+	})
+}
+
+func (m *MemoryDatabase) GetUserByUUID(ctx context.Context,
+	uuid string, hash hash.HashStrategy) (models.User, error) {
+	return m.findUser(ctx, hash, func(record userRecord) bool {
+		return record.uuid == uuid
+	})
+}
+
+func (m *MemoryDatabase) findUser(ctx context.Context, hash hash.HashStrategy,
+	match func(record userRecord) bool) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, record := range m.users {
+		if match(record) {
+			return record.toUser(hash)
+		}
+	}
+
+	return models.User{}, fmt.Errorf("user %w", database.ErrNotFound)
+}
+
+func (r userRecord) toUser(hash hash.HashStrategy) (models.User, error) {
+	user, err := models.NewUserFromPrimitives(
+		r.uuid, r.username, r.email, r.password, true, hash)
+	if err != nil {
+		return models.User{}, fmt.Errorf("invalid data in database: %w", err)
+	}
+	user.Role = r.role
+	user.Disabled = r.disabled
+
+	return user, nil
+}
+
+func (m *MemoryDatabase) ListUsers(
+	ctx context.Context,
+	filter database.UserFilter,
+	page database.PageRequest,
+	hash hash.HashStrategy,
+) (database.Page[models.User], error) {
+	if err := ctx.Err(); err != nil {
+		return database.Page[models.User]{}, err
+	}
+
+	var cursor database.UserCursor
+	hasCursor, err := database.DecodeCursor(page.Cursor, &cursor)
+	if err != nil {
+		return database.Page[models.User]{}, err
+	}
+
+	prefix := models.CanonicalUsername(filter.UsernamePrefix)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var records []userRecord
+	for _, record := range m.users {
+		if !strings.HasPrefix(record.usernameCanonical, prefix) {
+			continue
+		}
+		if hasCursor && record.usernameCanonical <= cursor.UsernameCanonical {
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	slices.SortFunc(records, func(a, b userRecord) int {
+		return strings.Compare(a.usernameCanonical, b.usernameCanonical)
+	})
+
+	var result database.Page[models.User]
+	limit := page.PageLimit()
+	if len(records) > limit {
+		records = records[:limit]
+		result.NextCursor = database.EncodeCursor(database.UserCursor{
+			UsernameCanonical: records[limit-1].usernameCanonical,
+		})
+	}
+
+	for _, record := range records {
+		user, err := record.toUser(hash)
+		if err != nil {
+			return database.Page[models.User]{}, err
+		}
+
+		result.Items = append(result.Items, user)
+	}
+
+	return result, nil
+}
+
+func (m *MemoryDatabase) UpdateUserPassword(
+	ctx context.Context,
+	uuid string,
+	password models.Password,
+) error {
+	return m.updateUser(ctx, uuid, func(record *userRecord) error {
+		record.password = password.Hashed()
+		return nil
+	})
+}
+
+func (m *MemoryDatabase) SetUserDisabled(
+	ctx context.Context,
+	uuid string,
+	disabled bool,
+) error {
+	return m.updateUser(ctx, uuid, func(record *userRecord) error {
+		record.disabled = disabled
+		return nil
+	})
+}
+
+func (m *MemoryDatabase) SetUserRole(
+	ctx context.Context,
+	uuid string,
+	role models.Role,
+) error {
+	return m.updateUser(ctx, uuid, func(record *userRecord) error {
+		if !role.Valid() {
+			return checkViolation("users_role_valid")
+		}
+		record.role = role
+		return nil
+	})
+}
+
+func (m *MemoryDatabase) updateUser(
+	ctx context.Context,
+	uuid string,
+	update func(record *userRecord) error,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.users[uuid]
+	if !ok {
+		return fmt.Errorf("user %w", database.ErrNotFound)
+	}
+
+	if err := update(&record); err != nil {
+		return err
+	}
+
+	m.users[uuid] = record
+	return nil
+}
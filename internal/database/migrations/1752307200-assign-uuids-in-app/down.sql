@@ -0,0 +1,2 @@
+ALTER TABLE users ALTER COLUMN uuid SET DEFAULT gen_random_uuid();
+ALTER TABLE matches ALTER COLUMN uuid SET DEFAULT gen_random_uuid();
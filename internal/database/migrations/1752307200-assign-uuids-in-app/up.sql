@@ -0,0 +1,2 @@
+ALTER TABLE users ALTER COLUMN uuid DROP DEFAULT;
+ALTER TABLE matches ALTER COLUMN uuid DROP DEFAULT;
@@ -0,0 +1,3 @@
+DROP INDEX users_username_canonical_key;
+
+ALTER TABLE users DROP COLUMN username_canonical;
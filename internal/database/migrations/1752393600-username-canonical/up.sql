@@ -0,0 +1,32 @@
+ALTER TABLE users ADD COLUMN username_canonical VARCHAR(255);
+
+-- only close to models.CanonicalUsername, 1753257600-recanonicalize-users
+-- recomputes it in Go
+UPDATE users SET username_canonical = lower(username);
+
+ALTER TABLE users ALTER COLUMN username_canonical SET NOT NULL;
+
+-- usernames were not unique before, users that only differ by case have to
+-- be renamed by hand before the index can be built
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(users, '; ') INTO duplicates FROM (
+        SELECT string_agg(format('%s (%s)', username, uuid), ', '
+            ORDER BY username) AS users
+        FROM users
+        GROUP BY username_canonical
+        HAVING count(*) > 1
+    ) AS collisions;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'usernames differing only by case: %', duplicates
+            USING HINT = 'rename all but one user of each group, e.g. '
+                'UPDATE users SET username = ''<new name>'' WHERE uuid = '
+                '''<uuid>'', then run the migrations again';
+    END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX users_username_canonical_key ON users (username_canonical);
@@ -0,0 +1,3 @@
+DROP INDEX users_email_canonical_key;
+
+ALTER TABLE users DROP COLUMN email_canonical;
@@ -0,0 +1,33 @@
+ALTER TABLE users ADD COLUMN email_canonical VARCHAR(255);
+
+-- only close to models.CanonicalEmail, 1753257600-recanonicalize-users
+-- recomputes it in Go
+UPDATE users SET email_canonical = lower(email);
+
+ALTER TABLE users ALTER COLUMN email_canonical SET NOT NULL;
+
+-- emails were only unique as typed, users whose emails only differ by case
+-- have to be merged or given another email by hand before the index can be
+-- built
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(users, '; ') INTO duplicates FROM (
+        SELECT string_agg(format('%s <%s> (%s)', username, email, uuid), ', '
+            ORDER BY email) AS users
+        FROM users
+        GROUP BY email_canonical
+        HAVING count(*) > 1
+    ) AS collisions;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'emails differing only by case: %', duplicates
+            USING HINT = 'delete the duplicate accounts or change their '
+                'email, e.g. UPDATE users SET email = ''<new email>'' '
+                'WHERE uuid = ''<uuid>'', then run the migrations again';
+    END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX users_email_canonical_key ON users (email_canonical);
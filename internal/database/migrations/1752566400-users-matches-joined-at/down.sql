@@ -0,0 +1,3 @@
+DROP INDEX users_matches_match_uuid_idx;
+
+ALTER TABLE users_matches DROP COLUMN joined_at;
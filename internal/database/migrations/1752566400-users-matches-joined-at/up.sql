@@ -0,0 +1,5 @@
+-- clock_timestamp so seats taken in the same transaction keep their order
+ALTER TABLE users_matches
+ADD COLUMN joined_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp();
+
+CREATE INDEX users_matches_match_uuid_idx ON users_matches (match_uuid);
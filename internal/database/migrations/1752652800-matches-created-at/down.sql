@@ -0,0 +1,5 @@
+DROP INDEX matches_created_by_user_idx;
+DROP INDEX matches_waiting_created_at_uuid_idx;
+DROP INDEX matches_created_at_uuid_idx;
+
+ALTER TABLE matches DROP COLUMN created_at;
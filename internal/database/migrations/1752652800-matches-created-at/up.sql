@@ -0,0 +1,15 @@
+ALTER TABLE matches
+ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- keyset pagination walks matches newest first
+CREATE INDEX matches_created_at_uuid_idx ON matches (created_at DESC, uuid DESC);
+
+-- the lobby only lists matches waiting for players
+CREATE INDEX matches_waiting_created_at_uuid_idx
+ON matches (created_at DESC, uuid DESC)
+WHERE match_state = 0;
+
+CREATE INDEX matches_created_by_user_idx ON matches (created_by_user);
+
+-- users are listed by canonical username, users_username_canonical_key
+-- already covers it
@@ -0,0 +1,3 @@
+-- bumped by every state change, writers compare and swap on it so a stale
+-- write fails instead of overwriting a concurrent one
+ALTER TABLE matches ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
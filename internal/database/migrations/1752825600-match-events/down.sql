@@ -0,0 +1,2 @@
+DROP TABLE match_snapshots;
+DROP TABLE match_events;
@@ -0,0 +1,21 @@
+-- every action taken in a match, in order. Rows are only ever inserted, the
+-- state of a match is rebuilt by folding them
+CREATE TABLE match_events (
+    match_uuid UUID NOT NULL REFERENCES matches(uuid) ON DELETE CASCADE,
+    seq BIGINT NOT NULL CONSTRAINT match_events_seq_positive CHECK (seq > 0),
+    actor_uuid UUID,
+    faction TEXT,
+    action_type TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+    PRIMARY KEY (match_uuid, seq)
+);
+
+-- the folded state up to seq, so loading a match doesn't replay it all
+CREATE TABLE match_snapshots (
+    match_uuid UUID NOT NULL REFERENCES matches(uuid) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    state JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+    PRIMARY KEY (match_uuid, seq)
+);
@@ -0,0 +1,5 @@
+DROP TABLE spice_cards;
+DROP TABLE treachery_cards;
+DROP TABLE leaders;
+DROP TABLE factions;
+DROP TABLE territories;
@@ -0,0 +1,46 @@
+-- static game content, written by `duna seed` from data/game.yaml. Rows are
+-- keyed by the stable keys of the data file so seeding again updates them
+CREATE TABLE territories (
+    key TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL CONSTRAINT territories_kind_valid
+        CHECK (kind IN ('sand', 'rock', 'stronghold', 'polar_sink')),
+    sectors JSONB NOT NULL DEFAULT '[]'
+);
+
+CREATE TABLE factions (
+    key TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    starting_spice INT NOT NULL CHECK (starting_spice >= 0),
+    reserves INT NOT NULL CHECK (reserves > 0),
+    home_territory TEXT REFERENCES territories(key),
+    starting_troops INT NOT NULL CHECK (starting_troops >= 0)
+);
+
+CREATE TABLE leaders (
+    key TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    faction TEXT NOT NULL REFERENCES factions(key),
+    strength INT NOT NULL CHECK (strength >= 0)
+);
+
+CREATE TABLE treachery_cards (
+    key TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL CONSTRAINT treachery_cards_kind_valid
+        CHECK (kind IN ('weapon', 'defense', 'special', 'worthless')),
+    subtype TEXT,
+    copies INT NOT NULL CHECK (copies > 0),
+    description TEXT NOT NULL DEFAULT ''
+);
+
+-- worm cards (Shai-Hulud) have no territory
+CREATE TABLE spice_cards (
+    key TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    worm BOOLEAN NOT NULL DEFAULT false,
+    territory TEXT REFERENCES territories(key),
+    sector INT,
+    amount INT NOT NULL DEFAULT 0,
+    copies INT NOT NULL CHECK (copies > 0)
+);
@@ -0,0 +1,2 @@
+DROP INDEX matches_state_created_at_idx;
+DROP TABLE match_archives;
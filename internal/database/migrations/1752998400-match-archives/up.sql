@@ -0,0 +1,18 @@
+-- finished matches moved out of matches by the retention job. The summary
+-- columns serve history and stats, events holds the gzipped JSON of the
+-- whole event log. There is no foreign key, the match row is gone
+CREATE TABLE match_archives (
+    match_uuid UUID PRIMARY KEY,
+    created_by_user VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    players JSONB NOT NULL DEFAULT '[]',
+    winner TEXT,
+    event_count INT NOT NULL DEFAULT 0,
+    events BYTEA NOT NULL
+);
+
+CREATE INDEX match_archives_created_at_idx ON match_archives (created_at DESC);
+
+-- the retention job looks for old matches in a given state
+CREATE INDEX matches_state_created_at_idx ON matches (match_state, created_at);
@@ -0,0 +1,3 @@
+DROP TABLE sessions;
+ALTER TABLE users DROP COLUMN disabled;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'player'
+    CONSTRAINT users_role_valid CHECK (role IN ('player', 'admin'));
+-- disabled users can't log in, their sessions are revoked when disabling
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- the token itself is never stored, only its sha256, so reading the table
+-- doesn't hand out live sessions
+CREATE TABLE sessions (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_uuid UUID NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    csrf_token VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_user_uuid_idx ON sessions (user_uuid);
@@ -0,0 +1,2 @@
+DROP INDEX matches_finished_at_idx;
+ALTER TABLE matches DROP COLUMN finished_at;
@@ -0,0 +1,12 @@
+-- when the match moved to Finish, the retention job archives by it. Matches
+-- finished before the column existed take the time of their last event
+ALTER TABLE matches ADD COLUMN finished_at TIMESTAMPTZ;
+
+UPDATE matches m
+SET finished_at = COALESCE(
+    (SELECT max(e.created_at) FROM match_events e WHERE e.match_uuid = m.uuid),
+    m.created_at)
+WHERE m.match_state = 2;
+
+CREATE INDEX matches_finished_at_idx ON matches (finished_at)
+WHERE match_state = 2;
@@ -0,0 +1 @@
+-- the canonical forms stay, they are what the application writes anyway
@@ -0,0 +1,5 @@
+-- username_canonical and email_canonical were backfilled with lower(), which
+-- neither applies NFKC and case folding to usernames nor converts email
+-- domains to ASCII. Nothing to do in SQL: the postgres package recomputes
+-- them with models.CanonicalUsername and models.CanonicalEmail after this
+-- migration, see backfillCanonicalUsers
@@ -0,0 +1,9 @@
+// Package migrations embeds the migration folders into the binary, so it
+// knows the schema it was built for wherever it runs. New folders are made
+// by cmd/migrations/create.sh
+package migrations
+
+import "embed"
+
+//go:embed */*.sql
+var FS embed.FS
@@ -1,26 +1,233 @@
 package database
 
-import ( 
-	"duna/internal/models"
+import (
+	"context"
 	"duna/internal/hash"
+	"duna/internal/models"
+	"time"
 )
 
 type MockDatabase struct {
-	FuncMigrate           func() error
-	FuncInsertUser        func(user models.User) error
-	FuncGetUserByUsername func(username string,
+	FuncMigrate           func(ctx context.Context) error
+	FuncPing              func(ctx context.Context) error
+	FuncInsertUser        func(ctx context.Context, user models.User) error
+	FuncGetUserByUsername func(ctx context.Context, username string,
+		hash hash.HashStrategy) (models.User, error)
+	FuncGetUserByEmail func(ctx context.Context, email string,
 		hash hash.HashStrategy) (models.User, error)
+	FuncGetUserByUUID func(ctx context.Context, uuid string,
+		hash hash.HashStrategy) (models.User, error)
+	FuncListUsers func(ctx context.Context, filter UserFilter,
+		page PageRequest, hash hash.HashStrategy) (Page[models.User], error)
+	FuncUpdateUserPassword func(ctx context.Context, uuid string,
+		password models.Password) error
+	FuncSetUserDisabled func(ctx context.Context, uuid string,
+		disabled bool) error
+	FuncSetUserRole func(ctx context.Context, uuid string,
+		role models.Role) error
+	FuncInsertMatch func(ctx context.Context, match models.Match) error
+	FuncGetMatch    func(ctx context.Context,
+		uuid string) (models.Match, error)
+	FuncListMatches func(ctx context.Context, filter MatchFilter,
+		page PageRequest) (Page[models.Match], error)
+	FuncUpdateMatchState func(ctx context.Context, uuid string,
+		version int64, state models.MatchState) (int64, error)
+	FuncDeleteMatch func(ctx context.Context, uuid string) error
+	FuncAddPlayer   func(ctx context.Context,
+		matchUUID, userUUID string) error
+	FuncRemovePlayer func(ctx context.Context,
+		matchUUID, userUUID string) error
+	FuncPlayersInMatch func(ctx context.Context,
+		matchUUID string) ([]models.Seat, error)
+	FuncMatchesForUser func(ctx context.Context,
+		userUUID string) ([]models.Match, error)
+	FuncAppendEvents func(ctx context.Context,
+		events ...models.MatchEvent) error
+	FuncLoadEvents func(ctx context.Context, matchUUID string,
+		afterSeq int64) ([]models.MatchEvent, error)
+	FuncSaveSnapshot func(ctx context.Context,
+		snapshot models.MatchSnapshot) error
+	FuncLatestSnapshot func(ctx context.Context,
+		matchUUID string) (models.MatchSnapshot, error)
+	FuncUpsertContent func(ctx context.Context,
+		content models.GameContent) (int, error)
+	FuncLoadContent        func(ctx context.Context) (models.GameContent, error)
+	FuncInsertMatchArchive func(ctx context.Context,
+		archive models.MatchArchive) error
+	FuncGetMatchArchive func(ctx context.Context,
+		matchUUID string) (models.MatchArchive, error)
+	FuncInsertSession func(ctx context.Context,
+		session models.Session) error
+	FuncGetSession func(ctx context.Context,
+		tokenHash string) (models.Session, error)
+	FuncDeleteSession    func(ctx context.Context, tokenHash string) error
+	FuncListUserSessions func(ctx context.Context, userUUID string,
+		now time.Time) ([]models.Session, error)
+	FuncDeleteUserSessions func(ctx context.Context,
+		userUUID string) (int, error)
+	FuncWithTx func(ctx context.Context, fn func(repos Repos) error) error
 }
 
-func (m *MockDatabase) Migrate() error {
-	return m.FuncMigrate()
+func (m *MockDatabase) Migrate(ctx context.Context) error {
+	return m.FuncMigrate(ctx)
 }
 
-func (m *MockDatabase) InsertUser(user models.User) error {
-	return m.FuncInsertUser(user)
+func (m *MockDatabase) Ping(ctx context.Context) error {
+	return m.FuncPing(ctx)
 }
 
-func (m *MockDatabase) GetUserByUsername(username string,
+// WithTx runs fn against the mock itself unless FuncWithTx is set
+func (m *MockDatabase) WithTx(ctx context.Context,
+	fn func(repos Repos) error) error {
+	if m.FuncWithTx != nil {
+		return m.FuncWithTx(ctx, fn)
+	}
+	return fn(m)
+}
+
+func (m *MockDatabase) InsertUser(ctx context.Context, user models.User) error {
+	return m.FuncInsertUser(ctx, user)
+}
+
+func (m *MockDatabase) GetUserByUsername(ctx context.Context, username string,
 	hash hash.HashStrategy) (models.User, error) {
-	return m.FuncGetUserByUsername(username, hash)
+	return m.FuncGetUserByUsername(ctx, username, hash)
+}
+
+func (m *MockDatabase) GetUserByEmail(ctx context.Context, email string,
+	hash hash.HashStrategy) (models.User, error) {
+	return m.FuncGetUserByEmail(ctx, email, hash)
+}
+
+func (m *MockDatabase) GetUserByUUID(ctx context.Context, uuid string,
+	hash hash.HashStrategy) (models.User, error) {
+	return m.FuncGetUserByUUID(ctx, uuid, hash)
+}
+
+func (m *MockDatabase) ListUsers(ctx context.Context, filter UserFilter,
+	page PageRequest, hash hash.HashStrategy) (Page[models.User], error) {
+	return m.FuncListUsers(ctx, filter, page, hash)
+}
+
+func (m *MockDatabase) UpdateUserPassword(ctx context.Context, uuid string,
+	password models.Password) error {
+	return m.FuncUpdateUserPassword(ctx, uuid, password)
+}
+
+func (m *MockDatabase) SetUserDisabled(ctx context.Context, uuid string,
+	disabled bool) error {
+	return m.FuncSetUserDisabled(ctx, uuid, disabled)
+}
+
+func (m *MockDatabase) SetUserRole(ctx context.Context, uuid string,
+	role models.Role) error {
+	return m.FuncSetUserRole(ctx, uuid, role)
+}
+
+func (m *MockDatabase) InsertMatch(ctx context.Context, match models.Match) error {
+	return m.FuncInsertMatch(ctx, match)
+}
+
+func (m *MockDatabase) GetMatch(ctx context.Context,
+	uuid string) (models.Match, error) {
+	return m.FuncGetMatch(ctx, uuid)
+}
+
+func (m *MockDatabase) ListMatches(ctx context.Context, filter MatchFilter,
+	page PageRequest) (Page[models.Match], error) {
+	return m.FuncListMatches(ctx, filter, page)
+}
+
+func (m *MockDatabase) UpdateMatchState(ctx context.Context, uuid string,
+	version int64, state models.MatchState) (int64, error) {
+	return m.FuncUpdateMatchState(ctx, uuid, version, state)
+}
+
+func (m *MockDatabase) DeleteMatch(ctx context.Context, uuid string) error {
+	return m.FuncDeleteMatch(ctx, uuid)
+}
+
+func (m *MockDatabase) AddPlayer(ctx context.Context,
+	matchUUID, userUUID string) error {
+	return m.FuncAddPlayer(ctx, matchUUID, userUUID)
+}
+
+func (m *MockDatabase) RemovePlayer(ctx context.Context,
+	matchUUID, userUUID string) error {
+	return m.FuncRemovePlayer(ctx, matchUUID, userUUID)
+}
+
+func (m *MockDatabase) PlayersInMatch(ctx context.Context,
+	matchUUID string) ([]models.Seat, error) {
+	return m.FuncPlayersInMatch(ctx, matchUUID)
+}
+
+func (m *MockDatabase) MatchesForUser(ctx context.Context,
+	userUUID string) ([]models.Match, error) {
+	return m.FuncMatchesForUser(ctx, userUUID)
+}
+
+func (m *MockDatabase) AppendEvents(ctx context.Context,
+	events ...models.MatchEvent) error {
+	return m.FuncAppendEvents(ctx, events...)
+}
+
+func (m *MockDatabase) LoadEvents(ctx context.Context, matchUUID string,
+	afterSeq int64) ([]models.MatchEvent, error) {
+	return m.FuncLoadEvents(ctx, matchUUID, afterSeq)
+}
+
+func (m *MockDatabase) SaveSnapshot(ctx context.Context,
+	snapshot models.MatchSnapshot) error {
+	return m.FuncSaveSnapshot(ctx, snapshot)
+}
+
+func (m *MockDatabase) LatestSnapshot(ctx context.Context,
+	matchUUID string) (models.MatchSnapshot, error) {
+	return m.FuncLatestSnapshot(ctx, matchUUID)
+}
+
+func (m *MockDatabase) UpsertContent(ctx context.Context,
+	content models.GameContent) (int, error) {
+	return m.FuncUpsertContent(ctx, content)
+}
+
+func (m *MockDatabase) LoadContent(
+	ctx context.Context) (models.GameContent, error) {
+	return m.FuncLoadContent(ctx)
+}
+
+func (m *MockDatabase) InsertMatchArchive(ctx context.Context,
+	archive models.MatchArchive) error {
+	return m.FuncInsertMatchArchive(ctx, archive)
+}
+
+func (m *MockDatabase) GetMatchArchive(ctx context.Context,
+	matchUUID string) (models.MatchArchive, error) {
+	return m.FuncGetMatchArchive(ctx, matchUUID)
+}
+
+func (m *MockDatabase) InsertSession(ctx context.Context,
+	session models.Session) error {
+	return m.FuncInsertSession(ctx, session)
+}
+
+func (m *MockDatabase) GetSession(ctx context.Context,
+	tokenHash string) (models.Session, error) {
+	return m.FuncGetSession(ctx, tokenHash)
+}
+
+func (m *MockDatabase) DeleteSession(ctx context.Context,
+	tokenHash string) error {
+	return m.FuncDeleteSession(ctx, tokenHash)
+}
+
+func (m *MockDatabase) ListUserSessions(ctx context.Context, userUUID string,
+	now time.Time) ([]models.Session, error) {
+	return m.FuncListUserSessions(ctx, userUUID, now)
+}
+
+func (m *MockDatabase) DeleteUserSessions(ctx context.Context,
+	userUUID string) (int, error) {
+	return m.FuncDeleteUserSessions(ctx, userUUID)
 }
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	DEFAULT_PAGE_LIMIT = 20
+	MAX_PAGE_LIMIT     = 100
+)
+
+// PageRequest asks for the page following Cursor, an empty cursor asks for
+// the first one. Cursors are opaque, callers only pass back NextCursor
+type PageRequest struct {
+	Limit  int
+	Cursor string
+}
+
+// Page is one slice of a listing, NextCursor is empty on the last page
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+}
+
+// PageLimit clamps the requested limit to [1, MAX_PAGE_LIMIT], zero means
+// DEFAULT_PAGE_LIMIT
+func (r PageRequest) PageLimit() int {
+	switch {
+	case r.Limit <= 0:
+		return DEFAULT_PAGE_LIMIT
+	case r.Limit > MAX_PAGE_LIMIT:
+		return MAX_PAGE_LIMIT
+	default:
+		return r.Limit
+	}
+}
+
+// MatchCursor is the keyset position in a match listing, matches are
+// ordered newest first by (created_at, uuid)
+type MatchCursor struct {
+	CreatedAt time.Time `json:"c"`
+	UUID      string    `json:"u"`
+}
+
+// UserCursor is the keyset position in a user listing, users are ordered by
+// canonical username
+type UserCursor struct {
+	UsernameCanonical string `json:"n"`
+}
+
+// EncodeCursor serializes a keyset position into an opaque, url safe string
+func EncodeCursor(position any) string {
+	data, err := json.Marshal(position)
+	if err != nil {
+		// cursors are plain structs, this can't fail
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor produced by EncodeCursor, an empty cursor
+// leaves position untouched and reports false
+func DecodeCursor(cursor string, position any) (bool, error) {
+	if cursor == "" {
+		return false, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return false, fmt.Errorf("%w: malformed cursor", ErrInvalid)
+	}
+
+	if err := json.Unmarshal(data, position); err != nil {
+		return false, fmt.Errorf("%w: malformed cursor", ErrInvalid)
+	}
+
+	return true, nil
+}
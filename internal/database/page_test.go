@@ -0,0 +1,67 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPageLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"zero uses default", 0, DEFAULT_PAGE_LIMIT},
+		{"negative uses default", -5, DEFAULT_PAGE_LIMIT},
+		{"within bounds", 7, 7},
+		{"clamped to max", MAX_PAGE_LIMIT + 1, MAX_PAGE_LIMIT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (PageRequest{Limit: tt.limit}).PageLimit(); got != tt.want {
+				t.Errorf("PageLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := MatchCursor{
+		CreatedAt: time.Date(2025, 7, 16, 12, 0, 0, 123000, time.UTC),
+		UUID:      "00000000-0000-4000-8000-000000000001",
+	}
+
+	var got MatchCursor
+	ok, err := DecodeCursor(EncodeCursor(want), &got)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Fatal("expected a cursor")
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.UUID != want.UUID {
+		t.Errorf("DecodeCursor() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	t.Run("empty cursor", func(t *testing.T) {
+		var position UserCursor
+		ok, err := DecodeCursor("", &position)
+		if err != nil || ok {
+			t.Errorf("DecodeCursor() = %v, %v, want false, nil", ok, err)
+		}
+	})
+
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24"} {
+		t.Run("malformed "+cursor, func(t *testing.T) {
+			var position UserCursor
+			_, err := DecodeCursor(cursor, &position)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("expected invalid error, got %v", err)
+			}
+		})
+	}
+}
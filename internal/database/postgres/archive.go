@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"duna/internal/database"
+	"duna/internal/models"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const MATCH_ARCHIVES_TABLE = "match_archives"
+
+func (p *PostgresDatabase) InsertMatchArchive(
+	ctx context.Context,
+	archive models.MatchArchive,
+) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	players, err := json.Marshal(
+		append([]models.ArchivedPlayer{}, archive.Players...))
+	if err != nil {
+		return fmt.Errorf("failed to encode players: %w", err)
+	}
+
+	archivedAt := archive.ArchivedAt
+	if archivedAt.IsZero() {
+		archivedAt = time.Now()
+	}
+
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO %s (match_uuid, created_by_user, created_at,"+
+			" archived_at, players, winner, event_count, events)"+
+			" VALUES($1, $2, $3, $4, $5, $6, $7, $8)",
+		MATCH_ARCHIVES_TABLE,
+	)
+
+	if _, err := p.ExecSql(
+		ctx,
+		nil,
+		insertQuery,
+		archive.MatchUUID,
+		archive.CreatedByUser,
+		archive.CreatedAt,
+		archivedAt,
+		players,
+		nullString(archive.Winner),
+		archive.EventCount,
+		archive.Events,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresDatabase) GetMatchArchive(
+	ctx context.Context,
+	matchUUID string,
+) (models.MatchArchive, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	query := fmt.Sprintf(
+		"SELECT match_uuid, created_by_user, created_at, archived_at,"+
+			" players, winner, event_count, events FROM %s"+
+			" WHERE match_uuid = $1",
+		MATCH_ARCHIVES_TABLE,
+	)
+
+	rows, err := p.queryRead(ctx, query, matchUUID)
+	if err != nil {
+		return models.MatchArchive{}, fmt.Errorf(
+			"failed to query match archive: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return models.MatchArchive{}, fmt.Errorf(
+				"failed to query match archive: %w", translateError(err))
+		}
+		return models.MatchArchive{}, fmt.Errorf(
+			"match archive %w", database.ErrNotFound)
+	}
+
+	var archive models.MatchArchive
+	var players []byte
+	var winner sql.NullString
+	if err := rows.Scan(&archive.MatchUUID, &archive.CreatedByUser,
+		&archive.CreatedAt, &archive.ArchivedAt, &players, &winner,
+		&archive.EventCount, &archive.Events); err != nil {
+		return models.MatchArchive{}, fmt.Errorf(
+			"failed to scan match archive data: %w", err)
+	}
+	archive.Winner = winner.String
+
+	if err := json.Unmarshal(players, &archive.Players); err != nil {
+		return models.MatchArchive{}, fmt.Errorf(
+			"failed to decode archived players: %w", err)
+	}
+
+	return archive, nil
+}
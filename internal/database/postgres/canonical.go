@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"duna/internal/models"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// migrationHooks run after the up.sql of the migration they are keyed by,
+// in the transaction recording it, for what SQL can't express
+var migrationHooks = map[string]func(
+	p *PostgresDatabase,
+	ctx context.Context,
+	tx *sql.Tx,
+) error{
+	"1753257600-recanonicalize-users": (*PostgresDatabase).backfillCanonicalUsers,
+}
+
+// backfillCanonicalUsers rewrites the canonical username and email of every
+// user with models.CanonicalUsername and models.CanonicalEmail. The unique
+// indexes are dropped while rewriting, users swapping canonical forms would
+// collide row by row, and built again once every row is up to date. Two
+// users sharing a canonical form fail the migration, one of them must be
+// renamed first
+func (p *PostgresDatabase) backfillCanonicalUsers(
+	ctx context.Context,
+	tx *sql.Tx,
+) error {
+	rows, err := p.QuerySql(ctx, tx, fmt.Sprintf(
+		"SELECT uuid, username, username_canonical, email, email_canonical"+
+			" FROM %s FOR UPDATE", USERS_TABLE))
+	if err != nil {
+		return err
+	}
+
+	type canonicalForms struct {
+		uuid     string
+		username string
+		email    string
+	}
+
+	// the rows are closed before updating, the transaction has a single
+	// connection
+	var stale []canonicalForms
+	usernames := map[string][]string{}
+	emails := map[string][]string{}
+	for rows.Next() {
+		var uuid, username, usernameCanonical, email, emailCanonical string
+		if err := rows.Scan(&uuid, &username, &usernameCanonical, &email,
+			&emailCanonical); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan user data: %w", err)
+		}
+
+		forms := canonicalForms{
+			uuid:     uuid,
+			username: models.CanonicalUsername(username),
+			email:    models.CanonicalEmail(email),
+		}
+		if forms.username != usernameCanonical ||
+			forms.email != emailCanonical {
+			stale = append(stale, forms)
+		}
+		usernames[forms.username] = append(usernames[forms.username],
+			fmt.Sprintf("%s (%s)", username, uuid))
+		emails[forms.email] = append(emails[forms.email],
+			fmt.Sprintf("%s <%s> (%s)", username, email, uuid))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query users: %w", translateError(err))
+	}
+
+	if err := canonicalCollisions("usernames", usernames); err != nil {
+		return err
+	}
+	if err := canonicalCollisions("emails", emails); err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	for _, index := range canonicalIndexes {
+		if _, err := p.ExecSql(ctx, tx, fmt.Sprintf("DROP INDEX %s",
+			index.name)); err != nil {
+			return fmt.Errorf("failed to drop index %s: %w", index.name, err)
+		}
+	}
+
+	updateQuery := fmt.Sprintf(
+		"UPDATE %s SET username_canonical = $1, email_canonical = $2"+
+			" WHERE uuid = $3", USERS_TABLE)
+	for _, forms := range stale {
+		if _, err := p.ExecSql(ctx, tx, updateQuery, forms.username,
+			forms.email, forms.uuid); err != nil {
+			return fmt.Errorf("failed to backfill the canonical forms of"+
+				" user %s: %w", forms.uuid, err)
+		}
+	}
+
+	for _, index := range canonicalIndexes {
+		if _, err := p.ExecSql(ctx, tx, fmt.Sprintf(
+			"CREATE UNIQUE INDEX %s ON %s (%s)", index.name, USERS_TABLE,
+			index.column)); err != nil {
+			return fmt.Errorf("failed to create index %s: %w", index.name,
+				err)
+		}
+	}
+
+	return nil
+}
+
+// canonicalIndexes are the unique indexes backfillCanonicalUsers rebuilds
+var canonicalIndexes = []struct {
+	name   string
+	column string
+}{
+	{"users_username_canonical_key", "username_canonical"},
+	{"users_email_canonical_key", "email_canonical"},
+}
+
+// canonicalCollisions names the users sharing a canonical form, if any
+func canonicalCollisions(kind string, users map[string][]string) error {
+	var collisions []string
+	for _, group := range users {
+		if len(group) > 1 {
+			collisions = append(collisions, strings.Join(group, ", "))
+		}
+	}
+	if len(collisions) == 0 {
+		return nil
+	}
+
+	slices.Sort(collisions)
+	return fmt.Errorf("%s sharing a canonical form: %s, rename all but one"+
+		" user of each group then run the migrations again", kind,
+		strings.Join(collisions, "; "))
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"duna/internal/models"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var userColumns = []string{"uuid", "username", "username_canonical", "email",
+	"email_canonical"}
+
+func recanonicalizeUsersMigration(t *testing.T) *Migration {
+	t.Helper()
+
+	known, err := KnownMigrations()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var migration *Migration
+	for _, m := range known {
+		if m.FullName() == "1753257600-recanonicalize-users" {
+			migration = m
+		}
+	}
+	if migration == nil {
+		t.Fatal("expected the recanonicalize-users migration to be embedded")
+	}
+
+	return migration
+}
+
+func TestRecanonicalizeUsersMigration(t *testing.T) {
+	migration := recanonicalizeUsersMigration(t)
+	known, err := KnownMigrations()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name := range migrationHooks {
+		if !slices.ContainsFunc(known, func(m *Migration) bool {
+			return m.FullName() == name
+		}) {
+			t.Errorf("hook %s has no migration", name)
+		}
+	}
+
+	// what lower() left behind next to what the application writes
+	users := []struct {
+		uuid              string
+		username, email   string
+		usernameCanonical string
+		emailCanonical    string
+	}{
+		{"u1", "ＡＤＭＩＮ_Paul", "Paul@BÜCHER.de",
+			"admin_paul", "paul@xn--bcher-kva.de"},
+		{"u2", "Straße", "feyd@giedi.prime", "strasse", "feyd@giedi.prime"},
+		{"u3", "leto", "leto@arrakis.com", "leto", "leto@arrakis.com"},
+	}
+
+	rows := sqlmock.NewRows(userColumns)
+	for _, user := range users {
+		if got := models.CanonicalUsername(user.username); got !=
+			user.usernameCanonical {
+			t.Errorf("CanonicalUsername(%q) = %q, want %q", user.username,
+				got, user.usernameCanonical)
+		}
+		if got := models.CanonicalEmail(user.email); got !=
+			user.emailCanonical {
+			t.Errorf("CanonicalEmail(%q) = %q, want %q", user.email, got,
+				user.emailCanonical)
+		}
+
+		rows.AddRow(user.uuid, user.username, strings.ToLower(user.username),
+			user.email, strings.ToLower(user.email))
+	}
+
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+	mock.ExpectExec("backfillCanonicalUsers").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT uuid, username, username_canonical, email,` +
+		` email_canonical FROM users FOR UPDATE`).
+		WillReturnRows(rows)
+	mock.ExpectExec("DROP INDEX users_username_canonical_key").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DROP INDEX users_email_canonical_key").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// u3 was already right
+	for _, user := range users[:2] {
+		mock.ExpectExec(`UPDATE users SET username_canonical = \$1,`+
+			` email_canonical = \$2 WHERE uuid = \$3`).
+			WithArgs(user.usernameCanonical, user.emailCanonical, user.uuid).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(`CREATE UNIQUE INDEX users_username_canonical_key` +
+		` ON users \(username_canonical\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE UNIQUE INDEX users_email_canonical_key` +
+		` ON users \(email_canonical\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").
+		WithArgs("recanonicalize-users", int64(1753257600)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := p.execUpMigrations(
+		context.Background(), []*Migration{migration}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRecanonicalizeUsersMigrationCollision(t *testing.T) {
+	migration := recanonicalizeUsersMigration(t)
+
+	// lower() told them apart, CanonicalUsername does not
+	rows := sqlmock.NewRows(userColumns).
+		AddRow("u1", "Straße", "straße", "feyd@giedi.prime",
+			"feyd@giedi.prime").
+		AddRow("u2", "strasse", "strasse", "rabban@giedi.prime",
+			"rabban@giedi.prime")
+
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+	mock.ExpectExec("backfillCanonicalUsers").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT uuid, username").WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	err := p.execUpMigrations(context.Background(), []*Migration{migration})
+	if err == nil {
+		t.Fatal("expected the colliding usernames to fail the migration")
+	}
+	for _, want := range []string{"Straße (u1)", "strasse (u2)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q to name %s", err, want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
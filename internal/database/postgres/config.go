@@ -1,13 +1,10 @@
 package postgres
 
 import (
-	"bufio"
-	"errors"
+	"duna/internal/config"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 )
 
 // PostgresConfig holds PostgreSQL connection configuration
@@ -18,48 +15,89 @@ type PostgresConfig struct {
 	password string
 	dbName   string
 	sslMode  string
+	// queryTimeout bounds every query whose context has no earlier deadline,
+	// zero disables it
+	queryTimeout time.Duration
+	// pool settings, see the matching sql.DB setters. Zero lifetimes keep
+	// connections forever
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+	// connectTimeout is how long startup waits for the server to accept
+	// connections, zero tries only once
+	connectTimeout time.Duration
+	// replicas serve reads, they share every setting with the primary but
+	// the ones given in their url
+	replicas []PostgresConfig
 }
 
-const (
-	PG_CREDS_FILE_ENV_VAR = "PG_CREDS_FILE"
-	PG_HOST_ENV_VAR       = "PG_HOST"
-	PG_PORT_ENV_VAR       = "PG_PORT"
-	PG_DB_NAME_ENV_VAR    = "PG_DBNAME"
-	PG_SSLMODE_ENV_VAR    = "PG_SSLMODE"
-)
+// NewPostgresConfig creates a new configuration instance, DATABASE_URL
+// overrides the individual connection settings and the credentials are
+// resolved as described in resolveCredentials
+func NewPostgresConfig(cfg config.DatabaseConfig) (*PostgresConfig, error) {
+	c := &PostgresConfig{
+		host:            cfg.Host,
+		port:            cfg.Port,
+		dbName:          cfg.Name,
+		sslMode:         cfg.SSLMode,
+		queryTimeout:    cfg.QueryTimeout,
+		maxOpenConns:    cfg.MaxOpenConns,
+		maxIdleConns:    cfg.MaxIdleConns,
+		connMaxLifetime: cfg.ConnMaxLifetime,
+		connMaxIdleTime: cfg.ConnMaxIdleTime,
+		connectTimeout:  cfg.ConnectTimeout,
+	}
 
-// NewPostgresConfig creates a new configuration instance
-func NewPostgresConfig() (*PostgresConfig, error) {
-	credsPath := getEnv(PG_CREDS_FILE_ENV_VAR, "")
-	if credsPath == "" {
-		return nil, errors.New(PG_CREDS_FILE_ENV_VAR +
-			" environment variable not set")
+	if cfg.URL != "" {
+		if err := c.applyURL(cfg.URL.Reveal()); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", DATABASE_URL_SOURCE, err)
+		}
 	}
 
-	user, password, err := readCredentialsFromFile(credsPath)
-	if err != nil {
+	if err := c.resolveCredentials(cfg); err != nil {
 		return nil, fmt.Errorf("failed to read credentials: %w", err)
 	}
 
-	return &PostgresConfig{
-		host:     getEnv(PG_HOST_ENV_VAR, "localhost"),
-		port:     getEnvAsInt(PG_PORT_ENV_VAR, 5432),
-		user:     user,
-		password: password,
-		dbName:   getEnv(PG_DB_NAME_ENV_VAR, "postgres"),
-		sslMode:  getEnv(PG_SSLMODE_ENV_VAR, "disable"),
-	}, nil
+	for i, replicaURL := range strings.Split(cfg.ReplicaURLs.Reveal(), ",") {
+		replicaURL = strings.TrimSpace(replicaURL)
+		if replicaURL == "" {
+			continue
+		}
+
+		// the copy must not share the replicas read so far, they are
+		// appended to the same backing array
+		replica := *c
+		replica.replicas = nil
+		if err := replica.applyURL(replicaURL); err != nil {
+			return nil, fmt.Errorf("invalid replica %d in %s: %w",
+				i+1, REPLICA_URLS_SOURCE, err)
+		}
+		c.replicas = append(c.replicas, replica)
+	}
+
+	return c, nil
 }
 
-// ConnectionString returns the formatted connection string
+// ConnectionString returns the formatted connection string, values are
+// quoted so passwords may hold spaces, quotes and backslashes
 func (c *PostgresConfig) ConnectionString() string {
 	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		c.host,
+		quoteConnValue(c.host),
 		c.port,
-		c.user,
-		c.password,
-		c.dbName,
-		c.sslMode)
+		quoteConnValue(c.user),
+		quoteConnValue(c.password),
+		quoteConnValue(c.dbName),
+		quoteConnValue(c.sslMode))
+}
+
+// quoteConnValue quotes a keyword/value connection string value the way
+// libpq expects
+func quoteConnValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+
+	return "'" + value + "'"
 }
 
 // Getter methods for individual properties (optional)
@@ -68,76 +106,18 @@ func (c *PostgresConfig) Port() int       { return c.port }
 func (c *PostgresConfig) User() string    { return c.user }
 func (c *PostgresConfig) DBName() string  { return c.dbName }
 func (c *PostgresConfig) SSLMode() string { return c.sslMode }
-
-func readCredentialsFromFile(path string) (string, string, error) {
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return "", "", fmt.Errorf("invalid file path: %w", err)
-	}
-
-	// Verify file permissions (optional but recommended)
-	// if err := verifyFilePermissions(absPath); err != nil {
-	// 	return "", "", err
-	// }
-
-	file, err := os.Open(absPath)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to open credentials file: %w", err)
-	}
-	defer file.Close()
-
-	var user, password string
-	scanner := bufio.NewScanner(file)
-
-	// Read first line for username
-	if scanner.Scan() {
-		user = strings.TrimSpace(scanner.Text())
-	}
-
-	// Read second line for password
-	if scanner.Scan() {
-		password = strings.TrimSpace(scanner.Text())
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", "", fmt.Errorf("error reading credentials from %s file: %w",
-			PG_CREDS_FILE_ENV_VAR, err)
-	}
-
-	if user == "" || password == "" {
-		return "", "", fmt.Errorf("invalid credentials format in file %s",
-			PG_CREDS_FILE_ENV_VAR)
-	}
-
-	return user, password, nil
+func (c *PostgresConfig) Replicas() int   { return len(c.replicas) }
+func (c *PostgresConfig) QueryTimeout() time.Duration {
+	return c.queryTimeout
 }
-
-// verifyFilePermissions checks if file has secure permissions
-func verifyFilePermissions(path string) error {
-	info, err := os.Stat(path)
-	if err != nil {
-		return err
-	}
-
-	if info.Mode().Perm()&0077 != 0 {
-		return fmt.Errorf("insecure file permissions on %s (should be 600)", path)
-	}
-
-	return nil
+func (c *PostgresConfig) MaxOpenConns() int { return c.maxOpenConns }
+func (c *PostgresConfig) MaxIdleConns() int { return c.maxIdleConns }
+func (c *PostgresConfig) ConnMaxLifetime() time.Duration {
+	return c.connMaxLifetime
 }
-
-// Helper functions
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultValue
+func (c *PostgresConfig) ConnMaxIdleTime() time.Duration {
+	return c.connMaxIdleTime
 }
-
-func getEnvAsInt(key string, defaultValue int) int {
-	strValue := getEnv(key, "")
-	if value, err := strconv.Atoi(strValue); err == nil {
-		return value
-	}
-	return defaultValue
+func (c *PostgresConfig) ConnectTimeout() time.Duration {
+	return c.connectTimeout
 }
@@ -0,0 +1,282 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"duna/internal/models"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	TERRITORIES_TABLE     = "territories"
+	FACTIONS_TABLE        = "factions"
+	LEADERS_TABLE         = "leaders"
+	TREACHERY_CARDS_TABLE = "treachery_cards"
+	SPICE_CARDS_TABLE     = "spice_cards"
+)
+
+var (
+	territoryColumns = []string{"key", "name", "kind", "sectors"}
+	factionColumns   = []string{"key", "name", "starting_spice", "reserves",
+		"home_territory", "starting_troops"}
+	leaderColumns        = []string{"key", "name", "faction", "strength"}
+	treacheryCardColumns = []string{"key", "name", "kind", "subtype",
+		"copies", "description"}
+	spiceCardColumns = []string{"key", "name", "worm", "territory", "sector",
+		"amount", "copies"}
+)
+
+func (p *PostgresDatabase) UpsertContent(
+	ctx context.Context,
+	content models.GameContent,
+) (int, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	// referenced tables go first
+	var rows [][]any
+	for _, territory := range content.Territories {
+		sectors, err := json.Marshal(append([]int{}, territory.Sectors...))
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode sectors: %w", err)
+		}
+		rows = append(rows, []any{territory.Key, territory.Name,
+			territory.Kind, sectors})
+	}
+	written, err := p.upsertByKey(ctx, TERRITORIES_TABLE, territoryColumns,
+		rows)
+	if err != nil {
+		return 0, err
+	}
+
+	rows = nil
+	for _, faction := range content.Factions {
+		rows = append(rows, []any{faction.Key, faction.Name,
+			faction.StartingSpice, faction.Reserves,
+			nullString(faction.HomeTerritory), faction.StartingTroops})
+	}
+	n, err := p.upsertByKey(ctx, FACTIONS_TABLE, factionColumns, rows)
+	if err != nil {
+		return 0, err
+	}
+	written += n
+
+	rows = nil
+	for _, leader := range content.Leaders {
+		rows = append(rows, []any{leader.Key, leader.Name, leader.Faction,
+			leader.Strength})
+	}
+	n, err = p.upsertByKey(ctx, LEADERS_TABLE, leaderColumns, rows)
+	if err != nil {
+		return 0, err
+	}
+	written += n
+
+	rows = nil
+	for _, card := range content.TreacheryCards {
+		rows = append(rows, []any{card.Key, card.Name, card.Kind,
+			nullString(card.Subtype), card.Copies, card.Description})
+	}
+	n, err = p.upsertByKey(ctx, TREACHERY_CARDS_TABLE, treacheryCardColumns,
+		rows)
+	if err != nil {
+		return 0, err
+	}
+	written += n
+
+	rows = nil
+	for _, card := range content.SpiceCards {
+		sector := sql.NullInt64{Int64: int64(card.Sector), Valid: !card.Worm}
+		rows = append(rows, []any{card.Key, card.Name, card.Worm,
+			nullString(card.Territory), sector, card.Amount, card.Copies})
+	}
+	n, err = p.upsertByKey(ctx, SPICE_CARDS_TABLE, spiceCardColumns, rows)
+	if err != nil {
+		return 0, err
+	}
+	written += n
+
+	return written, nil
+}
+
+// upsertByKey writes rows in a single statement, the first column is the
+// key. Rows already stored unchanged are skipped so the count returned is
+// the number of rows inserted or actually updated
+func (p *PostgresDatabase) upsertByKey(
+	ctx context.Context,
+	table string,
+	columns []string,
+	rows [][]any,
+) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	updated := columns[1:]
+	assignments := make([]string, 0, len(updated))
+	for _, column := range updated {
+		assignments = append(assignments, column+" = EXCLUDED."+column)
+	}
+
+	insert := psql.Insert(table + " AS t").Columns(columns...).
+		Suffix(fmt.Sprintf(
+			"ON CONFLICT (key) DO UPDATE SET %s"+
+				" WHERE (t.%s) IS DISTINCT FROM (EXCLUDED.%s)",
+			strings.Join(assignments, ", "),
+			strings.Join(updated, ", t."),
+			strings.Join(updated, ", EXCLUDED."),
+		))
+	for _, row := range rows {
+		insert = insert.Values(row...)
+	}
+
+	query, args, err := insert.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build %s upsert: %w", table, err)
+	}
+
+	result, err := p.ExecSql(ctx, nil, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("unable to read affected rows: %w", err)
+	}
+
+	return int(written), nil
+}
+
+func (p *PostgresDatabase) LoadContent(
+	ctx context.Context,
+) (models.GameContent, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	var content models.GameContent
+
+	err := p.queryContent(ctx, TERRITORIES_TABLE, territoryColumns,
+		func(rows *sql.Rows) error {
+			var territory models.TerritoryDef
+			var sectors []byte
+			if err := rows.Scan(&territory.Key, &territory.Name,
+				&territory.Kind, &sectors); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(sectors, &territory.Sectors); err != nil {
+				return err
+			}
+
+			content.Territories = append(content.Territories, territory)
+			return nil
+		})
+	if err != nil {
+		return models.GameContent{}, err
+	}
+
+	err = p.queryContent(ctx, FACTIONS_TABLE, factionColumns,
+		func(rows *sql.Rows) error {
+			var faction models.FactionDef
+			var home sql.NullString
+			if err := rows.Scan(&faction.Key, &faction.Name,
+				&faction.StartingSpice, &faction.Reserves, &home,
+				&faction.StartingTroops); err != nil {
+				return err
+			}
+			faction.HomeTerritory = home.String
+
+			content.Factions = append(content.Factions, faction)
+			return nil
+		})
+	if err != nil {
+		return models.GameContent{}, err
+	}
+
+	err = p.queryContent(ctx, LEADERS_TABLE, leaderColumns,
+		func(rows *sql.Rows) error {
+			var leader models.LeaderDef
+			if err := rows.Scan(&leader.Key, &leader.Name, &leader.Faction,
+				&leader.Strength); err != nil {
+				return err
+			}
+
+			content.Leaders = append(content.Leaders, leader)
+			return nil
+		})
+	if err != nil {
+		return models.GameContent{}, err
+	}
+
+	err = p.queryContent(ctx, TREACHERY_CARDS_TABLE, treacheryCardColumns,
+		func(rows *sql.Rows) error {
+			var card models.TreacheryCardDef
+			var subtype sql.NullString
+			if err := rows.Scan(&card.Key, &card.Name, &card.Kind, &subtype,
+				&card.Copies, &card.Description); err != nil {
+				return err
+			}
+			card.Subtype = subtype.String
+
+			content.TreacheryCards = append(content.TreacheryCards, card)
+			return nil
+		})
+	if err != nil {
+		return models.GameContent{}, err
+	}
+
+	err = p.queryContent(ctx, SPICE_CARDS_TABLE, spiceCardColumns,
+		func(rows *sql.Rows) error {
+			var card models.SpiceCardDef
+			var territory sql.NullString
+			var sector sql.NullInt64
+			if err := rows.Scan(&card.Key, &card.Name, &card.Worm,
+				&territory, &sector, &card.Amount, &card.Copies); err != nil {
+				return err
+			}
+			card.Territory = territory.String
+			card.Sector = int(sector.Int64)
+
+			content.SpiceCards = append(content.SpiceCards, card)
+			return nil
+		})
+	if err != nil {
+		return models.GameContent{}, err
+	}
+
+	return content, nil
+}
+
+// queryContent reads every row of a content table ordered by key and hands
+// each of them to scan
+func (p *PostgresDatabase) queryContent(
+	ctx context.Context,
+	table string,
+	columns []string,
+	scan func(rows *sql.Rows) error,
+) error {
+	query, args, err := psql.Select(columns...).From(table).
+		OrderBy("key").ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build %s query: %w", table, err)
+	}
+
+	rows, err := p.queryRead(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("failed to scan %s data: %w", table, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query %s: %w", table, translateError(err))
+	}
+
+	return nil
+}
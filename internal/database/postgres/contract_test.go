@@ -0,0 +1,52 @@
+package postgres_test
+
+import (
+	"context"
+	"duna/internal/config"
+	"duna/internal/database"
+	"duna/internal/database/databasetest"
+	"duna/internal/database/postgres"
+	"os"
+	"testing"
+)
+
+// Runs against a real server, point PG_CREDS_FILE (and the other PG_*
+// variables) at a scratch database to enable it
+func TestPostgresDatabaseContract(t *testing.T) {
+	if _, ok := os.LookupEnv("PG_CREDS_FILE"); !ok {
+		t.Skip("PG_CREDS_FILE not set, skipping postgres tests")
+	}
+
+	cfg, err := config.Load(config.Options{})
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %v", err)
+	}
+
+	pgConfig, err := postgres.NewPostgresConfig(cfg.Database)
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %v", err)
+	}
+
+	db, err := postgres.Connect(context.Background(), *pgConfig)
+	if err != nil {
+		t.Fatalf("unexpected error connecting: %v", err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("unexpected error migrating: %v", err)
+	}
+
+	differences, err := db.CheckSchema(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error checking the schema: %v", err)
+	}
+	// a freshly migrated database matches its migrations
+	for _, difference := range differences {
+		t.Errorf("unexpected schema difference %s", difference)
+	}
+
+	databasetest.RunContractTests(t, func(t *testing.T) database.Database {
+		return db
+	})
+}
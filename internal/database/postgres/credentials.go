@@ -0,0 +1,302 @@
+package postgres
+
+import (
+	"bufio"
+	"duna/internal/config"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgpassfile"
+)
+
+// names of the credential sources, as they appear in errors
+const (
+	DATABASE_URL_SOURCE     = "DATABASE_URL"
+	REPLICA_URLS_SOURCE     = "DATABASE_REPLICA_URLS"
+	PG_USER_SOURCE          = "PG_USER"
+	PG_PASSWORD_SOURCE      = "PG_PASSWORD"
+	PG_USER_FILE_SOURCE     = "PG_USER_FILE"
+	PG_PASSWORD_FILE_SOURCE = "PG_PASSWORD_FILE"
+	PG_CREDS_FILE_SOURCE    = "PG_CREDS_FILE"
+	PGPASSFILE_SOURCE       = "PGPASSFILE"
+)
+
+// ErrInsecurePermissions is returned for a credential file other users can
+// read or write
+var ErrInsecurePermissions = errors.New("insecure file permissions")
+
+// CredentialSourceError tells which credential source could not be used
+type CredentialSourceError struct {
+	Source string
+	Path   string
+	Err    error
+}
+
+func (e *CredentialSourceError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("credential source %s: %v", e.Source, e.Err)
+	}
+
+	return fmt.Sprintf("credential source %s (%s): %v", e.Source, e.Path, e.Err)
+}
+
+func (e *CredentialSourceError) Unwrap() error {
+	return e.Err
+}
+
+// applyURL takes the connection settings present in a postgres:// url,
+// the ones missing keep their configured value
+func (c *PostgresConfig) applyURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// the url holds the password, don't echo it
+		return errors.New("malformed url")
+	}
+
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return fmt.Errorf("unsupported scheme %q, expected postgres://",
+			u.Scheme)
+	}
+
+	if strings.Contains(u.Host, ",") {
+		return errors.New("multiple hosts are not supported")
+	}
+
+	if host := u.Hostname(); host != "" {
+		c.host = host
+	}
+
+	if port := u.Port(); port != "" {
+		c.port, err = strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+
+	if name := strings.TrimPrefix(u.Path, "/"); name != "" {
+		c.dbName = name
+	}
+
+	if u.User != nil {
+		c.user = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			c.password = password
+		}
+	}
+
+	for key, values := range u.Query() {
+		if key != "sslmode" {
+			return fmt.Errorf("unsupported parameter %q", key)
+		}
+		c.sslMode = values[len(values)-1]
+	}
+
+	return nil
+}
+
+// resolveCredentials fills the user and the password, each of them comes
+// from the first source providing it:
+//
+//  1. DATABASE_URL
+//  2. PG_USER and PG_PASSWORD
+//  3. PG_USER_FILE and PG_PASSWORD_FILE, one value per file as mounted by
+//     docker and kubernetes secrets
+//  4. PG_CREDS_FILE, the user and the password on two lines
+//  5. PGPASSFILE or ~/.pgpass, for the password only
+//
+// Files must only be accessible by their owner unless InsecureCredsFiles
+// is set, libpq applies the same rule to .pgpass
+func (c *PostgresConfig) resolveCredentials(cfg config.DatabaseConfig) error {
+	checkPermissions := !cfg.InsecureCredsFiles
+
+	if c.user == "" {
+		c.user = cfg.User
+	}
+	if c.password == "" {
+		c.password = cfg.Password.Reveal()
+	}
+
+	if c.user == "" && cfg.UserFile != "" {
+		user, err := readSecretFile(cfg.UserFile, checkPermissions)
+		if err != nil {
+			return &CredentialSourceError{
+				Source: PG_USER_FILE_SOURCE, Path: cfg.UserFile, Err: err}
+		}
+		c.user = user
+	}
+	if c.password == "" && cfg.PasswordFile != "" {
+		password, err := readSecretFile(cfg.PasswordFile, checkPermissions)
+		if err != nil {
+			return &CredentialSourceError{
+				Source: PG_PASSWORD_FILE_SOURCE, Path: cfg.PasswordFile, Err: err}
+		}
+		c.password = password
+	}
+
+	if (c.user == "" || c.password == "") && cfg.CredsFile != "" {
+		user, password, err := readCredentialsFromFile(
+			cfg.CredsFile, checkPermissions)
+		if err != nil {
+			return &CredentialSourceError{
+				Source: PG_CREDS_FILE_SOURCE, Path: cfg.CredsFile, Err: err}
+		}
+		if c.user == "" {
+			c.user = user
+		}
+		if c.password == "" {
+			c.password = password
+		}
+	}
+
+	if c.user == "" {
+		return fmt.Errorf("no postgres user configured, set one of %s, %s,"+
+			" %s or %s", DATABASE_URL_SOURCE, PG_USER_SOURCE,
+			PG_USER_FILE_SOURCE, PG_CREDS_FILE_SOURCE)
+	}
+
+	if c.password == "" {
+		password, err := c.passwordFromPassfile(cfg.PassFile, checkPermissions)
+		if err != nil {
+			return err
+		}
+		c.password = password
+	}
+
+	if c.password == "" {
+		return fmt.Errorf("no postgres password configured for %s, set one"+
+			" of %s, %s, %s, %s or add it to %s", c.user, DATABASE_URL_SOURCE,
+			PG_PASSWORD_SOURCE, PG_PASSWORD_FILE_SOURCE, PG_CREDS_FILE_SOURCE,
+			PGPASSFILE_SOURCE)
+	}
+
+	return nil
+}
+
+// passwordFromPassfile looks the password up in the libpq password file,
+// the default ~/.pgpass may be missing but an explicit path must exist
+func (c *PostgresConfig) passwordFromPassfile(
+	path string,
+	checkPermissions bool,
+) (string, error) {
+	explicit := path != ""
+	if !explicit {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".pgpass")
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) && !explicit {
+		return "", nil
+	}
+
+	sourceError := func(err error) error {
+		return &CredentialSourceError{
+			Source: PGPASSFILE_SOURCE, Path: path, Err: err}
+	}
+
+	if checkPermissions {
+		if err := verifyFilePermissions(path); err != nil {
+			return "", sourceError(err)
+		}
+	}
+
+	passfile, err := pgpassfile.ReadPassfile(path)
+	if err != nil {
+		return "", sourceError(err)
+	}
+
+	return passfile.FindPassword(
+		c.host, strconv.Itoa(c.port), c.dbName, c.user), nil
+}
+
+// readSecretFile reads a file holding a single value, the trailing newline
+// editors and kubectl add is dropped
+func readSecretFile(path string, checkPermissions bool) (string, error) {
+	if checkPermissions {
+		if err := verifyFilePermissions(path); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", errors.New("file is empty")
+	}
+
+	return value, nil
+}
+
+func readCredentialsFromFile(
+	path string,
+	checkPermissions bool,
+) (string, string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid file path: %w", err)
+	}
+
+	if checkPermissions {
+		if err := verifyFilePermissions(absPath); err != nil {
+			return "", "", err
+		}
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open credentials file: %w", err)
+	}
+	defer file.Close()
+
+	var user, password string
+	scanner := bufio.NewScanner(file)
+
+	// Read first line for username
+	if scanner.Scan() {
+		user = strings.TrimSpace(scanner.Text())
+	}
+
+	// Read second line for password
+	if scanner.Scan() {
+		password = strings.TrimSpace(scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", "", fmt.Errorf("error reading credentials: %w", err)
+	}
+
+	if user == "" || password == "" {
+		return "", "", errors.New("invalid credentials format," +
+			" expected the user and the password on two lines")
+	}
+
+	return user, password, nil
+}
+
+// verifyFilePermissions checks if file has secure permissions
+func verifyFilePermissions(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%w %#o on %s (should be 600, or set"+
+			" PG_INSECURE_CREDS_FILES=true)", ErrInsecurePermissions,
+			info.Mode().Perm(), path)
+	}
+
+	return nil
+}
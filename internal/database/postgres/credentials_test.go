@@ -0,0 +1,284 @@
+package postgres
+
+import (
+	"duna/internal/config"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func writeCredsFile(
+	t *testing.T,
+	name, content string,
+	perm os.FileMode,
+) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatalf("unexpected error writing %s: %v", name, err)
+	}
+	// the umask may have dropped bits
+	if err := os.Chmod(path, perm); err != nil {
+		t.Fatalf("unexpected error setting permissions: %v", err)
+	}
+
+	return path
+}
+
+func testDatabaseConfig(t *testing.T) config.DatabaseConfig {
+	cfg := config.Defaults(config.DEVELOPMENT).Database
+	// keep the ~/.pgpass of whoever runs the tests out of the way
+	cfg.PassFile = writeCredsFile(t, "pgpass", "", 0600)
+
+	return cfg
+}
+
+func TestResolveCredentialsPrecedence(t *testing.T) {
+	credsFile := writeCredsFile(t, "pgcreds", "file-user\nfile-pass\n", 0600)
+	userFile := writeCredsFile(t, "user", "secret-user\n", 0400)
+	passwordFile := writeCredsFile(t, "password", "secret-pass\n", 0400)
+
+	tests := []struct {
+		name         string
+		setup        func(cfg *config.DatabaseConfig)
+		wantUser     string
+		wantPassword string
+	}{
+		{
+			name: "creds file",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.CredsFile = credsFile
+			},
+			wantUser:     "file-user",
+			wantPassword: "file-pass",
+		},
+		{
+			name: "secret files over creds file",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.CredsFile = credsFile
+				cfg.UserFile = userFile
+				cfg.PasswordFile = passwordFile
+			},
+			wantUser:     "secret-user",
+			wantPassword: "secret-pass",
+		},
+		{
+			name: "env over secret files, per value",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.UserFile = userFile
+				cfg.PasswordFile = passwordFile
+				cfg.Password = "env-pass"
+			},
+			wantUser:     "secret-user",
+			wantPassword: "env-pass",
+		},
+		{
+			name: "url over everything",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.CredsFile = credsFile
+				cfg.User = "env-user"
+				cfg.URL = "postgres://url-user:url%20pass@db:6432/duna"
+			},
+			wantUser:     "url-user",
+			wantPassword: "url pass",
+		},
+		{
+			name: "url without password falls back",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.CredsFile = credsFile
+				cfg.URL = "postgres://url-user@db/duna"
+			},
+			wantUser:     "url-user",
+			wantPassword: "file-pass",
+		},
+		{
+			name: "pgpass",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.User = "pgpass-user"
+				cfg.PassFile = writeCredsFile(t, "pgpass",
+					"localhost:5432:*:pgpass-user:pgpass-pass\n", 0600)
+			},
+			wantUser:     "pgpass-user",
+			wantPassword: "pgpass-pass",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testDatabaseConfig(t)
+			tt.setup(&cfg)
+
+			c, err := NewPostgresConfig(cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if c.user != tt.wantUser || c.password != tt.wantPassword {
+				t.Errorf("got %s/%s, want %s/%s",
+					c.user, c.password, tt.wantUser, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestResolveCredentialsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(cfg *config.DatabaseConfig)
+		wantSource string
+		wantErr    string
+	}{
+		{
+			name: "world readable creds file",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.CredsFile = writeCredsFile(
+					t, "pgcreds", "user\npass\n", 0644)
+			},
+			wantSource: PG_CREDS_FILE_SOURCE,
+			wantErr:    "insecure file permissions",
+		},
+		{
+			name: "group readable password file",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.User = "user"
+				cfg.PasswordFile = writeCredsFile(t, "password", "pass", 0640)
+			},
+			wantSource: PG_PASSWORD_FILE_SOURCE,
+			wantErr:    "insecure file permissions",
+		},
+		{
+			name: "missing user file",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.UserFile = "/nonexistent/user"
+			},
+			wantSource: PG_USER_FILE_SOURCE,
+			wantErr:    "no such file",
+		},
+		{
+			name: "one line creds file",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.CredsFile = writeCredsFile(t, "pgcreds", "user\n", 0600)
+			},
+			wantSource: PG_CREDS_FILE_SOURCE,
+			wantErr:    "two lines",
+		},
+		{
+			name: "insecure pgpass",
+			setup: func(cfg *config.DatabaseConfig) {
+				cfg.User = "user"
+				cfg.PassFile = writeCredsFile(t, "pgpass", "*:*:*:*:pass", 0644)
+			},
+			wantSource: PGPASSFILE_SOURCE,
+			wantErr:    "insecure file permissions",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testDatabaseConfig(t)
+			tt.setup(&cfg)
+
+			_, err := NewPostgresConfig(cfg)
+
+			var sourceErr *CredentialSourceError
+			if !errors.As(err, &sourceErr) || sourceErr.Source != tt.wantSource {
+				t.Fatalf("expected an error from %s, got %v", tt.wantSource, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("nothing configured", func(t *testing.T) {
+		_, err := NewPostgresConfig(testDatabaseConfig(t))
+		if err == nil || !strings.Contains(err.Error(), "no postgres user") {
+			t.Errorf("expected missing user error, got %v", err)
+		}
+	})
+
+	t.Run("malformed url is not echoed", func(t *testing.T) {
+		cfg := testDatabaseConfig(t)
+		cfg.URL = "postgres://user:s3cret@db:port/duna"
+
+		_, err := NewPostgresConfig(cfg)
+		if err == nil || strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("expected an error hiding the password, got %v", err)
+		}
+	})
+}
+
+func TestInsecureCredsFilesOptOut(t *testing.T) {
+	cfg := testDatabaseConfig(t)
+	cfg.CredsFile = writeCredsFile(t, "pgcreds", "user\npass\n", 0644)
+	cfg.InsecureCredsFiles = true
+
+	if _, err := NewPostgresConfig(cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestApplyURL(t *testing.T) {
+	c := &PostgresConfig{host: "localhost", port: 5432, sslMode: "disable"}
+	err := c.applyURL("postgresql://u:p@db.internal:6432/duna?sslmode=require")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.host != "db.internal" || c.port != 6432 || c.dbName != "duna" ||
+		c.sslMode != "require" {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	for _, rawURL := range []string{
+		"mysql://u:p@db/duna",
+		"postgres://u:p@a,b/duna",
+		"postgres://u:p@db/duna?application_name=x",
+	} {
+		if err := (&PostgresConfig{}).applyURL(rawURL); err == nil {
+			t.Errorf("expected %s to be rejected", rawURL)
+		}
+	}
+}
+
+func TestConnectionStringQuotesValues(t *testing.T) {
+	c := &PostgresConfig{
+		host:     "localhost",
+		port:     5432,
+		user:     "duna",
+		password: `it's a \secret`,
+		dbName:   "duna",
+		sslMode:  "disable",
+	}
+
+	want := `host='localhost' port=5432 user='duna'` +
+		` password='it\'s a \\secret' dbname='duna' sslmode='disable'`
+	if got := c.ConnectionString(); got != want {
+		t.Errorf("ConnectionString() = %s, want %s", got, want)
+	}
+}
+
+func TestConnectionStringParsesBack(t *testing.T) {
+	c := &PostgresConfig{
+		host:     "localhost",
+		port:     5432,
+		user:     "duna",
+		password: `p a'ss\word=`,
+		dbName:   "duna",
+		sslMode:  "disable",
+	}
+
+	parsed, err := pgconn.ParseConfig(c.ConnectionString())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if parsed.Password != c.password {
+		t.Errorf("password parsed as %q, want %q", parsed.Password, c.password)
+	}
+}
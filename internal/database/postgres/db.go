@@ -1,34 +1,186 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"duna/internal/database"
+	"fmt"
+	"time"
 
+	sq "github.com/Masterminds/squirrel"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pkg/errors"
 )
 
+// psql builds queries with postgres $n placeholders
+var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+var _ database.ServerClock = (*PostgresDatabase)(nil)
+
 type PostgresDatabase struct {
 	DB     *sql.DB
 	config PostgresConfig
+	// tx is set on the copies handed out by WithTx, queries without an
+	// explicit transaction run in it
+	tx *sql.Tx
+	// replicas is nil without configured replicas, see queryRead
+	replicas *replicaSet
 }
 
+// NewPostgresDatabase sets up the connection pool, no connection is made
+// until the first query, see Connect
 func NewPostgresDatabase(config PostgresConfig) (*PostgresDatabase, error) {
-	defaultDb, err := sql.Open("pgx", config.ConnectionString())
+	defaultDb, err := openPool(config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &PostgresDatabase{DB: defaultDb, config: config}, nil
+	p := &PostgresDatabase{DB: defaultDb, config: config}
+	if len(config.replicas) == 0 {
+		return p, nil
+	}
+
+	var replicas []*sql.DB
+	for _, replicaConfig := range config.replicas {
+		replica, err := openPool(replicaConfig)
+		if err != nil {
+			newReplicaSet(replicas).close()
+			defaultDb.Close()
+			return nil, err
+		}
+		replicas = append(replicas, replica)
+	}
+	p.replicas = newReplicaSet(replicas)
+
+	return p, nil
 }
 
-func (p *PostgresDatabase) BeginTransaction() (*sql.Tx, error) {
-	tx, err := p.DB.Begin()
+func openPool(config PostgresConfig) (*sql.DB, error) {
+	db, err := sql.Open("pgx", config.ConnectionString())
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to begin transaction")
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(config.maxOpenConns)
+	db.SetMaxIdleConns(config.maxIdleConns)
+	db.SetConnMaxLifetime(config.connMaxLifetime)
+	db.SetConnMaxIdleTime(config.connMaxIdleTime)
+
+	return db, nil
+}
+
+// Connect opens the pool and waits up to the configured connect timeout for
+// the server to accept connections, so a bad configuration fails at startup
+// instead of on the first query. Replicas are not waited for, reads fall
+// back to the primary until they are up
+func Connect(
+	ctx context.Context,
+	config PostgresConfig,
+) (*PostgresDatabase, error) {
+	p, err := NewPostgresDatabase(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.WaitUntilAvailable(
+		ctx, config.connectTimeout, p.Ping); err != nil {
+		p.DB.Close()
+		p.replicas.close()
+		return nil, errors.Wrapf(err, "unable to connect to %s:%d",
+			config.host, config.port)
+	}
+
+	return p, nil
+}
+
+// ConnectionString connects to the primary, for connections held outside
+// the pool such as the LISTEN one of pubsub
+func (p *PostgresDatabase) ConnectionString() string {
+	return p.config.ConnectionString()
+}
+
+func (p *PostgresDatabase) Ping(ctx context.Context) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	if err := p.DB.PingContext(ctx); err != nil {
+		return errors.Wrap(translateError(err), "unable to ping database")
+	}
+
+	return nil
+}
+
+// ServerTime reads the clock of the primary, unlike now() it is not frozen
+// at the start of the transaction
+func (p *PostgresDatabase) ServerTime(ctx context.Context) (time.Time, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	var now time.Time
+	if err := p.DB.QueryRowContext(
+		ctx, "SELECT clock_timestamp()").Scan(&now); err != nil {
+		return time.Time{}, errors.Wrap(translateError(err),
+			"unable to read the server time")
+	}
+
+	return now, nil
+}
+
+// withQueryTimeout bounds ctx by the configured query timeout, a deadline
+// already set on ctx wins if it is earlier
+func (p *PostgresDatabase) withQueryTimeout(
+	ctx context.Context,
+) (context.Context, context.CancelFunc) {
+	if p.config.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, p.config.queryTimeout)
+}
+
+func (p *PostgresDatabase) BeginTransaction(
+	ctx context.Context,
+) (*sql.Tx, error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(
+			translateError(err), "unable to begin transaction")
 	}
 	return tx, nil
 }
 
+func (p *PostgresDatabase) WithTx(
+	ctx context.Context,
+	fn func(repos database.Repos) error,
+) error {
+	// already inside a transaction, join it
+	if p.tx != nil {
+		return fn(p)
+	}
+
+	return database.RetrySerializationFailures(ctx, func() error {
+		tx, err := p.DB.BeginTx(
+			ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			return errors.Wrap(
+				translateError(err), "unable to begin transaction")
+		}
+
+		txDB := &PostgresDatabase{
+			DB:       p.DB,
+			config:   p.config,
+			tx:       tx,
+			replicas: p.replicas,
+		}
+		if err := fn(txDB); err != nil {
+			p.RollbackTransaction(tx)
+			return err
+		}
+
+		return p.CommitTransaction(tx)
+	})
+}
+
 func (p *PostgresDatabase) CommitTransaction(tx *sql.Tx) error {
 	if tx == nil {
 		return errors.New("nil transaction")
@@ -41,7 +193,7 @@ func (p *PostgresDatabase) CommitTransaction(tx *sql.Tx) error {
 			return errors.Wrap(err, "transaction already committed or rolled back")
 		}
 
-		return errors.Wrap(err, "transaction commit failed")
+		return errors.Wrap(translateError(err), "transaction commit failed")
 	}
 
 	return nil
@@ -56,80 +208,99 @@ func (p *PostgresDatabase) RollbackTransaction(tx *sql.Tx) error {
 }
 
 func (p *PostgresDatabase) ExecSql(
+	ctx context.Context,
 	tx *sql.Tx,
 	sql string,
 	args ...any,
 ) (sql.Result, error) {
+	if tx == nil {
+		tx = p.tx
+	}
+
 	if tx != nil {
-		result, err := tx.Exec(sql, args...)
+		result, err := tx.ExecContext(ctx, sql, args...)
 		if err != nil {
-			return nil, errors.Wrap(err, "unable to execute SQL")
+			return nil, errors.Wrap(translateError(err), "unable to execute SQL")
 		}
 		return result, nil
 	}
 
-	result, err := p.DB.Exec(sql, args...)
+	result, err := p.DB.ExecContext(ctx, sql, args...)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to execute SQL")
+		return nil, errors.Wrap(translateError(err), "unable to execute SQL")
 	}
 
 	return result, nil
 }
 
 func (p *PostgresDatabase) QuerySql(
+	ctx context.Context,
 	tx *sql.Tx,
 	sql string,
 	args ...any,
 ) (*sql.Rows, error) {
+	if tx == nil {
+		tx = p.tx
+	}
+
 	if tx != nil {
-		result, err := tx.Query(sql, args...)
+		result, err := tx.QueryContext(ctx, sql, args...)
 		if err != nil {
-			return nil, errors.Wrap(err, "unable to execute SQL")
+			return nil, errors.Wrap(translateError(err), "unable to execute SQL")
 		}
 		return result, nil
 	}
 
-	rows, err := p.DB.Query(sql, args...)
+	rows, err := p.DB.QueryContext(ctx, sql, args...)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to execute SQL")
+		return nil, errors.Wrap(translateError(err), "unable to execute SQL")
 	}
 	return rows, nil
 }
 
-// TODO: should check if already applied migrations match with repository ones
-func (p *PostgresDatabase) Migrate() error {
-	if err := p.ensureMigrationsTableExits(); err != nil {
-		return err
+// expectAffected turns an update or delete that matched no row into a not
+// found error about entity
+func expectAffected(result sql.Result, entity string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "unable to read affected rows")
 	}
 
-	migrations, err := ReadMigrationDir(
-		"internal/database/migrations", DefaultFileSystem{})
-	if err != nil {
-		return err
+	if affected == 0 {
+		return fmt.Errorf("%s %w", entity, database.ErrNotFound)
 	}
 
-	appliedMigrations, err := p.getAppliedMigrations()
-	if err != nil {
+	return nil
+}
+
+// Migrations are not bound by the query timeout, they can legitimately take
+// long on big tables, cancel ctx to abort them. A database migrated by a
+// newer binary is left alone with a *database.SchemaTooNewError
+func (p *PostgresDatabase) Migrate(ctx context.Context) error {
+	if err := p.ensureMigrationsTableExits(ctx); err != nil {
 		return err
 	}
 
-	tx, err := p.BeginTransaction()
+	migrations, err := KnownMigrations()
 	if err != nil {
-		return nil
+		return err
 	}
 
-	if err := p.execUpMigrations(migrations[len(appliedMigrations):]); err != nil {
+	appliedMigrations, err := p.getAppliedMigrations(ctx)
+	if err != nil {
 		return err
 	}
 
-	if err := p.CommitTransaction(tx); err != nil {
+	pending, err := pendingMigrations(migrations, appliedMigrations)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return p.execUpMigrations(ctx, pending)
 }
 
 func (p *PostgresDatabase) execUpMigrations(
+	ctx context.Context,
 	migrations []*Migration,
 ) error {
 	for _, migration := range migrations {
@@ -138,16 +309,27 @@ func (p *PostgresDatabase) execUpMigrations(
 			return err
 		}
 
-		if _, err := p.ExecSql(nil, query); err != nil {
+		if _, err := p.ExecSql(ctx, nil, query); err != nil {
 			return err
 		}
 
-		tx, err := p.BeginTransaction()
+		tx, err := p.BeginTransaction(ctx)
 		if err != nil {
 			return err
 		}
 
-		p.InsertMigration(tx, migration)
+		if hook, ok := migrationHooks[migration.FullName()]; ok {
+			if err := hook(p, ctx, tx); err != nil {
+				p.RollbackTransaction(tx)
+				return fmt.Errorf("migration %s: %w", migration.FullName(),
+					err)
+			}
+		}
+
+		if err := p.InsertMigration(ctx, tx, migration); err != nil {
+			p.RollbackTransaction(tx)
+			return err
+		}
 		if err := p.CommitTransaction(tx); err != nil {
 			return err
 		}
@@ -156,8 +338,10 @@ func (p *PostgresDatabase) execUpMigrations(
 	return nil
 }
 
-func (p *PostgresDatabase) ensureMigrationsTableExits() error {
-	if _, err := p.ExecSql(nil, "CREATE TABLE IF NOT EXISTS migrations "+
+func (p *PostgresDatabase) ensureMigrationsTableExits(
+	ctx context.Context,
+) error {
+	if _, err := p.ExecSql(ctx, nil, "CREATE TABLE IF NOT EXISTS migrations "+
 		"(name VARCHAR(255) PRIMARY KEY,"+
 		" timestamp BIGINT NOT NULL);"); err != nil {
 		return err
@@ -0,0 +1,399 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"duna/internal/database"
+	"duna/internal/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// anyValueConverter accepts every argument like the pgx driver does, so
+// slices can be passed for ANY($1)
+type anyValueConverter struct{}
+
+func (anyValueConverter) ConvertValue(v any) (driver.Value, error) {
+	return v, nil
+}
+
+func newMockPostgresDatabase(
+	t *testing.T,
+	config PostgresConfig,
+) (*PostgresDatabase, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(
+		sqlmock.ValueConverterOption(anyValueConverter{}))
+	if err != nil {
+		t.Fatalf("unexpected error creating sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &PostgresDatabase{DB: db, config: config}, mock
+}
+
+func TestWithQueryTimeout(t *testing.T) {
+	t.Run("applies default timeout", func(t *testing.T) {
+		p := &PostgresDatabase{config: PostgresConfig{queryTimeout: time.Second}}
+
+		ctx, cancel := p.withQueryTimeout(context.Background())
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatal("expected a deadline")
+		}
+		if time.Until(deadline) > time.Second {
+			t.Errorf("expected deadline within 1s, got %s", time.Until(deadline))
+		}
+	})
+
+	t.Run("keeps earlier deadline", func(t *testing.T) {
+		p := &PostgresDatabase{config: PostgresConfig{queryTimeout: time.Hour}}
+
+		parent, parentCancel := context.WithTimeout(
+			context.Background(), time.Second)
+		defer parentCancel()
+
+		ctx, cancel := p.withQueryTimeout(parent)
+		defer cancel()
+
+		parentDeadline, _ := parent.Deadline()
+		deadline, _ := ctx.Deadline()
+		if !deadline.Equal(parentDeadline) {
+			t.Errorf("expected deadline %s, got %s", parentDeadline, deadline)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		p := &PostgresDatabase{}
+
+		ctx, cancel := p.withQueryTimeout(context.Background())
+		defer cancel()
+
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("expected no deadline")
+		}
+	})
+}
+
+func TestExecSqlCancellation(t *testing.T) {
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+	mock.ExpectExec("UPDATE users").
+		WillDelayFor(time.Second).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := p.ExecSql(ctx, nil, "UPDATE users SET username = 'paul'")
+	if !errors.Is(err, sqlmock.ErrCancelled) {
+		t.Errorf("expected query to be cancelled, got %v", err)
+	}
+}
+
+func TestInsertMatchUsesQueryTimeout(t *testing.T) {
+	p, mock := newMockPostgresDatabase(
+		t, PostgresConfig{queryTimeout: 10 * time.Millisecond})
+	mock.ExpectExec("INSERT INTO matches").
+		WillDelayFor(time.Second).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	start := time.Now()
+	err := p.InsertMatch(context.Background(), models.NewMatch("uuid", 0))
+	if !errors.Is(err, sqlmock.ErrCancelled) {
+		t.Errorf("expected query to be cancelled, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected query to be aborted, took %s", time.Since(start))
+	}
+}
+
+func TestWithTxRetriesSerializationFailures(t *testing.T) {
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO matches").
+		WillReturnError(&pgconn.PgError{Code: SERIALIZATION_FAILURE})
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO matches").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	calls := 0
+	err := p.WithTx(context.Background(), func(repos database.Repos) error {
+		calls++
+		return repos.InsertMatch(context.Background(), models.NewMatch("uuid", 0))
+	})
+
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO matches").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	expected := errors.New("abort")
+	err := p.WithTx(context.Background(), func(repos database.Repos) error {
+		if err := repos.InsertMatch(
+			context.Background(), models.NewMatch("uuid", 0)); err != nil {
+			return err
+		}
+		return expected
+	})
+
+	if !errors.Is(err, expected) {
+		t.Errorf("expected %v, got %v", expected, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestListMatchesKeyset(t *testing.T) {
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+	createdAt := time.Date(2025, 7, 16, 12, 0, 0, 0, time.UTC)
+	cursor := database.EncodeCursor(database.MatchCursor{
+		CreatedAt: createdAt,
+		UUID:      "00000000-0000-4000-8000-000000000003",
+	})
+
+	inGame := models.MatchState(models.InGame)
+
+	// a limit of 1 asks for 2 rows to find out whether a next page exists
+	mock.ExpectQuery(`\(m.created_at, m.uuid\) < \(\$2, \$3\)`+
+		` ORDER BY m.created_at DESC, m.uuid DESC LIMIT 2`).
+		WithArgs(inGame, createdAt,
+			"00000000-0000-4000-8000-000000000003").
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"uuid", "match_state", "created_by_user", "created_at",
+				"finished_at", "version"}).
+			AddRow("00000000-0000-4000-8000-000000000002", models.InGame, "",
+				createdAt.Add(-time.Minute), nil, 1).
+			AddRow("00000000-0000-4000-8000-000000000001", models.InGame, "",
+				createdAt.Add(-2*time.Minute), nil, 1))
+	mock.ExpectQuery("FROM users_matches").
+		WillReturnRows(sqlmock.NewRows(
+			[]string{"match_uuid", "user_uuid", "joined_at"}))
+
+	page, err := p.ListMatches(context.Background(),
+		database.MatchFilter{State: &inGame},
+		database.PageRequest{Limit: 1, Cursor: cursor})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(page.Items) != 1 ||
+		page.Items[0].UUID != "00000000-0000-4000-8000-000000000002" {
+		t.Errorf("unexpected page items: %+v", page.Items)
+	}
+	if page.NextCursor == "" {
+		t.Error("expected a next cursor")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`50%_off\`); got != `50\%\_off\\` {
+		t.Errorf("escapeLike() = %q", got)
+	}
+}
+
+func TestNewPostgresDatabaseConfiguresPool(t *testing.T) {
+	p, err := NewPostgresDatabase(PostgresConfig{
+		host:         "localhost",
+		maxOpenConns: 3,
+		maxIdleConns: 1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.DB.Close()
+
+	if got := p.DB.Stats().MaxOpenConnections; got != 3 {
+		t.Errorf("expected 3 max open connections, got %d", got)
+	}
+}
+
+func TestPingTranslatesConnectionErrors(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("unexpected error creating sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	p := &PostgresDatabase{DB: db}
+
+	mock.ExpectPing().WillReturnError(&pgconn.PgError{Code: CANNOT_CONNECT_NOW})
+	if err := p.Ping(context.Background()); !errors.Is(
+		err, database.ErrUnavailable) {
+		t.Errorf("expected unavailable error, got %v", err)
+	}
+
+	mock.ExpectPing()
+	if err := p.Ping(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServerTime(t *testing.T) {
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+	serverTime := time.Date(2025, 7, 21, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT clock_timestamp()").
+		WillReturnRows(sqlmock.NewRows([]string{"clock_timestamp"}).
+			AddRow(serverTime))
+
+	got, err := p.ServerTime(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Equal(serverTime) {
+		t.Errorf("ServerTime() = %s, want %s", got, serverTime)
+	}
+}
+
+func TestUpdateMatchStateStaleVersion(t *testing.T) {
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+	mock.ExpectQuery(`UPDATE matches SET match_state = \$1,`+
+		` version = version \+ 1, finished_at = CASE WHEN \$1 = 2 THEN now\(\)`+
+		` ELSE finished_at END WHERE uuid = \$2 AND version = \$3`).
+		WithArgs(models.MatchState(models.Finish), "uuid", int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery("SELECT version FROM matches").
+		WithArgs("uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+
+	_, err := p.UpdateMatchState(
+		context.Background(), "uuid", 1, models.Finish)
+
+	var staleErr *database.StaleError
+	if !errors.As(err, &staleErr) || staleErr.Actual != 3 {
+		t.Errorf("expected stale error at version 3, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestAppendEventsInsertsOneStatement(t *testing.T) {
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+	mock.ExpectExec(`INSERT INTO match_events \(match_uuid,seq,actor_uuid,`+
+		`faction,action_type,payload\) VALUES \(\$1,\$2,\$3,\$4,\$5,\$6\),`+
+		`\(\$7,\$8,\$9,\$10,\$11,\$12\)`).
+		WithArgs("uuid", int64(1), nullString("actor"),
+			nullString("Harkonnen"), "spice", []byte(`{"amount":3}`),
+			"uuid", int64(2), sql.NullString{}, sql.NullString{}, "start",
+			[]byte("{}")).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err := p.AppendEvents(context.Background(),
+		models.MatchEvent{MatchUUID: "uuid", Seq: 1, ActorUUID: "actor",
+			Faction: "Harkonnen", Type: "spice",
+			Payload: []byte(`{"amount":3}`)},
+		models.MatchEvent{MatchUUID: "uuid", Seq: 2, Type: "start"},
+	)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestUpsertContentSkipsUnchangedRows(t *testing.T) {
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+	mock.ExpectExec(`INSERT INTO leaders AS t \(key,name,faction,strength\)`+
+		` VALUES \(\$1,\$2,\$3,\$4\) ON CONFLICT \(key\) DO UPDATE SET`+
+		` name = EXCLUDED.name, faction = EXCLUDED.faction,`+
+		` strength = EXCLUDED.strength WHERE \(t.name, t.faction,`+
+		` t.strength\) IS DISTINCT FROM \(EXCLUDED.name,`+
+		` EXCLUDED.faction, EXCLUDED.strength\)`).
+		WithArgs("jamis", "Jamis", "fremen", 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	written, err := p.UpsertContent(context.Background(), models.GameContent{
+		Leaders: []models.LeaderDef{
+			{Key: "jamis", Name: "Jamis", Faction: "fremen", Strength: 2},
+		},
+	})
+	if err != nil || written != 0 {
+		t.Errorf("UpsertContent() = %d, %v, want 0, nil", written, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestInspectSchemaStripsSchemaName(t *testing.T) {
+	p, mock := newMockPostgresDatabase(t, PostgresConfig{})
+	mock.ExpectQuery("FROM information_schema.tables").
+		WithArgs("scratch").
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).
+			AddRow("users_matches"))
+	mock.ExpectQuery("FROM information_schema.columns").
+		WithArgs("scratch").
+		WillReturnRows(sqlmock.NewRows([]string{"table_name", "column_name",
+			"data_type", "character_maximum_length", "is_nullable",
+			"column_default"}).
+			AddRow("users_matches", "joined_at", "timestamp with time zone",
+				nil, "NO", "clock_timestamp()"))
+	mock.ExpectQuery("FROM pg_catalog.pg_constraint").
+		WithArgs("scratch").
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "conname",
+			"pg_get_constraintdef"}).
+			AddRow("users_matches", "users_matches_match_uuid_fkey",
+				"FOREIGN KEY (match_uuid) REFERENCES scratch.matches(uuid)"+
+					" ON DELETE CASCADE"))
+	mock.ExpectQuery("FROM pg_catalog.pg_indexes").
+		WithArgs("scratch").
+		WillReturnRows(sqlmock.NewRows([]string{"tablename", "indexname",
+			"indexdef"}).
+			AddRow("users_matches", "users_matches_match_uuid_idx",
+				"CREATE INDEX users_matches_match_uuid_idx ON"+
+					" scratch.users_matches USING btree (match_uuid)"))
+
+	schema, err := p.InspectSchema(context.Background(), "scratch")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := database.Schema{
+		"table users_matches": "exists",
+		"column users_matches.joined_at": "timestamp with time zone" +
+			" not null default clock_timestamp()",
+		"constraint users_matches.users_matches_match_uuid_fkey": "FOREIGN" +
+			" KEY (match_uuid) REFERENCES matches(uuid) ON DELETE CASCADE",
+		"index users_matches.users_matches_match_uuid_idx": "CREATE INDEX" +
+			" users_matches_match_uuid_idx ON users_matches USING btree" +
+			" (match_uuid)",
+	}
+	for object, definition := range want {
+		if schema[object] != definition {
+			t.Errorf("%s = %q, want %q", object, schema[object], definition)
+		}
+	}
+	if len(schema) != len(want) {
+		t.Errorf("expected %d objects, got %v", len(want), schema)
+	}
+}
@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"context"
+	"duna/internal/config"
+	"duna/internal/database"
+)
+
+var _ database.Database = (*PostgresDatabase)(nil)
+
+func init() {
+	database.Register(database.POSTGRES_DRIVER, func(
+		ctx context.Context,
+		cfg config.DatabaseConfig,
+	) (database.Database, error) {
+		pgConfig, err := NewPostgresConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return Connect(ctx, *pgConfig)
+	})
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"duna/internal/database"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE codes we translate, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	UNIQUE_VIOLATION      = "23505"
+	EXCLUSION_VIOLATION   = "23P01"
+	CHECK_VIOLATION       = "23514"
+	NOT_NULL_VIOLATION    = "23502"
+	FOREIGN_KEY_VIOLATION = "23503"
+	SERIALIZATION_FAILURE = "40001"
+	DEADLOCK_DETECTED     = "40P01"
+	TOO_MANY_CONNECTIONS  = "53300"
+	// class 08 is connection exceptions, 57P0x are server shutdowns
+	CONNECTION_EXCEPTION_CLASS = "08"
+	ADMIN_SHUTDOWN             = "57P01"
+	CRASH_SHUTDOWN             = "57P02"
+	CANNOT_CONNECT_NOW         = "57P03"
+)
+
+// translateError maps driver errors to the database package errors, the
+// original error stays reachable through errors.As
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", database.ErrNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return translatePgError(pgErr)
+	}
+
+	// a timeout or a cancelled request says nothing about the server, and
+	// context.DeadlineExceeded would pass for a net.Error below
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var netErr net.Error
+	var connectErr *pgconn.ConnectError
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.As(err, &connectErr) ||
+		errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %w", database.ErrUnavailable, err)
+	}
+
+	return err
+}
+
+func translatePgError(pgErr *pgconn.PgError) error {
+	switch pgErr.Code {
+	case UNIQUE_VIOLATION, EXCLUSION_VIOLATION:
+		return &database.ConflictError{
+			Constraint: pgErr.ConstraintName,
+			Err:        pgErr,
+		}
+	case CHECK_VIOLATION, NOT_NULL_VIOLATION, FOREIGN_KEY_VIOLATION:
+		constraint := pgErr.ConstraintName
+		if constraint == "" {
+			// not null violations only carry the column
+			constraint = pgErr.ColumnName
+		}
+
+		return &database.InvalidError{Constraint: constraint, Err: pgErr}
+	case SERIALIZATION_FAILURE, DEADLOCK_DETECTED:
+		return fmt.Errorf("%w: %w", database.ErrSerialization, pgErr)
+	case TOO_MANY_CONNECTIONS, ADMIN_SHUTDOWN, CRASH_SHUTDOWN,
+		CANNOT_CONNECT_NOW:
+		return fmt.Errorf("%w: %w", database.ErrUnavailable, pgErr)
+	}
+
+	if strings.HasPrefix(pgErr.Code, CONNECTION_EXCEPTION_CLASS) {
+		return fmt.Errorf("%w: %w", database.ErrUnavailable, pgErr)
+	}
+
+	return pgErr
+}
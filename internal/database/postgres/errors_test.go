@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"duna/internal/database"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"no rows", sql.ErrNoRows, database.ErrNotFound},
+		{"unique", &pgconn.PgError{Code: UNIQUE_VIOLATION}, database.ErrConflict},
+		{"exclusion", &pgconn.PgError{Code: EXCLUSION_VIOLATION},
+			database.ErrConflict},
+		{"check", &pgconn.PgError{Code: CHECK_VIOLATION}, database.ErrInvalid},
+		{"not null", &pgconn.PgError{Code: NOT_NULL_VIOLATION},
+			database.ErrInvalid},
+		{"foreign key", &pgconn.PgError{Code: FOREIGN_KEY_VIOLATION},
+			database.ErrInvalid},
+		{"serialization", &pgconn.PgError{Code: SERIALIZATION_FAILURE},
+			database.ErrSerialization},
+		{"deadlock", &pgconn.PgError{Code: DEADLOCK_DETECTED},
+			database.ErrSerialization},
+		{"too many connections", &pgconn.PgError{Code: TOO_MANY_CONNECTIONS},
+			database.ErrUnavailable},
+		{"connection failure", &pgconn.PgError{Code: "08006"},
+			database.ErrUnavailable},
+		{"shutdown", &pgconn.PgError{Code: ADMIN_SHUTDOWN},
+			database.ErrUnavailable},
+		{"bad conn", driver.ErrBadConn, database.ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// errors reach translateError wrapped by the driver
+			got := translateError(pkgerrors.Wrap(tt.err, "driver"))
+			if !errors.Is(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("expected original error to be kept, got %v", got)
+			}
+		})
+	}
+
+	t.Run("context errors are kept", func(t *testing.T) {
+		for _, err := range []error{context.DeadlineExceeded,
+			context.Canceled} {
+			got := translateError(pkgerrors.Wrap(err, "driver"))
+			if !errors.Is(got, err) || errors.Is(got, database.ErrUnavailable) {
+				t.Errorf("expected %v unchanged, got %v", err, got)
+			}
+		}
+	})
+
+	t.Run("constraint name", func(t *testing.T) {
+		err := translateError(&pgconn.PgError{
+			Code:           UNIQUE_VIOLATION,
+			ConstraintName: "users_pkey",
+		})
+
+		var conflict *database.ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("expected ConflictError, got %v", err)
+		}
+		if conflict.Constraint != "users_pkey" {
+			t.Errorf("expected users_pkey, got %s", conflict.Constraint)
+		}
+	})
+
+	t.Run("not null uses column", func(t *testing.T) {
+		err := translateError(&pgconn.PgError{
+			Code:       NOT_NULL_VIOLATION,
+			ColumnName: "email",
+		})
+
+		var invalid *database.InvalidError
+		if !errors.As(err, &invalid) {
+			t.Fatalf("expected InvalidError, got %v", err)
+		}
+		if invalid.Constraint != "email" {
+			t.Errorf("expected email, got %s", invalid.Constraint)
+		}
+	})
+
+	t.Run("unknown errors pass through", func(t *testing.T) {
+		original := &pgconn.PgError{Code: "42P01"}
+		if got := translateError(original); got != original {
+			t.Errorf("expected %v, got %v", original, got)
+		}
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		if got := translateError(nil); got != nil {
+			t.Errorf("expected nil, got %v", got)
+		}
+	})
+}
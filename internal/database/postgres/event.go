@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"duna/internal/database"
+	"duna/internal/models"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	MATCH_EVENTS_TABLE    = "match_events"
+	MATCH_SNAPSHOTS_TABLE = "match_snapshots"
+)
+
+func (p *PostgresDatabase) AppendEvents(
+	ctx context.Context,
+	events ...models.MatchEvent,
+) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	// a single statement, so the batch goes in whole or not at all
+	insert := psql.Insert(MATCH_EVENTS_TABLE).Columns("match_uuid", "seq",
+		"actor_uuid", "faction", "action_type", "payload")
+	for _, event := range events {
+		payload := []byte(event.Payload)
+		if len(payload) == 0 {
+			payload = []byte("{}")
+		}
+
+		insert = insert.Values(event.MatchUUID, event.Seq,
+			nullString(event.ActorUUID), nullString(event.Faction),
+			event.Type, payload)
+	}
+
+	query, args, err := insert.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build events insert: %w", err)
+	}
+
+	if _, err := p.ExecSql(ctx, nil, query, args...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresDatabase) LoadEvents(
+	ctx context.Context,
+	matchUUID string,
+	afterSeq int64,
+) ([]models.MatchEvent, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	query, args, err := psql.
+		Select("match_uuid", "seq", "actor_uuid", "faction", "action_type",
+			"payload", "created_at").
+		From(MATCH_EVENTS_TABLE).
+		Where(sq.Eq{"match_uuid": matchUUID}).
+		Where(sq.Gt{"seq": afterSeq}).
+		OrderBy("seq").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build events query: %w", err)
+	}
+
+	rows, err := p.queryRead(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.MatchEvent
+	for rows.Next() {
+		var event models.MatchEvent
+		var actor, faction sql.NullString
+		var payload []byte
+		if err := rows.Scan(&event.MatchUUID, &event.Seq, &actor, &faction,
+			&event.Type, &payload, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event data: %w", err)
+		}
+
+		event.ActorUUID = actor.String
+		event.Faction = faction.String
+		event.Payload = payload
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query events: %w",
+			translateError(err))
+	}
+
+	return events, nil
+}
+
+func (p *PostgresDatabase) SaveSnapshot(
+	ctx context.Context,
+	snapshot models.MatchSnapshot,
+) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO %s (match_uuid, seq, state) VALUES($1, $2, $3)"+
+			" ON CONFLICT (match_uuid, seq) DO NOTHING",
+		MATCH_SNAPSHOTS_TABLE,
+	)
+
+	// a nil state is sent as NULL and fails the not null constraint
+	var state []byte
+	if len(snapshot.State) > 0 {
+		state = snapshot.State
+	}
+
+	if _, err := p.ExecSql(
+		ctx, nil, insertQuery, snapshot.MatchUUID, snapshot.Seq, state,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresDatabase) LatestSnapshot(
+	ctx context.Context,
+	matchUUID string,
+) (models.MatchSnapshot, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	query := fmt.Sprintf(
+		"SELECT match_uuid, seq, state, created_at FROM %s"+
+			" WHERE match_uuid = $1 ORDER BY seq DESC LIMIT 1",
+		MATCH_SNAPSHOTS_TABLE,
+	)
+
+	rows, err := p.queryRead(ctx, query, matchUUID)
+	if err != nil {
+		return models.MatchSnapshot{}, fmt.Errorf(
+			"failed to query snapshot: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return models.MatchSnapshot{}, fmt.Errorf(
+				"failed to query snapshot: %w", translateError(err))
+		}
+		return models.MatchSnapshot{}, fmt.Errorf(
+			"snapshot %w", database.ErrNotFound)
+	}
+
+	var snapshot models.MatchSnapshot
+	var state []byte
+	if err := rows.Scan(&snapshot.MatchUUID, &snapshot.Seq, &state,
+		&snapshot.CreatedAt); err != nil {
+		return models.MatchSnapshot{}, fmt.Errorf(
+			"failed to scan snapshot data: %w", err)
+	}
+	snapshot.State = state
+
+	return snapshot, nil
+}
+
+// nullString stores an empty string as NULL, for optional columns
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
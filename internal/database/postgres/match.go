@@ -0,0 +1,403 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"duna/internal/database"
+	"duna/internal/models"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/pkg/errors"
+)
+
+const (
+	MATCHES_TABLE       = "matches"
+	USERS_MATCHES_TABLE = "users_matches"
+)
+
+func (p *PostgresDatabase) InsertMatch(
+	ctx context.Context,
+	match models.Match,
+) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO %s (uuid, match_state, created_by_user, created_at,"+
+			" finished_at) VALUES($1, $2, $3, $4, $5)",
+		MATCHES_TABLE,
+	)
+
+	createdAt := match.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	if _, err := p.ExecSql(
+		ctx,
+		nil,
+		insertQuery,
+		match.UUID,
+		match.MatchState,
+		match.CreatedByUser,
+		createdAt,
+		sql.NullTime{Time: match.FinishedAt, Valid: !match.FinishedAt.IsZero()},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresDatabase) GetMatch(
+	ctx context.Context,
+	uuid string,
+) (models.Match, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	matches, err := p.queryMatches(
+		ctx, selectMatches().Where(sq.Eq{"m.uuid": uuid}))
+	if err != nil {
+		return models.Match{}, err
+	}
+
+	if len(matches) == 0 {
+		return models.Match{}, fmt.Errorf("match %w", database.ErrNotFound)
+	}
+
+	return matches[0], nil
+}
+
+func (p *PostgresDatabase) ListMatches(
+	ctx context.Context,
+	filter database.MatchFilter,
+	page database.PageRequest,
+) (database.Page[models.Match], error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	query := filterMatches(selectMatches(), filter)
+
+	var cursor database.MatchCursor
+	hasCursor, err := database.DecodeCursor(page.Cursor, &cursor)
+	if err != nil {
+		return database.Page[models.Match]{}, err
+	}
+	if hasCursor {
+		query = query.Where(sq.Expr(
+			"(m.created_at, m.uuid) < (?, ?)", cursor.CreatedAt, cursor.UUID))
+	}
+
+	// one extra row tells if there is a next page
+	limit := page.PageLimit()
+	matches, err := p.queryMatches(ctx, query.Limit(uint64(limit+1)))
+	if err != nil {
+		return database.Page[models.Match]{}, err
+	}
+
+	result := database.Page[models.Match]{Items: matches}
+	if len(matches) > limit {
+		result.Items = matches[:limit]
+		last := result.Items[limit-1]
+		result.NextCursor = database.EncodeCursor(database.MatchCursor{
+			CreatedAt: last.CreatedAt,
+			UUID:      last.UUID,
+		})
+	}
+
+	return result, nil
+}
+
+func (p *PostgresDatabase) MatchesForUser(
+	ctx context.Context,
+	userUUID string,
+) ([]models.Match, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	return p.queryMatches(ctx, filterMatches(
+		selectMatches(), database.MatchFilter{Player: userUUID}))
+}
+
+func (p *PostgresDatabase) UpdateMatchState(
+	ctx context.Context,
+	uuid string,
+	version int64,
+	state models.MatchState,
+) (int64, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	updateQuery := fmt.Sprintf(
+		"UPDATE %s SET match_state = $1, version = version + 1,"+
+			" finished_at = CASE WHEN $1 = %d THEN now() ELSE finished_at END"+
+			" WHERE uuid = $2 AND version = $3 RETURNING version",
+		MATCHES_TABLE, models.Finish,
+	)
+
+	newVersion, found, err := p.queryVersion(
+		ctx, updateQuery, state, uuid, version)
+	if err != nil || found {
+		return newVersion, err
+	}
+
+	// nothing updated, tell a missing match from a stale version
+	selectQuery := fmt.Sprintf(
+		"SELECT version FROM %s WHERE uuid = $1", MATCHES_TABLE)
+
+	actual, found, err := p.queryVersion(ctx, selectQuery, uuid)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("match %w", database.ErrNotFound)
+	}
+
+	return 0, &database.StaleError{
+		Entity:   "match",
+		Expected: version,
+		Actual:   actual,
+	}
+}
+
+// queryVersion runs a query returning at most one version on the primary
+func (p *PostgresDatabase) queryVersion(
+	ctx context.Context,
+	query string,
+	args ...any,
+) (int64, bool, error) {
+	rows, err := p.QuerySql(ctx, nil, query, args...)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	var version int64
+	found := rows.Next()
+	if found {
+		if err := rows.Scan(&version); err != nil {
+			return 0, false, fmt.Errorf("failed to scan match version: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, false, errors.Wrap(translateError(err),
+			"unable to execute SQL")
+	}
+
+	return version, found, nil
+}
+
+func (p *PostgresDatabase) DeleteMatch(ctx context.Context, uuid string) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	// seats go away through ON DELETE CASCADE
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE uuid = $1", MATCHES_TABLE)
+
+	result, err := p.ExecSql(ctx, nil, deleteQuery, uuid)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, "match")
+}
+
+func (p *PostgresDatabase) AddPlayer(
+	ctx context.Context,
+	matchUUID, userUUID string,
+) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO %s (match_uuid, user_uuid) VALUES($1, $2)",
+		USERS_MATCHES_TABLE,
+	)
+
+	if _, err := p.ExecSql(
+		ctx, nil, insertQuery, matchUUID, userUUID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PostgresDatabase) RemovePlayer(
+	ctx context.Context,
+	matchUUID, userUUID string,
+) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	deleteQuery := fmt.Sprintf(
+		"DELETE FROM %s WHERE match_uuid = $1 AND user_uuid = $2",
+		USERS_MATCHES_TABLE,
+	)
+
+	result, err := p.ExecSql(ctx, nil, deleteQuery, matchUUID, userUUID)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, "player")
+}
+
+func (p *PostgresDatabase) PlayersInMatch(
+	ctx context.Context,
+	matchUUID string,
+) ([]models.Seat, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	seats, err := p.querySeats(ctx, []string{matchUUID})
+	if err != nil {
+		return nil, err
+	}
+
+	return seats[matchUUID], nil
+}
+
+// selectMatches starts a query over matches, aliased m, newest first. The
+// order must stay in sync with database.MatchCursor
+func selectMatches() sq.SelectBuilder {
+	return psql.
+		Select("m.uuid", "m.match_state", "m.created_by_user", "m.created_at",
+			"m.finished_at", "m.version").
+		From(MATCHES_TABLE+" m").
+		OrderBy("m.created_at DESC", "m.uuid DESC")
+}
+
+func filterMatches(
+	query sq.SelectBuilder,
+	filter database.MatchFilter,
+) sq.SelectBuilder {
+	if filter.State != nil {
+		query = query.Where(sq.Eq{"m.match_state": *filter.State})
+	}
+
+	if filter.CreatedByUser != "" {
+		query = query.Where(sq.Eq{"m.created_by_user": filter.CreatedByUser})
+	}
+
+	if filter.Player != "" {
+		query = query.Where(sq.Expr(fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM %s um"+
+				" WHERE um.match_uuid = m.uuid AND um.user_uuid = ?)",
+			USERS_MATCHES_TABLE), filter.Player))
+	}
+
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where(sq.Gt{"m.created_at": filter.CreatedAfter})
+	}
+
+	if !filter.CreatedBefore.IsZero() {
+		query = query.Where(sq.Lt{"m.created_at": filter.CreatedBefore})
+	}
+
+	if !filter.FinishedBefore.IsZero() {
+		query = query.Where(sq.Lt{"m.finished_at": filter.FinishedBefore})
+	}
+
+	if filter.OpenSeats {
+		query = query.Where(sq.Expr(fmt.Sprintf(
+			"(SELECT count(*) FROM %s um WHERE um.match_uuid = m.uuid) < ?",
+			USERS_MATCHES_TABLE), models.MAX_PLAYERS))
+	}
+
+	return query
+}
+
+// queryMatches runs a query built from selectMatches and loads the seats of
+// the matches it returns
+func (p *PostgresDatabase) queryMatches(
+	ctx context.Context,
+	builder sq.SelectBuilder,
+) ([]models.Match, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build matches query: %w", err)
+	}
+
+	rows, err := p.queryRead(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query matches: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []models.Match
+	var uuids []string
+	for rows.Next() {
+		var match models.Match
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&match.UUID, &match.MatchState,
+			&match.CreatedByUser, &match.CreatedAt, &finishedAt,
+			&match.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan match data: %w", err)
+		}
+		match.FinishedAt = finishedAt.Time
+
+		matches = append(matches, match)
+		uuids = append(uuids, match.UUID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query matches: %w",
+			translateError(err))
+	}
+
+	if len(matches) == 0 {
+		return matches, nil
+	}
+
+	seats, err := p.querySeats(ctx, uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range matches {
+		matches[i].Seats = seats[matches[i].UUID]
+	}
+
+	return matches, nil
+}
+
+// querySeats returns the seats of every given match keyed by match uuid
+func (p *PostgresDatabase) querySeats(
+	ctx context.Context,
+	matchUUIDs []string,
+) (map[string][]models.Seat, error) {
+	query, args, err := psql.
+		Select("match_uuid", "user_uuid", "joined_at").
+		From(USERS_MATCHES_TABLE).
+		Where("match_uuid = ANY(?::uuid[])", matchUUIDs).
+		OrderBy("joined_at", "user_uuid").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build seats query: %w", err)
+	}
+
+	rows, err := p.queryRead(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query seats: %w", err)
+	}
+	defer rows.Close()
+
+	seats := map[string][]models.Seat{}
+	for rows.Next() {
+		var matchUUID string
+		var seat models.Seat
+		if err := rows.Scan(
+			&matchUUID, &seat.UserUUID, &seat.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan seat data: %w", err)
+		}
+
+		seats[matchUUID] = append(seats[matchUUID], seat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query seats: %w", translateError(err))
+	}
+
+	return seats, nil
+}
@@ -1,27 +1,114 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"duna/internal/database"
+	"duna/internal/database/migrations"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
 const MIGRATIONS_TABLE = "migrations"
 
-func (p *PostgresDatabase) getAppliedMigrations() ([]*Migration, error) {
+var _ database.SchemaVersioner = (*PostgresDatabase)(nil)
+
+// KnownMigrations returns the migrations embedded in the binary, oldest
+// first
+func KnownMigrations() ([]*Migration, error) {
+	return ReadMigrationDir(".", migrations.FS)
+}
+
+// KnownSchemaVersion is the schema version the binary migrates to
+func KnownSchemaVersion() (int64, error) {
+	known, err := KnownMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	return schemaVersion(known), nil
+}
+
+// schemaVersion expects migrations oldest first
+func schemaVersion(migrations []*Migration) int64 {
+	if len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].timestamp
+}
+
+// SchemaVersion reads the latest applied migration, without creating the
+// migrations table
+func (p *PostgresDatabase) SchemaVersion(ctx context.Context) (int64, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	if err := p.DB.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL",
+		MIGRATIONS_TABLE).Scan(&exists); err != nil {
+		return 0, errors.Wrap(translateError(err),
+			"unable to read the schema version")
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int64
+	if err := p.DB.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT COALESCE(MAX(timestamp), 0) FROM %s", MIGRATIONS_TABLE,
+	)).Scan(&version); err != nil {
+		return 0, errors.Wrap(translateError(err),
+			"unable to read the schema version")
+	}
+
+	return version, nil
+}
+
+// pendingMigrations returns the known migrations not applied yet, both
+// oldest first
+func pendingMigrations(known, applied []*Migration) ([]*Migration, error) {
+	if version := schemaVersion(applied); version > schemaVersion(known) {
+		return nil, &database.SchemaTooNewError{
+			Applied: version,
+			Known:   schemaVersion(known),
+		}
+	}
+
+	done := map[string]bool{}
+	for _, migration := range applied {
+		done[migration.FullName()] = true
+	}
+
+	var pending []*Migration
+	for _, migration := range known {
+		if !done[migration.FullName()] {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (p *PostgresDatabase) getAppliedMigrations(
+	ctx context.Context,
+) ([]*Migration, error) {
 	selectQuery := fmt.Sprintf(
 		"SELECT name, timestamp FROM %s ORDER BY timestamp",
 		MIGRATIONS_TABLE,
 	)
 
-	rows, err := p.QuerySql(nil, selectQuery)
+	rows, err := p.QuerySql(ctx, nil, selectQuery)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var migrations []*Migration
 	for rows.Next() {
@@ -38,13 +125,18 @@ func (p *PostgresDatabase) getAppliedMigrations() ([]*Migration, error) {
 	return migrations, nil
 }
 
-func (p *PostgresDatabase) InsertMigration(tx *sql.Tx, migration *Migration) error {
+func (p *PostgresDatabase) InsertMigration(
+	ctx context.Context,
+	tx *sql.Tx,
+	migration *Migration,
+) error {
 	insertMigrationQuery := fmt.Sprintf(
 		"INSERT INTO %s (name, timestamp) VALUES($1, $2)",
 		MIGRATIONS_TABLE,
 	)
 
 	if _, err := p.ExecSql(
+		ctx,
 		tx,
 		insertMigrationQuery,
 		migration.name,
@@ -1,9 +1,11 @@
 package postgres
 
 import (
+	"duna/internal/database"
 	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"testing"
 )
@@ -250,7 +252,7 @@ func TestReadMigrationDir(t *testing.T) {
 			}
 
 			if tt.expectError != nil && !errors.Is(err, tt.expectError) {
-					t.Errorf("ReadMigrationDir() error = %v, expectError %v", err, tt.expectError)
+				t.Errorf("ReadMigrationDir() error = %v, expectError %v", err, tt.expectError)
 			}
 
 			if len(got) != len(tt.want) {
@@ -290,3 +292,68 @@ func TestReadMigrationDir(t *testing.T) {
 		}
 	})
 }
+
+func TestPendingMigrations(t *testing.T) {
+	known := []*Migration{
+		NewMigration("create-table", 100, "", nil),
+		NewMigration("alter-table", 200, "", nil),
+		NewMigration("add-index", 300, "", nil),
+	}
+
+	tests := []struct {
+		name    string
+		applied []*Migration
+		want    []string
+		wantErr bool
+	}{
+		{"fresh database", nil,
+			[]string{"100-create-table", "200-alter-table", "300-add-index"},
+			false},
+		{"behind", known[:1],
+			[]string{"200-alter-table", "300-add-index"}, false},
+		{"up to date", known, nil, false},
+		{"newer", append(known[:3:3], NewMigration("drop-table", 400, "", nil)),
+			nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending, err := pendingMigrations(known, tt.applied)
+			if tt.wantErr {
+				var tooNew *database.SchemaTooNewError
+				if !errors.As(err, &tooNew) || tooNew.Applied != 400 ||
+					tooNew.Known != 300 {
+					t.Fatalf("expected a schema too new error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, migration := range pending {
+				got = append(got, migration.FullName())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pendingMigrations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKnownMigrationsAreEmbedded(t *testing.T) {
+	known, err := KnownMigrations()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(known) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	for _, migration := range known {
+		if _, err := migration.GetUpQuery(); err != nil {
+			t.Errorf("%s: %v", migration.FullName(), err)
+		}
+	}
+}
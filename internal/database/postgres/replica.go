@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"duna/internal/database"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// REPLICA_COOLDOWN is how long a replica that could not be reached is left
+// out, reads go to the other replicas or the primary meanwhile
+const REPLICA_COOLDOWN = 10 * time.Second
+
+// replicaSet spreads reads over the replicas round robin. It is shared by
+// the copies WithTx hands out
+type replicaSet struct {
+	dbs  []*sql.DB
+	next atomic.Uint64
+	// downUntil holds, per replica, the unix nano time it may be used again
+	downUntil []atomic.Int64
+}
+
+func newReplicaSet(dbs []*sql.DB) *replicaSet {
+	return &replicaSet{dbs: dbs, downUntil: make([]atomic.Int64, len(dbs))}
+}
+
+// pick returns the next available replica, false when every replica is
+// cooling down
+func (r *replicaSet) pick() (int, *sql.DB, bool) {
+	if r == nil {
+		return 0, nil, false
+	}
+
+	now := time.Now().UnixNano()
+	for range r.dbs {
+		i := int(r.next.Add(1) % uint64(len(r.dbs)))
+		if r.downUntil[i].Load() <= now {
+			return i, r.dbs[i], true
+		}
+	}
+
+	return 0, nil, false
+}
+
+func (r *replicaSet) markDown(i int) {
+	r.downUntil[i].Store(time.Now().Add(REPLICA_COOLDOWN).UnixNano())
+}
+
+func (r *replicaSet) close() {
+	if r == nil {
+		return
+	}
+
+	for _, db := range r.dbs {
+		db.Close()
+	}
+}
+
+// queryRead runs a read only query on a replica. It stays on the primary
+// inside transactions and for contexts marked with
+// database.WithPrimaryReads, and falls back to it when the replica can't
+// be reached
+func (p *PostgresDatabase) queryRead(
+	ctx context.Context,
+	query string,
+	args ...any,
+) (*sql.Rows, error) {
+	if p.tx != nil || database.PrimaryReads(ctx) {
+		return p.QuerySql(ctx, nil, query, args...)
+	}
+
+	i, replica, ok := p.replicas.pick()
+	if !ok {
+		return p.QuerySql(ctx, nil, query, args...)
+	}
+
+	rows, err := replica.QueryContext(ctx, query, args...)
+	if err == nil {
+		return rows, nil
+	}
+
+	err = translateError(err)
+	if !errors.Is(err, database.ErrUnavailable) {
+		return nil, errors.Wrap(err, "unable to execute SQL on replica")
+	}
+
+	p.replicas.markDown(i)
+	return p.QuerySql(ctx, nil, query, args...)
+}
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"duna/internal/database"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func newMockReplicatedDatabase(
+	t *testing.T,
+) (*PostgresDatabase, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	p, primary := newMockPostgresDatabase(t, PostgresConfig{})
+
+	replicaDB, replica, err := sqlmock.New(
+		sqlmock.ValueConverterOption(anyValueConverter{}))
+	if err != nil {
+		t.Fatalf("unexpected error creating sqlmock: %v", err)
+	}
+	t.Cleanup(func() { replicaDB.Close() })
+	p.replicas = newReplicaSet([]*sql.DB{replicaDB})
+
+	return p, primary, replica
+}
+
+func expectMatchQuery(mock sqlmock.Sqlmock) *sqlmock.ExpectedQuery {
+	return mock.ExpectQuery("FROM matches m")
+}
+
+func emptyMatchRows() *sqlmock.Rows {
+	return sqlmock.NewRows(
+		[]string{"uuid", "match_state", "created_by_user", "created_at",
+			"version"})
+}
+
+func TestReadsGoToReplica(t *testing.T) {
+	p, primary, replica := newMockReplicatedDatabase(t)
+	expectMatchQuery(replica).WillReturnRows(emptyMatchRows())
+
+	if _, err := p.ListMatches(context.Background(),
+		database.MatchFilter{}, database.PageRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+}
+
+func TestPrimaryReads(t *testing.T) {
+	p, primary, replica := newMockReplicatedDatabase(t)
+	expectMatchQuery(primary).WillReturnRows(emptyMatchRows())
+
+	ctx := database.WithPrimaryReads(context.Background())
+	if _, err := p.ListMatches(
+		ctx, database.MatchFilter{}, database.PageRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+}
+
+func TestReadsInTransactionStayOnPrimary(t *testing.T) {
+	p, primary, replica := newMockReplicatedDatabase(t)
+	primary.ExpectBegin()
+	expectMatchQuery(primary).WillReturnRows(emptyMatchRows())
+	primary.ExpectCommit()
+
+	err := p.WithTx(context.Background(), func(repos database.Repos) error {
+		_, err := repos.ListMatches(context.Background(),
+			database.MatchFilter{}, database.PageRequest{})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+}
+
+func TestUnavailableReplicaFallsBackToPrimary(t *testing.T) {
+	p, primary, replica := newMockReplicatedDatabase(t)
+	expectMatchQuery(replica).WillReturnError(
+		&pgconn.PgError{Code: CANNOT_CONNECT_NOW})
+	// the first read falls back, the second skips the cooling replica
+	expectMatchQuery(primary).WillReturnRows(emptyMatchRows())
+	expectMatchQuery(primary).WillReturnRows(emptyMatchRows())
+
+	for range 2 {
+		if _, err := p.ListMatches(context.Background(),
+			database.MatchFilter{}, database.PageRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+}
+
+func TestTimedOutReplicaReadStaysInRotation(t *testing.T) {
+	p, primary, replica := newMockReplicatedDatabase(t)
+	expectMatchQuery(replica).WillReturnError(context.DeadlineExceeded)
+	expectMatchQuery(replica).WillReturnRows(emptyMatchRows())
+
+	_, err := p.ListMatches(context.Background(), database.MatchFilter{},
+		database.PageRequest{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline error, got %v", err)
+	}
+
+	// no retry on the primary and the replica serves the next read
+	if _, err := p.ListMatches(context.Background(),
+		database.MatchFilter{}, database.PageRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+}
+
+func TestReplicaURLsInheritPrimarySettings(t *testing.T) {
+	cfg := testDatabaseConfig(t)
+	cfg.User = "duna"
+	cfg.Password = "secret"
+	cfg.Name = "duna"
+	cfg.ReplicaURLs = "postgres://replica-1:6432, postgres://ro@replica-2/"
+
+	c, err := NewPostgresConfig(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(c.replicas) != 2 {
+		t.Fatalf("expected 2 replicas, got %d", len(c.replicas))
+	}
+
+	first, second := c.replicas[0], c.replicas[1]
+	if first.host != "replica-1" || first.port != 6432 ||
+		first.user != "duna" || first.password != "secret" ||
+		first.dbName != "duna" {
+		t.Errorf("unexpected first replica %+v", first)
+	}
+	if second.host != "replica-2" || second.port != 5432 ||
+		second.user != "ro" || second.password != "secret" {
+		t.Errorf("unexpected second replica %+v", second)
+	}
+	// a replica is a connection of its own, not another primary
+	for i, replica := range c.replicas {
+		if replica.replicas != nil {
+			t.Errorf("expected replica %d to have no replicas, got %d", i+1,
+				len(replica.replicas))
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"duna/internal/database"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SCRATCH_SCHEMA_PREFIX names the throwaway schema CheckSchema migrates,
+// it only lives inside a transaction that is always rolled back
+const SCRATCH_SCHEMA_PREFIX = "duna_schema_check_"
+
+var _ database.SchemaChecker = (*PostgresDatabase)(nil)
+
+// schema introspection, every query takes the schema name as $1
+const (
+	tablesQuery = "SELECT table_name FROM information_schema.tables" +
+		" WHERE table_schema = $1 AND table_type = 'BASE TABLE'"
+	columnsQuery = "SELECT table_name, column_name, data_type," +
+		" character_maximum_length, is_nullable, column_default" +
+		" FROM information_schema.columns WHERE table_schema = $1"
+	constraintsQuery = "SELECT cl.relname, co.conname," +
+		" pg_get_constraintdef(co.oid)" +
+		" FROM pg_catalog.pg_constraint co" +
+		" JOIN pg_catalog.pg_class cl ON cl.oid = co.conrelid" +
+		" JOIN pg_catalog.pg_namespace n ON n.oid = cl.relnamespace" +
+		" WHERE n.nspname = $1"
+	indexesQuery = "SELECT tablename, indexname, indexdef" +
+		" FROM pg_catalog.pg_indexes WHERE schemaname = $1"
+)
+
+// CheckSchema migrates a scratch schema from nothing and compares it with
+// the current schema, migrations not applied yet are reported too
+func (p *PostgresDatabase) CheckSchema(
+	ctx context.Context,
+) ([]database.SchemaDifference, error) {
+	migrations, err := KnownMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var live string
+	if err := p.DB.QueryRowContext(
+		ctx, "SELECT current_schema()").Scan(&live); err != nil {
+		return nil, errors.Wrap(translateError(err),
+			"unable to read the current schema")
+	}
+
+	actual, err := p.InspectSchema(ctx, live)
+	if err != nil {
+		return nil, err
+	}
+
+	expected, err := p.migratedSchema(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range migrations {
+		expected.Add(database.SCHEMA_MIGRATION, migration.FullName(), "applied")
+	}
+	if _, ok := actual[database.SCHEMA_TABLE+" "+MIGRATIONS_TABLE]; ok {
+		applied, err := p.getAppliedMigrations(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, migration := range applied {
+			actual.Add(database.SCHEMA_MIGRATION, migration.FullName(),
+				"applied")
+		}
+	}
+
+	return database.DiffSchemas(expected, actual), nil
+}
+
+// migratedSchema runs every migration in a scratch schema and inspects the
+// result. The transaction is rolled back, which drops the scratch schema
+func (p *PostgresDatabase) migratedSchema(
+	ctx context.Context,
+	migrations []*Migration,
+) (database.Schema, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	scratch := SCRATCH_SCHEMA_PREFIX + hex.EncodeToString(suffix)
+
+	tx, err := p.BeginTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.RollbackTransaction(tx)
+
+	txDB := &PostgresDatabase{DB: p.DB, config: p.config, tx: tx}
+
+	// unqualified names in the migrations resolve to the scratch schema
+	for _, query := range []string{
+		"CREATE SCHEMA " + scratch,
+		"SET LOCAL search_path TO " + scratch,
+	} {
+		if _, err := txDB.ExecSql(ctx, nil, query); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := txDB.ensureMigrationsTableExits(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, migration := range migrations {
+		query, err := migration.GetUpQuery()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := txDB.ExecSql(ctx, nil, query); err != nil {
+			return nil, errors.Wrapf(err, "migration %s failed on a scratch"+
+				" schema", migration.FullName())
+		}
+	}
+
+	return txDB.InspectSchema(ctx, scratch)
+}
+
+// InspectSchema reads the tables, columns, constraints and indexes of a
+// schema. Definitions are stripped of the schema name so two schemas built
+// by the same statements compare equal
+func (p *PostgresDatabase) InspectSchema(
+	ctx context.Context,
+	name string,
+) (database.Schema, error) {
+	schema := database.Schema{}
+	unqualify := strings.NewReplacer(
+		name+".", "", `"`+name+`".`, "").Replace
+
+	err := p.inspect(ctx, tablesQuery, name, func(rows *sql.Rows) error {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return err
+		}
+
+		schema.Add(database.SCHEMA_TABLE, table, "exists")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.inspect(ctx, columnsQuery, name, func(rows *sql.Rows) error {
+		var table, column, dataType, nullable string
+		var length sql.NullInt64
+		var columnDefault sql.NullString
+		if err := rows.Scan(&table, &column, &dataType, &length, &nullable,
+			&columnDefault); err != nil {
+			return err
+		}
+
+		definition := dataType
+		if length.Valid {
+			definition += fmt.Sprintf("(%d)", length.Int64)
+		}
+		if nullable == "NO" {
+			definition += " not null"
+		}
+		if columnDefault.Valid {
+			definition += " default " + unqualify(columnDefault.String)
+		}
+
+		schema.Add(database.SCHEMA_COLUMN, table+"."+column, definition)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.inspect(ctx, constraintsQuery, name, func(rows *sql.Rows) error {
+		var table, constraint, definition string
+		if err := rows.Scan(&table, &constraint, &definition); err != nil {
+			return err
+		}
+
+		schema.Add(database.SCHEMA_CONSTRAINT, table+"."+constraint,
+			unqualify(definition))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.inspect(ctx, indexesQuery, name, func(rows *sql.Rows) error {
+		var table, index, definition string
+		if err := rows.Scan(&table, &index, &definition); err != nil {
+			return err
+		}
+
+		schema.Add(database.SCHEMA_INDEX, table+"."+index,
+			unqualify(definition))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// inspect runs an introspection query on the primary, replicas could lag
+// behind a hotfix
+func (p *PostgresDatabase) inspect(
+	ctx context.Context,
+	query string,
+	schema string,
+	scan func(rows *sql.Rows) error,
+) error {
+	rows, err := p.QuerySql(ctx, nil, query, schema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return fmt.Errorf("failed to scan schema: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(translateError(err), "unable to inspect schema")
+	}
+
+	return nil
+}
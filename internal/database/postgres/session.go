@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"duna/internal/database"
+	"duna/internal/models"
+	"fmt"
+	"time"
+)
+
+const SESSIONS_TABLE = "sessions"
+
+func (p *PostgresDatabase) InsertSession(
+	ctx context.Context,
+	session models.Session,
+) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	createdAt := session.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	insertQuery := fmt.Sprintf(
+		"INSERT INTO %s (token_hash, user_uuid, csrf_token, created_at,"+
+			" expires_at) VALUES($1, $2, $3, $4, $5)",
+		SESSIONS_TABLE,
+	)
+
+	if _, err := p.ExecSql(
+		ctx,
+		nil,
+		insertQuery,
+		session.TokenHash,
+		session.UserUUID,
+		session.CSRFToken,
+		createdAt,
+		session.ExpiresAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetSession reads from the primary, a replica may not have the session of
+// a user who just logged in yet
+func (p *PostgresDatabase) GetSession(
+	ctx context.Context,
+	tokenHash string,
+) (models.Session, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	query := fmt.Sprintf(
+		"SELECT token_hash, user_uuid, csrf_token, created_at, expires_at"+
+			" FROM %s WHERE token_hash = $1",
+		SESSIONS_TABLE,
+	)
+
+	rows, err := p.QuerySql(ctx, nil, query, tokenHash)
+	if err != nil {
+		return models.Session{}, fmt.Errorf("failed to query session: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return models.Session{}, fmt.Errorf(
+				"failed to query session: %w", translateError(err))
+		}
+		return models.Session{}, fmt.Errorf("session %w", database.ErrNotFound)
+	}
+
+	return scanSession(rows)
+}
+
+func (p *PostgresDatabase) DeleteSession(
+	ctx context.Context,
+	tokenHash string,
+) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	deleteQuery := fmt.Sprintf(
+		"DELETE FROM %s WHERE token_hash = $1", SESSIONS_TABLE)
+
+	result, err := p.ExecSql(ctx, nil, deleteQuery, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, "session")
+}
+
+func (p *PostgresDatabase) ListUserSessions(
+	ctx context.Context,
+	userUUID string,
+	now time.Time,
+) ([]models.Session, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	query := fmt.Sprintf(
+		"SELECT token_hash, user_uuid, csrf_token, created_at, expires_at"+
+			" FROM %s WHERE user_uuid = $1 AND expires_at > $2"+
+			" ORDER BY created_at DESC",
+		SESSIONS_TABLE,
+	)
+
+	rows, err := p.QuerySql(ctx, nil, query, userUUID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w",
+			translateError(err))
+	}
+
+	return sessions, nil
+}
+
+func (p *PostgresDatabase) DeleteUserSessions(
+	ctx context.Context,
+	userUUID string,
+) (int, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	deleteQuery := fmt.Sprintf(
+		"DELETE FROM %s WHERE user_uuid = $1", SESSIONS_TABLE)
+
+	result, err := p.ExecSql(ctx, nil, deleteQuery, userUUID)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("unable to read affected rows: %w", err)
+	}
+
+	return int(deleted), nil
+}
+
+func scanSession(rows *sql.Rows) (models.Session, error) {
+	var session models.Session
+	if err := rows.Scan(&session.TokenHash, &session.UserUUID,
+		&session.CSRFToken, &session.CreatedAt,
+		&session.ExpiresAt); err != nil {
+		return models.Session{}, fmt.Errorf(
+			"failed to scan session data: %w", err)
+	}
+
+	return session, nil
+}
@@ -1,25 +1,51 @@
 package postgres
 
 import (
-	"duna/internal/models"
+	"context"
+	"database/sql"
+	"duna/internal/database"
 	"duna/internal/hash"
+	"duna/internal/models"
 	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
 )
 
 const USERS_TABLE = "users"
 
-func (p *PostgresDatabase) InsertUser(user models.User) error {
+func (p *PostgresDatabase) InsertUser(
+	ctx context.Context,
+	user models.User,
+) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	role := user.Role
+	if role == "" {
+		// the column default
+		role = models.PLAYER_ROLE
+	}
+
 	insertQuery := fmt.Sprintf(
-		"INSERT INTO %s (uuid, username, email, password) VALUES($1, $2, $3, $4)",
+		"INSERT INTO %s (uuid, username, username_canonical, email,"+
+			" email_canonical, password, role, disabled)"+
+			" VALUES($1, $2, $3, $4, $5, $6, $7, $8)",
 		USERS_TABLE,
 	)
 
 	if _, err := p.ExecSql(
+		ctx,
 		nil,
 		insertQuery,
 		user.UUID,
 		user.Username,
+		user.Username.Canonical(),
 		user.Email,
+		user.Email.Canonical(),
+		user.Password().Hashed(),
+		role,
+		user.Disabled,
 	); err != nil {
 		return err
 	}
@@ -27,41 +53,207 @@ func (p *PostgresDatabase) InsertUser(user models.User) error {
 	return nil
 }
 
-func (p *PostgresDatabase) GetUserByUsername(
+func (p *PostgresDatabase) GetUserByUsername(ctx context.Context,
 	queryUsername string, hash hash.HashStrategy) (models.User, error) {
+	return p.getUserBy(ctx,
+		"username_canonical", models.CanonicalUsername(queryUsername), hash)
+}
+
+func (p *PostgresDatabase) GetUserByEmail(ctx context.Context,
+	queryEmail string, hash hash.HashStrategy) (models.User, error) {
+	return p.getUserBy(ctx, "email_canonical", models.CanonicalEmail(queryEmail), hash)
+}
+
+func (p *PostgresDatabase) GetUserByUUID(ctx context.Context,
+	queryUUID string, hash hash.HashStrategy) (models.User, error) {
+	return p.getUserBy(ctx, "uuid", queryUUID, hash)
+}
+
+func (p *PostgresDatabase) getUserBy(ctx context.Context,
+	column, value string, hash hash.HashStrategy) (models.User, error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
 	query := fmt.Sprintf(
-		"SELECT uuid, username, email, password FROM %s WHERE username = $1 LIMIT 1",
+		"SELECT uuid, username, email, password, role, disabled FROM %s"+
+			" WHERE %s = $1 LIMIT 1",
 		USERS_TABLE,
+		column,
 	)
 
-	rows, err := p.QuerySql(nil, query, queryUsername)
+	rows, err := p.queryRead(ctx, query, value)
 	if err != nil {
 		return models.User{}, fmt.Errorf("failed to query user: %w", err)
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
-		return models.User{}, fmt.Errorf("user not found")
+		if err := rows.Err(); err != nil {
+			return models.User{}, fmt.Errorf("failed to query user: %w",
+				translateError(err))
+		}
+		return models.User{}, fmt.Errorf("user %w", database.ErrNotFound)
 	}
 
+	return scanUser(rows, hash)
+}
+
+// scanUser reads the columns uuid, username, email, password, role and
+// disabled, in that order, followed by extra
+func scanUser(
+	rows *sql.Rows,
+	hash hash.HashStrategy,
+	extra ...any,
+) (models.User, error) {
 	var (
 		uuid     string
 		username string
 		email    string
 		password string
+		role     string
+		disabled bool
 	)
 
-	if err := rows.Scan(&uuid, &username, &email, &password); err != nil {
+	if err := rows.Scan(append([]any{&uuid, &username, &email, &password,
+		&role, &disabled}, extra...)...); err != nil {
 		return models.User{}, fmt.Errorf("failed to scan user data: %w", err)
 	}
 
 	// assumes password in database is already hashed
-	User, err := models.NewUserFromPrimitives(
+	user, err := models.NewUserFromPrimitives(
 		uuid, username, email, password, true, hash)
 	// errors if is a database error
 	if err != nil {
 		return models.User{}, fmt.Errorf("invalid data in database: %w", err)
 	}
+	user.Role = models.Role(role)
+	user.Disabled = disabled
+
+	return user, nil
+}
+
+func (p *PostgresDatabase) ListUsers(
+	ctx context.Context,
+	filter database.UserFilter,
+	page database.PageRequest,
+	hash hash.HashStrategy,
+) (database.Page[models.User], error) {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	// the order must stay in sync with database.UserCursor
+	builder := psql.
+		Select("uuid", "username", "email", "password", "role", "disabled",
+			"username_canonical").
+		From(USERS_TABLE).
+		OrderBy("username_canonical")
+
+	if filter.UsernamePrefix != "" {
+		prefix := models.CanonicalUsername(filter.UsernamePrefix)
+		builder = builder.Where(
+			sq.Like{"username_canonical": escapeLike(prefix) + "%"})
+	}
+
+	var cursor database.UserCursor
+	hasCursor, err := database.DecodeCursor(page.Cursor, &cursor)
+	if err != nil {
+		return database.Page[models.User]{}, err
+	}
+	if hasCursor {
+		builder = builder.Where(
+			sq.Gt{"username_canonical": cursor.UsernameCanonical})
+	}
+
+	// one extra row tells if there is a next page
+	limit := page.PageLimit()
+	query, args, err := builder.Limit(uint64(limit + 1)).ToSql()
+	if err != nil {
+		return database.Page[models.User]{},
+			fmt.Errorf("failed to build users query: %w", err)
+	}
+
+	rows, err := p.queryRead(ctx, query, args...)
+	if err != nil {
+		return database.Page[models.User]{},
+			fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	var lastCanonical string
+	for rows.Next() {
+		if len(users) == limit {
+			return database.Page[models.User]{
+				Items: users,
+				NextCursor: database.EncodeCursor(
+					database.UserCursor{UsernameCanonical: lastCanonical}),
+			}, nil
+		}
+
+		user, err := scanUser(rows, hash, &lastCanonical)
+		if err != nil {
+			return database.Page[models.User]{}, err
+		}
+
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return database.Page[models.User]{},
+			fmt.Errorf("failed to query users: %w", translateError(err))
+	}
+
+	return database.Page[models.User]{Items: users}, nil
+}
+
+func (p *PostgresDatabase) UpdateUserPassword(
+	ctx context.Context,
+	uuid string,
+	password models.Password,
+) error {
+	return p.updateUser(ctx, uuid, sq.Eq{"password": password.Hashed()})
+}
+
+func (p *PostgresDatabase) SetUserDisabled(
+	ctx context.Context,
+	uuid string,
+	disabled bool,
+) error {
+	return p.updateUser(ctx, uuid, sq.Eq{"disabled": disabled})
+}
+
+func (p *PostgresDatabase) SetUserRole(
+	ctx context.Context,
+	uuid string,
+	role models.Role,
+) error {
+	return p.updateUser(ctx, uuid, sq.Eq{"role": role})
+}
+
+func (p *PostgresDatabase) updateUser(
+	ctx context.Context,
+	uuid string,
+	values sq.Eq,
+) error {
+	ctx, cancel := p.withQueryTimeout(ctx)
+	defer cancel()
+
+	query, args, err := psql.Update(USERS_TABLE).
+		SetMap(values).
+		Where(sq.Eq{"uuid": uuid}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build user update: %w", err)
+	}
+
+	result, err := p.ExecSql(ctx, nil, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, "user")
+}
 
-	return User, nil
+// escapeLike makes s match itself literally inside a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
@@ -0,0 +1,18 @@
+package database
+
+import "context"
+
+type primaryReadsKey struct{}
+
+// WithPrimaryReads makes every read done with ctx go to the primary
+// database instead of a replica. A request that just wrote uses it to read
+// its own writes, replicas may lag behind
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+// PrimaryReads tells whether ctx asks for reads from the primary
+func PrimaryReads(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryReadsKey{}).(bool)
+	return primary
+}
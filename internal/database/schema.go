@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// kinds of schema objects, the prefix of their key in Schema
+const (
+	SCHEMA_TABLE      = "table"
+	SCHEMA_COLUMN     = "column"
+	SCHEMA_CONSTRAINT = "constraint"
+	SCHEMA_INDEX      = "index"
+	SCHEMA_MIGRATION  = "migration"
+)
+
+// Schema maps every object of a database schema, keyed by kind and
+// qualified name like "column users.email", to the definition compared
+// between two schemas
+type Schema map[string]string
+
+// Add records an object, name is qualified by its table when it has one
+func (s Schema) Add(kind, name, definition string) {
+	s[kind+" "+name] = definition
+}
+
+// SchemaDifference is an object that differs between the schema the
+// migrations build and the live one
+type SchemaDifference struct {
+	Object   string
+	Expected string
+	Actual   string
+	// Missing is set when only the migrations create the object,
+	// Unexpected when only the live schema has it
+	Missing    bool
+	Unexpected bool
+}
+
+func (d SchemaDifference) String() string {
+	switch {
+	case d.Missing:
+		return fmt.Sprintf("- %s: missing, expected %s", d.Object,
+			describe(d.Expected))
+	case d.Unexpected:
+		return fmt.Sprintf("+ %s: not created by migrations, found %s",
+			d.Object, describe(d.Actual))
+	default:
+		return fmt.Sprintf("~ %s:\n    expected %s\n    found    %s",
+			d.Object, describe(d.Expected), describe(d.Actual))
+	}
+}
+
+func describe(definition string) string {
+	if definition == "" {
+		return "(no definition)"
+	}
+
+	return definition
+}
+
+// DiffSchemas lists the differences between expected and actual ordered by
+// object
+func DiffSchemas(expected, actual Schema) []SchemaDifference {
+	var differences []SchemaDifference
+
+	for _, object := range slices.Sorted(maps.Keys(expected)) {
+		found, ok := actual[object]
+		switch {
+		case !ok:
+			differences = append(differences, SchemaDifference{
+				Object: object, Expected: expected[object], Missing: true})
+		case found != expected[object]:
+			differences = append(differences, SchemaDifference{
+				Object: object, Expected: expected[object], Actual: found})
+		}
+	}
+
+	for _, object := range slices.Sorted(maps.Keys(actual)) {
+		if _, ok := expected[object]; !ok {
+			differences = append(differences, SchemaDifference{
+				Object: object, Actual: actual[object], Unexpected: true})
+		}
+	}
+
+	slices.SortStableFunc(differences, func(a, b SchemaDifference) int {
+		return strings.Compare(a.Object, b.Object)
+	})
+
+	return differences
+}
+
+// SchemaChecker is implemented by databases whose schema can drift from
+// their migrations, like a hotfix applied by hand
+type SchemaChecker interface {
+	// CheckSchema compares the live schema with the one every migration
+	// builds from scratch, without touching the live one
+	CheckSchema(ctx context.Context) ([]SchemaDifference, error)
+}
+
+// SchemaVersioner is implemented by databases built by migrations, the
+// version is the timestamp of the latest one applied
+type SchemaVersioner interface {
+	// SchemaVersion is 0 on a database never migrated
+	SchemaVersion(ctx context.Context) (int64, error)
+}
+
+// SchemaTooNewError is returned when the database was migrated by a newer
+// binary, whose schema this one may not be able to query
+type SchemaTooNewError struct {
+	Applied int64
+	Known   int64
+}
+
+func (e *SchemaTooNewError) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than %d, the"+
+		" latest this binary knows, upgrade it", e.Applied, e.Known)
+}
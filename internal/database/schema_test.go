@@ -0,0 +1,47 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	expected := Schema{}
+	expected.Add(SCHEMA_TABLE, "matches", "exists")
+	expected.Add(SCHEMA_COLUMN, "matches.version", "bigint not null default 1")
+	expected.Add(SCHEMA_INDEX, "matches.matches_created_by_user_idx",
+		"CREATE INDEX matches_created_by_user_idx ON matches USING btree"+
+			" (created_by_user)")
+
+	actual := Schema{}
+	actual.Add(SCHEMA_TABLE, "matches", "exists")
+	actual.Add(SCHEMA_COLUMN, "matches.version", "integer not null default 1")
+	actual.Add(SCHEMA_INDEX, "matches.hotfix_idx",
+		"CREATE INDEX hotfix_idx ON matches USING btree (match_state)")
+
+	differences := DiffSchemas(expected, actual)
+
+	var printed []string
+	for _, difference := range differences {
+		printed = append(printed, difference.String())
+	}
+
+	want := []string{
+		"~ column matches.version:\n" +
+			"    expected bigint not null default 1\n" +
+			"    found    integer not null default 1",
+		"+ index matches.hotfix_idx: not created by migrations, found" +
+			" CREATE INDEX hotfix_idx ON matches USING btree (match_state)",
+		"- index matches.matches_created_by_user_idx: missing, expected" +
+			" CREATE INDEX matches_created_by_user_idx ON matches USING" +
+			" btree (created_by_user)",
+	}
+	if strings.Join(printed, "\n") != strings.Join(want, "\n") {
+		t.Errorf("DiffSchemas() =\n%s\nwant\n%s",
+			strings.Join(printed, "\n"), strings.Join(want, "\n"))
+	}
+
+	if differences := DiffSchemas(expected, expected); len(differences) != 0 {
+		t.Errorf("expected no difference, got %v", differences)
+	}
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	MAX_TX_ATTEMPTS = 5
+	TX_RETRY_DELAY  = 10 * time.Millisecond
+)
+
+// RetrySerializationFailures calls fn until it succeeds, fails with an error
+// other than ErrSerialization or MAX_TX_ATTEMPTS is reached. Attempts are
+// spaced by a growing, jittered delay so the competing transactions don't
+// collide again straight away
+func RetrySerializationFailures(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= MAX_TX_ATTEMPTS; attempt++ {
+		err = fn()
+		if !errors.Is(err, ErrSerialization) || attempt == MAX_TX_ATTEMPTS {
+			return err
+		}
+
+		delay := time.Duration(attempt) * TX_RETRY_DELAY
+		delay += rand.N(TX_RETRY_DELAY)
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRetrySerializationFailures(t *testing.T) {
+	t.Run("succeeds after failures", func(t *testing.T) {
+		calls := 0
+		err := RetrySerializationFailures(context.Background(), func() error {
+			calls++
+			if calls < 3 {
+				return fmt.Errorf("commit: %w", ErrSerialization)
+			}
+			return nil
+		})
+
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 calls, got %d", calls)
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		calls := 0
+		err := RetrySerializationFailures(context.Background(), func() error {
+			calls++
+			return ErrSerialization
+		})
+
+		if !errors.Is(err, ErrSerialization) {
+			t.Errorf("expected serialization error, got %v", err)
+		}
+		if calls != MAX_TX_ATTEMPTS {
+			t.Errorf("expected %d calls, got %d", MAX_TX_ATTEMPTS, calls)
+		}
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		calls := 0
+		err := RetrySerializationFailures(context.Background(), func() error {
+			calls++
+			return ErrConflict
+		})
+
+		if !errors.Is(err, ErrConflict) {
+			t.Errorf("expected conflict error, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("stops when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		calls := 0
+		err := RetrySerializationFailures(ctx, func() error {
+			calls++
+			cancel()
+			return ErrSerialization
+		})
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context canceled, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package game
+
+import (
+	"bytes"
+	"duna/internal/models"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// content keys are lowercase slugs like spacing_guild
+var contentKeyPattern = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+
+// ParseContent decodes game content from YAML, or JSON which is a subset
+// of it, and validates it. Unknown fields are rejected so a typo doesn't
+// silently drop data
+func ParseContent(data []byte) (models.GameContent, error) {
+	var content models.GameContent
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&content); err != nil && !errors.Is(err, io.EOF) {
+		return models.GameContent{}, fmt.Errorf("malformed game content: %w",
+			err)
+	}
+
+	if err := ValidateContent(content); err != nil {
+		return models.GameContent{}, err
+	}
+
+	return content, nil
+}
+
+// ValidateContent reports every problem in content at once, keys must be
+// unique per kind and references must point to existing entries
+func ValidateContent(content models.GameContent) error {
+	v := &contentValidator{}
+
+	territories := map[string]models.TerritoryDef{}
+	for i, territory := range content.Territories {
+		at := fmt.Sprintf("territories[%d]", i)
+		entry(v, at, "territory", territory.Key, territory.Name, territories)
+		territories[territory.Key] = territory
+
+		switch territory.Kind {
+		case models.SAND_TERRITORY, models.ROCK_TERRITORY,
+			models.STRONGHOLD_TERRITORY:
+			if len(territory.Sectors) == 0 {
+				v.errorf(at, "a %s territory spans at least one sector",
+					territory.Kind)
+			}
+		case models.POLAR_SINK_TERRITORY:
+			if len(territory.Sectors) != 0 {
+				v.errorf(at, "the polar sink is out of every sector")
+			}
+		default:
+			v.errorf(at, "unknown kind %q", territory.Kind)
+		}
+
+		for _, sector := range territory.Sectors {
+			if !validSector(sector) {
+				v.errorf(at, "sector %d out of 0-%d", sector,
+					models.STORM_SECTORS-1)
+			}
+		}
+	}
+
+	factions := map[string]models.FactionDef{}
+	for i, faction := range content.Factions {
+		at := fmt.Sprintf("factions[%d]", i)
+		entry(v, at, "faction", faction.Key, faction.Name, factions)
+		factions[faction.Key] = faction
+
+		if faction.StartingSpice < 0 {
+			v.errorf(at, "starting_spice can't be negative")
+		}
+		if faction.Reserves <= 0 {
+			v.errorf(at, "reserves must be positive")
+		}
+		if faction.StartingTroops < 0 ||
+			faction.StartingTroops > faction.Reserves {
+			v.errorf(at, "starting_troops must be within 0 and reserves")
+		}
+		if faction.HomeTerritory == "" && faction.StartingTroops > 0 {
+			v.errorf(at, "starting_troops need a home_territory")
+		}
+		if faction.HomeTerritory != "" {
+			reference(v, at, "home_territory", faction.HomeTerritory,
+				territories)
+		}
+	}
+
+	if len(content.Factions) > models.MAX_PLAYERS {
+		v.errorf("factions", "at most %d factions, one per seat",
+			models.MAX_PLAYERS)
+	}
+
+	leaders := map[string]models.LeaderDef{}
+	for i, leader := range content.Leaders {
+		at := fmt.Sprintf("leaders[%d]", i)
+		entry(v, at, "leader", leader.Key, leader.Name, leaders)
+		leaders[leader.Key] = leader
+
+		reference(v, at, "faction", leader.Faction, factions)
+		if leader.Strength < 0 {
+			v.errorf(at, "strength can't be negative")
+		}
+	}
+
+	treacheryCards := map[string]models.TreacheryCardDef{}
+	for i, card := range content.TreacheryCards {
+		at := fmt.Sprintf("treachery_cards[%d]", i)
+		entry(v, at, "treachery card", card.Key, card.Name, treacheryCards)
+		treacheryCards[card.Key] = card
+
+		switch card.Kind {
+		case models.WEAPON_CARD, models.DEFENSE_CARD:
+			if card.Subtype == "" {
+				v.errorf(at, "a %s card needs a subtype", card.Kind)
+			}
+		case models.SPECIAL_CARD, models.WORTHLESS_CARD:
+			if card.Subtype != "" {
+				v.errorf(at, "a %s card has no subtype", card.Kind)
+			}
+		default:
+			v.errorf(at, "unknown kind %q", card.Kind)
+		}
+
+		if card.Copies <= 0 {
+			v.errorf(at, "copies must be positive")
+		}
+	}
+
+	spiceCards := map[string]models.SpiceCardDef{}
+	for i, card := range content.SpiceCards {
+		at := fmt.Sprintf("spice_cards[%d]", i)
+		entry(v, at, "spice card", card.Key, card.Name, spiceCards)
+		spiceCards[card.Key] = card
+
+		if card.Copies <= 0 {
+			v.errorf(at, "copies must be positive")
+		}
+
+		if card.Worm {
+			if card.Territory != "" || card.Amount != 0 {
+				v.errorf(at, "a worm card has no territory nor amount")
+			}
+			continue
+		}
+
+		if card.Amount <= 0 {
+			v.errorf(at, "amount must be positive")
+		}
+		if territory, ok := reference(
+			v, at, "territory", card.Territory, territories); ok &&
+			!slices.Contains(territory.Sectors, card.Sector) {
+			v.errorf(at, "sector %d is not part of %s", card.Sector,
+				card.Territory)
+		}
+	}
+
+	return errors.Join(v.errs...)
+}
+
+func validSector(sector int) bool {
+	return sector >= 0 && sector < models.STORM_SECTORS
+}
+
+type contentValidator struct {
+	errs []error
+}
+
+func (v *contentValidator) errorf(at, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", at,
+		fmt.Sprintf(format, args...)))
+}
+
+// entry checks what every kind of content shares, seen holds the entries
+// of the same kind already validated
+func entry[T any](
+	v *contentValidator,
+	at, kind, key, name string,
+	seen map[string]T,
+) {
+	if !contentKeyPattern.MatchString(key) {
+		v.errorf(at, "invalid key %q, expected a lowercase slug", key)
+	} else if _, exists := seen[key]; exists {
+		v.errorf(at, "duplicate %s key %q", kind, key)
+	}
+
+	if name == "" {
+		v.errorf(at, "missing name")
+	}
+}
+
+// reference checks key names an entry of known, field is how it is called
+// in the data file
+func reference[T any](
+	v *contentValidator,
+	at, field, key string,
+	known map[string]T,
+) (T, bool) {
+	value, ok := known[key]
+	if !ok {
+		v.errorf(at, "unknown %s %q", field, key)
+	}
+
+	return value, ok
+}
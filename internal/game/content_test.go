@@ -0,0 +1,100 @@
+package game
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseRepositoryContent(t *testing.T) {
+	data, err := os.ReadFile("../../data/game.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error reading content: %v", err)
+	}
+
+	content, err := ParseContent(data)
+	if err != nil {
+		t.Fatalf("the repository content is invalid: %v", err)
+	}
+
+	deck := 0
+	for _, card := range content.TreacheryCards {
+		deck += card.Copies
+	}
+
+	tests := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"factions", len(content.Factions), 6},
+		{"leaders", len(content.Leaders), 30},
+		{"treachery deck", deck, 33},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %d, want %d", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContentErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "unknown field",
+			data:    "factions:\n  - key: fremen\n    nmae: Fremen\n",
+			wantErr: "field nmae not found",
+		},
+		{
+			name: "duplicate key",
+			data: `{"territories": [
+				{"key": "arrakeen", "name": "Arrakeen", "kind": "stronghold",
+				 "sectors": [9]},
+				{"key": "arrakeen", "name": "Arrakeen", "kind": "stronghold",
+				 "sectors": [9]}]}`,
+			wantErr: `territories[1]: duplicate territory key "arrakeen"`,
+		},
+		{
+			name: "sector out of the board",
+			data: "territories:\n  - {key: carthag, name: Carthag," +
+				" kind: stronghold, sectors: [18]}\n",
+			wantErr: "sector 18 out of 0-17",
+		},
+		{
+			name: "unknown home territory",
+			data: "factions:\n  - {key: harkonnen, name: Harkonnen," +
+				" reserves: 20, home_territory: carthag, starting_troops: 10}\n",
+			wantErr: `unknown home_territory "carthag"`,
+		},
+		{
+			name: "spice outside its territory",
+			data: "territories:\n  - {key: red_chasm, name: Red Chasm," +
+				" kind: sand, sectors: [6]}\n" +
+				"spice_cards:\n  - {key: red_chasm, name: Red Chasm," +
+				" territory: red_chasm, sector: 7, amount: 8, copies: 1}\n",
+			wantErr: "sector 7 is not part of red_chasm",
+		},
+		{
+			name: "weapon without subtype",
+			data: "treachery_cards:\n  - {key: crysknife, name: Crysknife," +
+				" kind: weapon, copies: 1}\n",
+			wantErr: "a weapon card needs a subtype",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseContent([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
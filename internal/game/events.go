@@ -0,0 +1,270 @@
+package game
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// action types stored in models.MatchEvent.Type
+const (
+	// JOIN_ACTION seats the actor with the faction of the event
+	JOIN_ACTION = "join"
+	// LEAVE_ACTION frees the seat and the faction of the actor before the
+	// match starts
+	LEAVE_ACTION = "leave"
+	START_ACTION = "start"
+	// SPICE_ACTION adds the payload amount, negative to spend, to the spice
+	// of the faction of the event
+	SPICE_ACTION = "spice"
+	// FINISH_ACTION ends the match, the payload names the winning faction
+	FINISH_ACTION = "finish"
+)
+
+// SNAPSHOT_INTERVAL is how many events go by between two snapshots, a
+// match is never rebuilt from more events than that
+const SNAPSHOT_INTERVAL = 50
+
+var (
+	// ErrEventOutOfOrder means an event doesn't follow the last one applied,
+	// the log has a gap or the state is stale
+	ErrEventOutOfOrder = errors.New("event out of order")
+	ErrUnknownAction   = errors.New("unknown action")
+	ErrIllegalAction   = errors.New("illegal action")
+)
+
+// State is a match rebuilt from its events, Seq is the last one applied
+type State struct {
+	Seq        int64             `json:"seq"`
+	MatchState models.MatchState `json:"match_state"`
+	// Factions maps each player to the faction they play
+	Factions map[string]string `json:"factions"`
+	// Spice is keyed by faction
+	Spice  map[string]int `json:"spice"`
+	Winner string         `json:"winner,omitempty"`
+}
+
+type spicePayload struct {
+	Amount int `json:"amount"`
+}
+
+type finishPayload struct {
+	Winner string `json:"winner"`
+}
+
+// NewState is a match before its first event
+func NewState() State {
+	return State{
+		MatchState: models.WaitingPlayers,
+		Factions:   map[string]string{},
+		Spice:      map[string]int{},
+	}
+}
+
+func (s State) clone() State {
+	s.Factions = maps.Clone(s.Factions)
+	s.Spice = maps.Clone(s.Spice)
+	if s.Factions == nil {
+		s.Factions = map[string]string{}
+	}
+	if s.Spice == nil {
+		s.Spice = map[string]int{}
+	}
+
+	return s
+}
+
+func (s State) inPlay(faction string) bool {
+	for _, played := range s.Factions {
+		if played == faction {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply returns the state after event, s is left untouched. It fails when
+// the event doesn't follow s.Seq or breaks the rules in the current state
+func (s State) Apply(event models.MatchEvent) (State, error) {
+	if event.Seq != s.Seq+1 {
+		return s, fmt.Errorf("%w: expected seq %d, got %d",
+			ErrEventOutOfOrder, s.Seq+1, event.Seq)
+	}
+
+	next := s.clone()
+	next.Seq = event.Seq
+
+	switch event.Type {
+	case JOIN_ACTION:
+		switch {
+		case s.MatchState != models.WaitingPlayers:
+			return s, fmt.Errorf("%w: match already started", ErrIllegalAction)
+		case event.ActorUUID == "" || event.Faction == "":
+			return s, fmt.Errorf("%w: join needs a player and a faction",
+				ErrIllegalAction)
+		case s.Factions[event.ActorUUID] != "":
+			return s, fmt.Errorf("%w: player already joined", ErrIllegalAction)
+		case s.inPlay(event.Faction):
+			return s, fmt.Errorf("%w: faction %s already taken",
+				ErrIllegalAction, event.Faction)
+		case len(s.Factions) >= models.MAX_PLAYERS:
+			return s, fmt.Errorf("%w: match is full", ErrIllegalAction)
+		}
+		next.Factions[event.ActorUUID] = event.Faction
+
+	case LEAVE_ACTION:
+		switch {
+		case s.MatchState != models.WaitingPlayers:
+			return s, fmt.Errorf("%w: match already started", ErrIllegalAction)
+		case s.Factions[event.ActorUUID] == "":
+			return s, fmt.Errorf("%w: player not in the match",
+				ErrIllegalAction)
+		}
+		delete(next.Factions, event.ActorUUID)
+
+	case START_ACTION:
+		if !s.MatchState.CanTransitionTo(models.InGame) {
+			return s, fmt.Errorf("%w from %d to %d",
+				ErrIllegalTransition, s.MatchState, models.InGame)
+		}
+		next.MatchState = models.InGame
+
+	case SPICE_ACTION:
+		var payload spicePayload
+		if err := decodePayload(event, &payload); err != nil {
+			return s, err
+		}
+		if s.MatchState != models.InGame || !s.inPlay(event.Faction) {
+			return s, fmt.Errorf("%w: %s can't collect spice now",
+				ErrIllegalAction, event.Faction)
+		}
+		if s.Spice[event.Faction]+payload.Amount < 0 {
+			return s, fmt.Errorf("%w: %s doesn't have %d spice",
+				ErrIllegalAction, event.Faction, -payload.Amount)
+		}
+		next.Spice[event.Faction] += payload.Amount
+
+	case FINISH_ACTION:
+		var payload finishPayload
+		if err := decodePayload(event, &payload); err != nil {
+			return s, err
+		}
+		if !s.MatchState.CanTransitionTo(models.Finish) {
+			return s, fmt.Errorf("%w from %d to %d",
+				ErrIllegalTransition, s.MatchState, models.Finish)
+		}
+		if payload.Winner != "" && !s.inPlay(payload.Winner) {
+			return s, fmt.Errorf("%w: winner %s is not in play",
+				ErrIllegalAction, payload.Winner)
+		}
+		next.MatchState = models.Finish
+		next.Winner = payload.Winner
+
+	default:
+		return s, fmt.Errorf("%w %q", ErrUnknownAction, event.Type)
+	}
+
+	return next, nil
+}
+
+func decodePayload(event models.MatchEvent, payload any) error {
+	if len(event.Payload) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(event.Payload, payload); err != nil {
+		return fmt.Errorf("%w: malformed %s payload: %w",
+			ErrIllegalAction, event.Type, err)
+	}
+
+	return nil
+}
+
+// Fold applies events in order on top of state
+func Fold(state State, events []models.MatchEvent) (State, error) {
+	for _, event := range events {
+		var err error
+		state, err = state.Apply(event)
+		if err != nil {
+			return state, err
+		}
+	}
+
+	return state, nil
+}
+
+// LoadState rebuilds a match from its latest snapshot and the events
+// appended after it. Callers about to act on the state should read from the
+// primary, see database.WithPrimaryReads
+func LoadState(
+	ctx context.Context,
+	events database.EventRepository,
+	matchUUID string,
+) (State, error) {
+	state := NewState()
+
+	snapshot, err := events.LatestSnapshot(ctx, matchUUID)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(snapshot.State, &state); err != nil {
+			return State{}, fmt.Errorf("malformed snapshot %d of match %s: %w",
+				snapshot.Seq, matchUUID, err)
+		}
+		state = state.clone()
+	case !errors.Is(err, database.ErrNotFound):
+		return State{}, err
+	}
+
+	pending, err := events.LoadEvents(ctx, matchUUID, state.Seq)
+	if err != nil {
+		return State{}, err
+	}
+
+	return Fold(state, pending)
+}
+
+// AppendAction validates event against state, stores it as the next event
+// of the match and returns the new state. Every SNAPSHOT_INTERVAL events
+// the new state is also saved as a snapshot, run it inside
+// database.Database.WithTx so both are written together. Losing the race
+// for the seq fails with a database.ErrConflict, the state must then be
+// loaded again
+func AppendAction(
+	ctx context.Context,
+	events database.EventRepository,
+	state State,
+	event models.MatchEvent,
+) (State, error) {
+	event.Seq = state.Seq + 1
+
+	next, err := state.Apply(event)
+	if err != nil {
+		return state, err
+	}
+
+	if err := events.AppendEvents(ctx, event); err != nil {
+		return state, err
+	}
+
+	if next.Seq%SNAPSHOT_INTERVAL == 0 {
+		encoded, err := json.Marshal(next)
+		if err != nil {
+			return state, fmt.Errorf("failed to encode snapshot: %w", err)
+		}
+
+		if err := events.SaveSnapshot(ctx, models.MatchSnapshot{
+			MatchUUID: event.MatchUUID,
+			Seq:       next.Seq,
+			State:     encoded,
+		}); err != nil {
+			return state, err
+		}
+	}
+
+	return next, nil
+}
@@ -0,0 +1,180 @@
+package game
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/database/memory"
+	"duna/internal/models"
+	"duna/internal/uuid"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	lobby := NewState()
+	lobby.Seq = 1
+	lobby.Factions["paul"] = "Atreides"
+
+	inGame := lobby.clone()
+	inGame.MatchState = models.InGame
+
+	tests := []struct {
+		name    string
+		state   State
+		event   models.MatchEvent
+		wantErr error
+	}{
+		{
+			name:  "join",
+			state: lobby,
+			event: models.MatchEvent{Seq: 2, Type: JOIN_ACTION,
+				ActorUUID: "feyd", Faction: "Harkonnen"},
+		},
+		{
+			name:  "faction taken",
+			state: lobby,
+			event: models.MatchEvent{Seq: 2, Type: JOIN_ACTION,
+				ActorUUID: "leto", Faction: "Atreides"},
+			wantErr: ErrIllegalAction,
+		},
+		{
+			name:  "join after start",
+			state: inGame,
+			event: models.MatchEvent{Seq: 2, Type: JOIN_ACTION,
+				ActorUUID: "feyd", Faction: "Harkonnen"},
+			wantErr: ErrIllegalAction,
+		},
+		{
+			name:  "leave",
+			state: lobby,
+			event: models.MatchEvent{Seq: 2, Type: LEAVE_ACTION,
+				ActorUUID: "paul"},
+		},
+		{
+			name:  "leave without joining",
+			state: lobby,
+			event: models.MatchEvent{Seq: 2, Type: LEAVE_ACTION,
+				ActorUUID: "feyd"},
+			wantErr: ErrIllegalAction,
+		},
+		{
+			name:  "leave after start",
+			state: inGame,
+			event: models.MatchEvent{Seq: 2, Type: LEAVE_ACTION,
+				ActorUUID: "paul"},
+			wantErr: ErrIllegalAction,
+		},
+		{
+			name:    "start twice",
+			state:   inGame,
+			event:   models.MatchEvent{Seq: 2, Type: START_ACTION},
+			wantErr: ErrIllegalTransition,
+		},
+		{
+			name:  "spend more spice than owned",
+			state: inGame,
+			event: models.MatchEvent{Seq: 2, Type: SPICE_ACTION,
+				Faction: "Atreides", Payload: []byte(`{"amount": -1}`)},
+			wantErr: ErrIllegalAction,
+		},
+		{
+			name:    "gap",
+			state:   lobby,
+			event:   models.MatchEvent{Seq: 3, Type: START_ACTION},
+			wantErr: ErrEventOutOfOrder,
+		},
+		{
+			name:    "unknown action",
+			state:   lobby,
+			event:   models.MatchEvent{Seq: 2, Type: "bribe"},
+			wantErr: ErrUnknownAction,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := tt.state.Apply(tt.event)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+
+			want := tt.event.Seq
+			if err != nil {
+				want = tt.state.Seq
+			}
+			if next.Seq != want {
+				t.Errorf("expected seq %d, got %d", want, next.Seq)
+			}
+		})
+	}
+
+	if len(lobby.Factions) != 1 {
+		t.Errorf("Apply changed the original state: %v", lobby.Factions)
+	}
+}
+
+func TestLoadStateFoldsFromSnapshot(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDatabase()
+	match := CreateMatch(&uuid.FakeStrategy{}, "creator")
+	if err := db.InsertMatch(ctx, match); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	state := NewState()
+	actions := []models.MatchEvent{
+		{Type: JOIN_ACTION, ActorUUID: "paul", Faction: "Atreides"},
+		{Type: JOIN_ACTION, ActorUUID: "feyd", Faction: "Harkonnen"},
+		{Type: START_ACTION},
+	}
+	for range SNAPSHOT_INTERVAL {
+		actions = append(actions, models.MatchEvent{Type: SPICE_ACTION,
+			Faction: "Atreides", Payload: []byte(`{"amount": 2}`)})
+	}
+	actions = append(actions, models.MatchEvent{Type: FINISH_ACTION,
+		Payload: []byte(`{"winner": "Atreides"}`)})
+
+	var beforeFinish State
+	for _, action := range actions {
+		action.MatchUUID = match.UUID
+		beforeFinish = state
+
+		var err error
+		state, err = AppendAction(ctx, db, state, action)
+		if err != nil {
+			t.Fatalf("unexpected error at seq %d: %v", state.Seq+1, err)
+		}
+	}
+
+	snapshot, err := db.LatestSnapshot(ctx, match.UUID)
+	if err != nil {
+		t.Fatalf("expected a snapshot: %v", err)
+	}
+	if snapshot.Seq != SNAPSHOT_INTERVAL {
+		t.Errorf("expected a snapshot at %d, got %d",
+			SNAPSHOT_INTERVAL, snapshot.Seq)
+	}
+
+	loaded, err := LoadState(ctx, db, match.UUID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, _ := json.Marshal(loaded)
+	want, _ := json.Marshal(state)
+	if string(got) != string(want) {
+		t.Errorf("LoadState() = %s, want %s", got, want)
+	}
+	if loaded.Spice["Atreides"] != 2*SNAPSHOT_INTERVAL ||
+		loaded.Winner != "Atreides" {
+		t.Errorf("unexpected final state %s", got)
+	}
+
+	// a writer holding a stale state loses the seq
+	_, err = AppendAction(ctx, db, beforeFinish, models.MatchEvent{
+		MatchUUID: match.UUID, Type: SPICE_ACTION, Faction: "Harkonnen"})
+	if !errors.Is(err, database.ErrConflict) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+}
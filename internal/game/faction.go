@@ -1,6 +1,15 @@
 package game
 
+import "duna/internal/models"
+
 type Faction struct {
 	UUID string `json:"UUID"`
 	Name string `json:"Name"`
 }
+
+func CreateFaction(uuids models.UUIDStrategy, name string) Faction {
+	return Faction{
+		UUID: uuids.New(),
+		Name: name,
+	}
+}
@@ -1,6 +1,9 @@
 package game
 
-import "testing"
+import (
+	"duna/internal/uuid"
+	"testing"
+)
 
 func TestFaction(t *testing.T) {
 	t.Run("Create Faction", func(t *testing.T) {
@@ -20,3 +23,18 @@ func TestFaction(t *testing.T) {
 		}
 	})
 }
+
+func TestCreateFaction(t *testing.T) {
+	f := CreateFaction(&uuid.FakeStrategy{}, "Atreides")
+
+	if f.UUID != "00000000-0000-4000-8000-000000000001" {
+		t.Errorf(
+			"Expected UUID=00000000-0000-4000-8000-000000000001, got %s",
+			f.UUID,
+		)
+	}
+
+	if f.Name != "Atreides" {
+		t.Errorf("Expected Name=Atreides, got %s", f.Name)
+	}
+}
@@ -0,0 +1,255 @@
+package game
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotCreator rejects starting or cancelling the match of someone else
+	ErrNotCreator = errors.New("only the creator of the match may do that")
+	// ErrUnknownFaction means the faction picked is not in the game content
+	ErrUnknownFaction = errors.New("unknown faction")
+)
+
+// Lobby gathers the players of a match until its creator starts it. The
+// seats live in users_matches and the factions in the event log, every
+// method writes both so it must run inside database.Database.WithTx. Two
+// players acting at once race for the next event seq, the loser fails with
+// a database.ErrConflict. The state returned holds the seq of the last
+// event, publish it with pubsub once the transaction committed, along with
+// the deletion of a cancelled lobby
+type Lobby struct {
+	// MinPlayers must be seated to start
+	MinPlayers int
+	// MaxPlayers is capped by models.MAX_PLAYERS, one seat per faction
+	MaxPlayers int
+}
+
+// Open creates a match with its creator seated as faction
+func (l Lobby) Open(
+	ctx context.Context,
+	repos database.Repos,
+	uuids models.UUIDStrategy,
+	creatorUUID, faction string,
+) (models.Match, State, error) {
+	match := CreateMatch(uuids, creatorUUID)
+	if err := repos.InsertMatch(ctx, match); err != nil {
+		return models.Match{}, State{}, err
+	}
+
+	return l.Join(ctx, repos, match.UUID, creatorUUID, faction)
+}
+
+// Join seats the user as faction, which must be free in the match
+func (l Lobby) Join(
+	ctx context.Context,
+	repos database.Repos,
+	matchUUID, userUUID, faction string,
+) (models.Match, State, error) {
+	match, state, err := loadMatch(ctx, repos, matchUUID)
+	if err != nil {
+		return models.Match{}, State{}, err
+	}
+
+	switch {
+	case match.MatchState != models.WaitingPlayers:
+		return models.Match{}, State{}, fmt.Errorf("%w: match already started",
+			ErrIllegalAction)
+	case match.HasPlayer(userUUID):
+		return models.Match{}, State{}, fmt.Errorf("%w: already in the match",
+			ErrIllegalAction)
+	case len(match.Seats) >= l.maxPlayers():
+		return models.Match{}, State{}, fmt.Errorf("%w: match is full",
+			ErrIllegalAction)
+	}
+
+	if err := checkFaction(ctx, repos, faction); err != nil {
+		return models.Match{}, State{}, err
+	}
+
+	if err := repos.AddPlayer(ctx, matchUUID, userUUID); err != nil {
+		return models.Match{}, State{}, err
+	}
+
+	if _, err := AppendAction(ctx, repos, state, models.MatchEvent{
+		MatchUUID: matchUUID,
+		ActorUUID: userUUID,
+		Faction:   faction,
+		Type:      JOIN_ACTION,
+	}); err != nil {
+		return models.Match{}, State{}, err
+	}
+
+	return loadMatch(ctx, repos, matchUUID)
+}
+
+// Leave frees the seat of the user before the match starts, the creator
+// cancels the match instead
+func (l Lobby) Leave(
+	ctx context.Context,
+	repos database.Repos,
+	matchUUID, userUUID string,
+) (State, error) {
+	match, state, err := loadMatch(ctx, repos, matchUUID)
+	if err != nil {
+		return State{}, err
+	}
+
+	switch {
+	case !match.HasPlayer(userUUID):
+		return State{}, fmt.Errorf("%w: not in the match", ErrIllegalAction)
+	case match.CreatedByUser == userUUID:
+		return State{}, fmt.Errorf("%w: the creator cancels the match"+
+			" instead of leaving", ErrIllegalAction)
+	}
+
+	if err := repos.RemovePlayer(ctx, matchUUID, userUUID); err != nil {
+		return State{}, err
+	}
+
+	// refused once the match started
+	return AppendAction(ctx, repos, state, models.MatchEvent{
+		MatchUUID: matchUUID,
+		ActorUUID: userUUID,
+		Faction:   state.Factions[userUUID],
+		Type:      LEAVE_ACTION,
+	})
+}
+
+// Start moves the match in game once MinPlayers are seated
+func (l Lobby) Start(
+	ctx context.Context,
+	repos database.Repos,
+	matchUUID, userUUID string,
+) (models.Match, State, error) {
+	match, state, err := loadMatch(ctx, repos, matchUUID)
+	if err != nil {
+		return models.Match{}, State{}, err
+	}
+
+	if match.CreatedByUser != userUUID {
+		return models.Match{}, State{}, ErrNotCreator
+	}
+
+	if match.MatchState == models.WaitingPlayers &&
+		len(match.Seats) < l.MinPlayers {
+		return models.Match{}, State{}, fmt.Errorf(
+			"%w: %d players needed to start, %d joined", ErrIllegalAction,
+			l.MinPlayers, len(match.Seats))
+	}
+
+	if _, err := transition(ctx, repos, matchUUID, state, models.InGame,
+		START_ACTION); err != nil {
+		return models.Match{}, State{}, err
+	}
+
+	return loadMatch(ctx, repos, matchUUID)
+}
+
+// Cancel deletes a match still waiting for players, telling so with the
+// last state it had. A match in game is finished without a winner
+func (l Lobby) Cancel(
+	ctx context.Context,
+	repos database.Repos,
+	matchUUID, userUUID string,
+) (State, bool, error) {
+	match, state, err := loadMatch(ctx, repos, matchUUID)
+	if err != nil {
+		return State{}, false, err
+	}
+
+	if match.CreatedByUser != userUUID {
+		return State{}, false, ErrNotCreator
+	}
+
+	if match.MatchState == models.WaitingPlayers {
+		// the seats and the events go along
+		if err := repos.DeleteMatch(ctx, matchUUID); err != nil {
+			return State{}, false, err
+		}
+		return state, true, nil
+	}
+
+	state, err = transition(ctx, repos, matchUUID, state, models.Finish,
+		FINISH_ACTION)
+	return state, false, err
+}
+
+func (l Lobby) maxPlayers() int {
+	return min(l.MaxPlayers, models.MAX_PLAYERS)
+}
+
+// transition moves the match to next with TransitionMatch and appends the
+// event leading there
+func transition(
+	ctx context.Context,
+	repos database.Repos,
+	matchUUID string,
+	state State,
+	next models.MatchState,
+	action string,
+) (State, error) {
+	if _, err := TransitionMatch(ctx, repos, matchUUID, next); err != nil {
+		return State{}, err
+	}
+
+	return AppendAction(ctx, repos, state, models.MatchEvent{
+		MatchUUID: matchUUID,
+		Type:      action,
+	})
+}
+
+// loadMatch reads the match and its state from the primary, the lobby acts
+// on them right away
+func loadMatch(
+	ctx context.Context,
+	repos database.Repos,
+	matchUUID string,
+) (models.Match, State, error) {
+	ctx = database.WithPrimaryReads(ctx)
+
+	match, err := repos.GetMatch(ctx, matchUUID)
+	if err != nil {
+		return models.Match{}, State{}, err
+	}
+
+	state, err := LoadState(ctx, repos, matchUUID)
+	if err != nil {
+		return models.Match{}, State{}, err
+	}
+
+	return match, state, nil
+}
+
+// checkFaction looks faction up in the seeded game content
+func checkFaction(
+	ctx context.Context,
+	content database.ContentRepository,
+	faction string,
+) error {
+	loaded, err := content.LoadContent(ctx)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, def := range loaded.Factions {
+		if def.Key == faction {
+			return nil
+		}
+		keys = append(keys, def.Key)
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("%w %q, no faction is seeded, run `duna seed`",
+			ErrUnknownFaction, faction)
+	}
+
+	return fmt.Errorf("%w %q, pick one of %s", ErrUnknownFaction, faction,
+		strings.Join(keys, ", "))
+}
@@ -0,0 +1,200 @@
+package game
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/database/databasetest"
+	"duna/internal/database/memory"
+	"duna/internal/models"
+	"duna/internal/uuid"
+	"errors"
+	"testing"
+)
+
+func TestLobby(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDatabase()
+	lobby := Lobby{MinPlayers: 2, MaxPlayers: 2}
+
+	if _, err := db.UpsertContent(ctx, models.GameContent{
+		Factions: []models.FactionDef{
+			{Key: "atreides", Name: "Atreides", Reserves: 20},
+			{Key: "harkonnen", Name: "Harkonnen", Reserves: 20},
+			{Key: "fremen", Name: "Fremen", Reserves: 20},
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var paul, feyd, jessica string
+	for _, player := range []*string{&paul, &feyd, &jessica} {
+		user := databasetest.NewTestUser(t)
+		if err := db.InsertUser(ctx, user); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		*player = user.UUID
+	}
+
+	inTx := func(fn func(repos database.Repos) error) error {
+		return db.WithTx(ctx, fn)
+	}
+
+	var match models.Match
+	var state State
+	if err := inTx(func(repos database.Repos) error {
+		var err error
+		match, state, err = lobby.Open(ctx, repos, &uuid.FakeStrategy{},
+			paul, "atreides")
+		return err
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if match.CreatedByUser != paul || len(match.Seats) != 1 ||
+		state.Factions[paul] != "atreides" {
+		t.Fatalf("unexpected lobby %+v with factions %v", match,
+			state.Factions)
+	}
+
+	join := func(user, faction string) error {
+		return inTx(func(repos database.Repos) error {
+			_, _, err := lobby.Join(ctx, repos, match.UUID, user, faction)
+			return err
+		})
+	}
+	start := func(user string) error {
+		return inTx(func(repos database.Repos) error {
+			_, _, err := lobby.Start(ctx, repos, match.UUID, user)
+			return err
+		})
+	}
+	leave := func(user string) error {
+		return inTx(func(repos database.Repos) error {
+			_, err := lobby.Leave(ctx, repos, match.UUID, user)
+			return err
+		})
+	}
+	cancel := func(user string) error {
+		return inTx(func(repos database.Repos) error {
+			_, _, err := lobby.Cancel(ctx, repos, match.UUID, user)
+			return err
+		})
+	}
+
+	steps := []struct {
+		name    string
+		act     func() error
+		wantErr error
+	}{
+		{"unknown faction", func() error { return join(feyd, "guild") },
+			ErrUnknownFaction},
+		{"faction taken", func() error { return join(feyd, "atreides") },
+			ErrIllegalAction},
+		{"start alone", func() error { return start(paul) },
+			ErrIllegalAction},
+		{"join", func() error { return join(feyd, "harkonnen") }, nil},
+		{"join twice", func() error { return join(feyd, "fremen") },
+			ErrIllegalAction},
+		{"full", func() error { return join(jessica, "fremen") },
+			ErrIllegalAction},
+		{"creator leaves", func() error { return leave(paul) },
+			ErrIllegalAction},
+		{"leave", func() error { return leave(feyd) }, nil},
+		{"join again", func() error { return join(jessica, "harkonnen") },
+			nil},
+		{"start by a player", func() error { return start(jessica) },
+			ErrNotCreator},
+		{"start", func() error { return start(paul) }, nil},
+		{"start twice", func() error { return start(paul) },
+			ErrIllegalTransition},
+		{"join after start", func() error { return join(feyd, "fremen") },
+			ErrIllegalAction},
+		{"leave after start", func() error { return leave(jessica) },
+			ErrIllegalAction},
+		{"cancel by a player", func() error { return cancel(jessica) },
+			ErrNotCreator},
+		{"cancel", func() error { return cancel(paul) }, nil},
+		{"cancel twice", func() error { return cancel(paul) },
+			ErrIllegalTransition},
+	}
+
+	for _, step := range steps {
+		if err := step.act(); !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: expected %v, got %v", step.name, step.wantErr, err)
+		}
+	}
+
+	finished, err := db.GetMatch(ctx, match.UUID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if finished.MatchState != models.Finish {
+		t.Errorf("expected the match finished, got %d", finished.MatchState)
+	}
+
+	state, err = LoadState(ctx, db, match.UUID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{paul: "atreides", jessica: "harkonnen"}
+	if len(state.Factions) != len(want) || state.MatchState != models.Finish {
+		t.Errorf("unexpected state %+v", state)
+	}
+	for player, faction := range want {
+		if state.Factions[player] != faction {
+			t.Errorf("expected %s to play %s, got %q", player, faction,
+				state.Factions[player])
+		}
+	}
+}
+
+func TestLobbyCancelDeletesWaitingMatch(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDatabase()
+	lobby := Lobby{MinPlayers: 2, MaxPlayers: models.MAX_PLAYERS}
+
+	if _, err := db.UpsertContent(ctx, models.GameContent{
+		Factions: []models.FactionDef{
+			{Key: "fremen", Name: "Fremen", Reserves: 20},
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	user := databasetest.NewTestUser(t)
+	if err := db.InsertUser(ctx, user); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var match models.Match
+	var state State
+	err := db.WithTx(ctx, func(repos database.Repos) error {
+		var err error
+		match, _, err = lobby.Open(ctx, repos, &uuid.FakeStrategy{},
+			user.UUID, "fremen")
+		if err != nil {
+			return err
+		}
+
+		var deleted bool
+		state, deleted, err = lobby.Cancel(ctx, repos, match.UUID, user.UUID)
+		if err == nil && !deleted {
+			t.Error("expected the lobby reported deleted")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if state.Seq != 1 {
+		t.Errorf("expected the seq of the creator joining, got %d", state.Seq)
+	}
+	if _, err := db.GetMatch(ctx, match.UUID); !errors.Is(
+		err, database.ErrNotFound) {
+		t.Errorf("expected the match deleted, got %v", err)
+	}
+	if events, err := db.LoadEvents(ctx, match.UUID, 0); err != nil ||
+		len(events) != 0 {
+		t.Errorf("expected the events deleted, got %v, %v", events, err)
+	}
+}
@@ -1,7 +1,15 @@
 package game
 
-import "duna/internal/models"
+import (
+	"duna/internal/models"
+	"time"
+)
 
-func initializeMatch() {
+// CreateMatch opens a new lobby owned by createdByUser
+func CreateMatch(uuids models.UUIDStrategy, createdByUser string) models.Match {
+	match := models.NewMatch(uuids.New(), models.WaitingPlayers)
+	match.CreatedByUser = createdByUser
+	match.CreatedAt = time.Now()
 
+	return match
 }
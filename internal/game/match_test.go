@@ -0,0 +1,22 @@
+package game
+
+import (
+	"duna/internal/models"
+	"duna/internal/uuid"
+	"testing"
+)
+
+func TestCreateMatch(t *testing.T) {
+	match := CreateMatch(&uuid.FakeStrategy{}, "creator")
+
+	if match.UUID != "00000000-0000-4000-8000-000000000001" {
+		t.Errorf("Expected UUID=00000000-0000-4000-8000-000000000001, got %s",
+			match.UUID)
+	}
+	if match.MatchState != models.WaitingPlayers {
+		t.Errorf("Expected MatchState=WaitingPlayers, got %d", match.MatchState)
+	}
+	if match.CreatedByUser != "creator" {
+		t.Errorf("Expected CreatedByUser=creator, got %s", match.CreatedByUser)
+	}
+}
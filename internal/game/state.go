@@ -0,0 +1,79 @@
+package game
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/models"
+	"errors"
+	"fmt"
+)
+
+const MAX_STATE_UPDATE_ATTEMPTS = 3
+
+var ErrIllegalTransition = errors.New("illegal match state transition")
+
+// UpdateMatchState reads the match and writes the state decide picks with a
+// compare and swap. When a concurrent writer changed the match in between,
+// it is read again and decide runs on the fresh copy, so the action is
+// either retried or rejected against the current state. An error from
+// decide rejects the action, after MAX_STATE_UPDATE_ATTEMPTS lost races it
+// fails with database.ErrStale
+func UpdateMatchState(
+	ctx context.Context,
+	matches database.MatchRepository,
+	uuid string,
+	decide func(match models.Match) (models.MatchState, error),
+) (models.Match, error) {
+	// a replica could hand back the version we just lost against
+	ctx = database.WithPrimaryReads(ctx)
+
+	var err error
+	for range MAX_STATE_UPDATE_ATTEMPTS {
+		var match models.Match
+		match, err = matches.GetMatch(ctx, uuid)
+		if err != nil {
+			return models.Match{}, err
+		}
+
+		var next models.MatchState
+		next, err = decide(match)
+		if err != nil {
+			return models.Match{}, err
+		}
+
+		var version int64
+		version, err = matches.UpdateMatchState(
+			ctx, uuid, match.Version, next)
+		if err == nil {
+			match.MatchState = next
+			match.Version = version
+			return match, nil
+		}
+
+		if !errors.Is(err, database.ErrStale) {
+			return models.Match{}, err
+		}
+	}
+
+	return models.Match{}, err
+}
+
+// TransitionMatch moves the match to next. It fails with
+// ErrIllegalTransition when the current state doesn't lead there, which
+// includes losing the race against a request doing the same transition
+func TransitionMatch(
+	ctx context.Context,
+	matches database.MatchRepository,
+	uuid string,
+	next models.MatchState,
+) (models.Match, error) {
+	return UpdateMatchState(ctx, matches, uuid,
+		func(match models.Match) (models.MatchState, error) {
+			if !match.MatchState.CanTransitionTo(next) {
+				return 0, fmt.Errorf("%w from %d to %d",
+					ErrIllegalTransition, match.MatchState, next)
+			}
+
+			return next, nil
+		})
+}
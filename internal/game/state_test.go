@@ -0,0 +1,108 @@
+package game
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/database/memory"
+	"duna/internal/models"
+	"duna/internal/uuid"
+	"errors"
+	"testing"
+)
+
+func TestTransitionMatch(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDatabase()
+	match := CreateMatch(&uuid.FakeStrategy{}, "creator")
+	if err := db.InsertMatch(ctx, match); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	started, err := TransitionMatch(ctx, db, match.UUID, models.InGame)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if started.MatchState != models.InGame || started.Version != 2 {
+		t.Errorf("expected InGame at version 2, got %d at %d",
+			started.MatchState, started.Version)
+	}
+
+	// starting twice, as two racing requests would
+	_, err = TransitionMatch(ctx, db, match.UUID, models.InGame)
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("expected illegal transition, got %v", err)
+	}
+
+	if _, err := TransitionMatch(
+		ctx, db, match.UUID, models.Finish); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestUpdateMatchStateRetriesStaleWrites(t *testing.T) {
+	versions := []int64{1, 2}
+	reads, writes := 0, 0
+
+	db := &database.MockDatabase{
+		FuncGetMatch: func(ctx context.Context,
+			uuid string) (models.Match, error) {
+			if !database.PrimaryReads(ctx) {
+				t.Error("expected reads from the primary")
+			}
+
+			match := models.NewMatch(uuid, models.WaitingPlayers)
+			match.Version = versions[reads]
+			reads++
+			return match, nil
+		},
+		FuncUpdateMatchState: func(ctx context.Context, uuid string,
+			version int64, state models.MatchState) (int64, error) {
+			writes++
+			// a concurrent writer bumped the version after the first read
+			if version != 2 {
+				return 0, &database.StaleError{
+					Entity: "match", Expected: version, Actual: 2}
+			}
+			return 3, nil
+		},
+	}
+
+	match, err := TransitionMatch(
+		context.Background(), db, "match", models.InGame)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reads != 2 || writes != 2 {
+		t.Errorf("expected 2 reads and 2 writes, got %d and %d",
+			reads, writes)
+	}
+	if match.Version != 3 {
+		t.Errorf("expected version 3, got %d", match.Version)
+	}
+}
+
+func TestUpdateMatchStateGivesUp(t *testing.T) {
+	writes := 0
+	db := &database.MockDatabase{
+		FuncGetMatch: func(ctx context.Context,
+			uuid string) (models.Match, error) {
+			return models.NewMatch(uuid, models.WaitingPlayers), nil
+		},
+		FuncUpdateMatchState: func(ctx context.Context, uuid string,
+			version int64, state models.MatchState) (int64, error) {
+			writes++
+			return 0, &database.StaleError{Entity: "match"}
+		},
+	}
+
+	_, err := TransitionMatch(
+		context.Background(), db, "match", models.InGame)
+	if !errors.Is(err, database.ErrStale) {
+		t.Errorf("expected stale error, got %v", err)
+	}
+	if writes != MAX_STATE_UPDATE_ATTEMPTS {
+		t.Errorf("expected %d writes, got %d",
+			MAX_STATE_UPDATE_ATTEMPTS, writes)
+	}
+}
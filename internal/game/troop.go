@@ -1,6 +1,7 @@
 package game
 
 import (
+	"duna/internal/models"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -19,6 +20,17 @@ type Troop struct {
 	MatchUUID   string      `json:"MatchUUID"`
 }
 
+// CreateTroop adds a new troop to the faction's reserves, troops start off
+// planet and without a position until they are shipped
+func CreateTroop(uuids models.UUIDStrategy, factionUUID, matchUUID string) Troop {
+	return Troop{
+		UUID:        uuids.New(),
+		Status:      OffPlanet,
+		FactionUUID: factionUUID,
+		MatchUUID:   matchUUID,
+	}
+}
+
 type TroopStatus int
 
 const (
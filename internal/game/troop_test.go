@@ -1,6 +1,7 @@
 package game
 
 import (
+	"duna/internal/uuid"
 	"encoding/json"
 	"strings"
 	"testing"
@@ -208,3 +209,23 @@ func TestTroopJSON(t *testing.T) {
 		}
 	})
 }
+
+func TestCreateTroop(t *testing.T) {
+	uuids := &uuid.FakeStrategy{}
+	first := CreateTroop(uuids, "faction", "match")
+	second := CreateTroop(uuids, "faction", "match")
+
+	if first.UUID == second.UUID {
+		t.Errorf("Expected different UUIDs, got %s twice", first.UUID)
+	}
+	if first.Status != OffPlanet {
+		t.Errorf("Expected Status=OffPlanet, got %v", first.Status)
+	}
+	if first.Position != nil {
+		t.Errorf("Expected no Position, got %v", first.Position)
+	}
+	if first.FactionUUID != "faction" || first.MatchUUID != "match" {
+		t.Errorf("Expected faction/match, got %s/%s",
+			first.FactionUUID, first.MatchUUID)
+	}
+}
@@ -0,0 +1,22 @@
+package hash
+
+import "golang.org/x/crypto/bcrypt"
+
+// BcryptStrategy hashes passwords with bcrypt, Cost is validated by the
+// configuration, see config.AuthConfig
+type BcryptStrategy struct {
+	Cost int
+}
+
+func (b BcryptStrategy) Encode(str string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(str), b.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashed), nil
+}
+
+func (b BcryptStrategy) Compare(enconded, str string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(enconded), []byte(str)) == nil
+}
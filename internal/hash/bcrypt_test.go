@@ -0,0 +1,38 @@
+package hash
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptStrategy(t *testing.T) {
+	strategy := BcryptStrategy{Cost: bcrypt.MinCost}
+
+	encoded, err := strategy.Encode("Sp1ce-must-flow")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{"same password", "Sp1ce-must-flow", true},
+		{"other password", "sp1ce-must-flow", false},
+		{"empty password", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strategy.Compare(encoded, tt.password); got != tt.want {
+				t.Errorf("Compare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if strategy.Compare("not a hash", "Sp1ce-must-flow") {
+		t.Error("expected a malformed hash not to match")
+	}
+}
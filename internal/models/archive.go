@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// MatchArchive is what remains of a match once the retention policy moved
+// it out of the matches table: a summary for history and stats, and its
+// whole event log
+type MatchArchive struct {
+	MatchUUID     string
+	CreatedByUser string
+	CreatedAt     time.Time
+	ArchivedAt    time.Time
+	Players       []ArchivedPlayer
+	// Winner is the winning faction, empty when the match had none
+	Winner     string
+	EventCount int
+	// Events is the gzipped JSON array of the match events
+	Events []byte
+}
+
+type ArchivedPlayer struct {
+	UserUUID string `json:"user_uuid"`
+	Faction  string `json:"faction,omitempty"`
+}
@@ -0,0 +1,80 @@
+package models
+
+// The board has 18 storm sectors, numbered from 0
+const STORM_SECTORS = 18
+
+// territory kinds
+const (
+	SAND_TERRITORY       = "sand"
+	ROCK_TERRITORY       = "rock"
+	STRONGHOLD_TERRITORY = "stronghold"
+	// POLAR_SINK_TERRITORY is the center of the board, out of every sector
+	POLAR_SINK_TERRITORY = "polar_sink"
+)
+
+// treachery card kinds
+const (
+	WEAPON_CARD    = "weapon"
+	DEFENSE_CARD   = "defense"
+	SPECIAL_CARD   = "special"
+	WORTHLESS_CARD = "worthless"
+)
+
+// GameContent is the static data the rules work with. It is versioned as a
+// data file and seeded into the database, every entry is identified by a
+// key that stays the same across seeds
+type GameContent struct {
+	Territories    []TerritoryDef     `yaml:"territories"`
+	Factions       []FactionDef       `yaml:"factions"`
+	Leaders        []LeaderDef        `yaml:"leaders"`
+	TreacheryCards []TreacheryCardDef `yaml:"treachery_cards"`
+	SpiceCards     []SpiceCardDef     `yaml:"spice_cards"`
+}
+
+type TerritoryDef struct {
+	Key  string `yaml:"key"`
+	Name string `yaml:"name"`
+	Kind string `yaml:"kind"`
+	// Sectors the territory spans, empty for the polar sink
+	Sectors []int `yaml:"sectors"`
+}
+
+type FactionDef struct {
+	Key           string `yaml:"key"`
+	Name          string `yaml:"name"`
+	StartingSpice int    `yaml:"starting_spice"`
+	// Reserves is the number of troops the faction owns in total
+	Reserves int `yaml:"reserves"`
+	// HomeTerritory is where StartingTroops are placed, empty when the
+	// faction starts off planet
+	HomeTerritory  string `yaml:"home_territory,omitempty"`
+	StartingTroops int    `yaml:"starting_troops"`
+}
+
+type LeaderDef struct {
+	Key      string `yaml:"key"`
+	Name     string `yaml:"name"`
+	Faction  string `yaml:"faction"`
+	Strength int    `yaml:"strength"`
+}
+
+type TreacheryCardDef struct {
+	Key  string `yaml:"key"`
+	Name string `yaml:"name"`
+	Kind string `yaml:"kind"`
+	// Subtype tells weapons and defenses apart, projectile or poison
+	Subtype     string `yaml:"subtype,omitempty"`
+	Copies      int    `yaml:"copies"`
+	Description string `yaml:"description,omitempty"`
+}
+
+type SpiceCardDef struct {
+	Key  string `yaml:"key"`
+	Name string `yaml:"name"`
+	// Worm cards are Shai-Hulud, they have no territory nor spice
+	Worm      bool   `yaml:"worm,omitempty"`
+	Territory string `yaml:"territory,omitempty"`
+	Sector    int    `yaml:"sector,omitempty"`
+	Amount    int    `yaml:"amount,omitempty"`
+	Copies    int    `yaml:"copies"`
+}
@@ -2,24 +2,188 @@ package models
 
 import (
 	"errors"
-	"regexp"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	MAX_EMAIL_LOCAL_LENGTH = 64
+	MAX_EMAIL_LENGTH       = 254
 )
 
+// EmailPolicy holds the rules an email is validated against
+type EmailPolicy struct {
+	// DeniedDomains rejects addresses on these domains and their subdomains,
+	// mostly meant for disposable email providers
+	DeniedDomains []string
+}
+
+var DefaultEmailPolicy = EmailPolicy{}
+
+// Email is an RFC 5322 addr-spec, stored as local@domain with the domain
+// lowercased and in its unicode form. Uniqueness and lookups go through
+// Canonical
 type Email string
 
-func checkEmailValid(email string) error {
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(string(email)) {
-		return errors.New("invalid email format")
+func NewEmail(email string) (Email, error) {
+	return DefaultEmailPolicy.NewEmail(email)
+}
+
+func (p EmailPolicy) NewEmail(email string) (Email, error) {
+	local, domain, err := parseAddrSpec(email)
+	if err != nil {
+		return "", err
+	}
+
+	for _, denied := range p.DeniedDomains {
+		deniedDomain, err := idna.Lookup.ToASCII(strings.TrimSpace(denied))
+		if err != nil {
+			continue
+		}
+
+		if domain == deniedDomain || strings.HasSuffix(domain, "."+deniedDomain) {
+			return "", errors.New("email domain is not allowed")
+		}
 	}
 
-	return nil
+	return displayEmail(local, domain), nil
 }
 
-func NewEmail(email string) (Email, error) {
-	if err := checkEmailValid(email); err != nil {
-		return "", err
+// StoredEmail trusts an email read back from the database, it was checked
+// when stored and older rules accepted addresses NewEmail now rejects, such
+// as a..b@x.com. Those are kept as they are, Canonical still works on them
+func StoredEmail(email string) Email {
+	local, domain, err := parseAddrSpec(email)
+	if err != nil {
+		return Email(strings.TrimSpace(email))
+	}
+
+	return displayEmail(local, domain)
+}
+
+// displayEmail puts the domain back in its unicode form
+func displayEmail(local, asciiDomain string) Email {
+	displayDomain, err := idna.Display.ToUnicode(asciiDomain)
+	if err != nil {
+		displayDomain = asciiDomain
+	}
+
+	return Email(local + "@" + displayDomain)
+}
+
+// Canonical is the lowercased address with the domain in its ASCII (punycode)
+// form
+func (e Email) Canonical() string {
+	return CanonicalEmail(string(e))
+}
+
+func (e Email) String() string {
+	return string(e)
+}
+
+// CanonicalEmail lowercases a raw address and converts its domain to ASCII,
+// strings that don't parse are only lowercased so lookups still work
+func CanonicalEmail(email string) string {
+	local, domain, err := parseAddrSpec(email)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(email))
+	}
+
+	return strings.ToLower(local) + "@" + domain
+}
+
+// parseAddrSpec validates a bare addr-spec (no display name or angle
+// brackets) and returns its local part and ASCII domain
+func parseAddrSpec(email string) (string, string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", "", errors.New("invalid email format")
+	}
+	if strings.ContainsAny(email, "<>") {
+		return "", "", errors.New("invalid email format")
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" {
+		return "", "", errors.New("invalid email format")
+	}
+
+	at := strings.LastIndex(address.Address, "@")
+	local, domain := address.Address[:at], address.Address[at+1:]
+	// net/mail unquotes the local part, put the quotes back when needed
+	local = quoteLocalPart(local)
+
+	if len(local) > MAX_EMAIL_LOCAL_LENGTH {
+		return "", "", errors.New("email local part is too long")
+	}
+
+	// domain literals such as [127.0.0.1] are valid addr-specs but nobody
+	// registers with them
+	if strings.HasPrefix(domain, "[") {
+		return "", "", errors.New("invalid email domain")
+	}
+
+	asciiDomain, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", "", errors.New("invalid email domain")
+	}
+
+	labels := strings.Split(asciiDomain, ".")
+	if len(labels) < 2 || !isTopLevelDomain(labels[len(labels)-1]) {
+		return "", "", errors.New("invalid email domain")
+	}
+
+	if len(local)+1+len(asciiDomain) > MAX_EMAIL_LENGTH {
+		return "", "", errors.New("email is too long")
+	}
+
+	return local, asciiDomain, nil
+}
+
+func isTopLevelDomain(label string) bool {
+	if len(label) < 2 {
+		return false
+	}
+
+	// punycode TLDs are fine, numeric ones would be an IP address
+	for _, c := range label {
+		if (c < '0' || c > '9') && c != '-' {
+			return true
+		}
+	}
+
+	return false
+}
+
+func quoteLocalPart(local string) string {
+	isDotAtom := !strings.HasPrefix(local, ".") &&
+		!strings.HasSuffix(local, ".") &&
+		!strings.Contains(local, "..")
+	for _, c := range local {
+		if !isAtext(c) && c != '.' {
+			isDotAtom = false
+		}
+	}
+
+	if isDotAtom {
+		return local
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(local)
+	return `"` + escaped + `"`
+}
+
+// isAtext reports whether c may appear unquoted in a local part, as defined
+// by RFC 5322 plus the UTF-8 extension of RFC 6532
+func isAtext(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c > 0x7f:
+		return true
 	}
 
-	return Email(email), nil
+	return strings.ContainsRune("!#$%&'*+-/=?^_`{|}~", c)
 }
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Email
+		wantErr  bool
+	}{
+		{"simple", "paul@arrakis.com", "paul@arrakis.com", false},
+		{"plus and dots", "paul.atreides+dune@arrakis.com",
+			"paul.atreides+dune@arrakis.com", false},
+		{"keeps local case", "Paul@ARRAKIS.com", "Paul@arrakis.com", false},
+		{"trims spaces", " paul@arrakis.com ", "paul@arrakis.com", false},
+		{"internationalised domain", "paul@münchen.de", "paul@münchen.de", false},
+		{"punycode domain", "paul@xn--mnchen-3ya.de", "paul@münchen.de", false},
+		{"unicode local part", "jéssica@arrakis.com", "jéssica@arrakis.com", false},
+		{"quoted local part", `"paul atreides"@arrakis.com`,
+			`"paul atreides"@arrakis.com`, false},
+		{"empty", "", "", true},
+		{"missing at", "paul.arrakis.com", "", true},
+		{"missing domain", "paul@", "", true},
+		{"single label domain", "paul@localhost", "", true},
+		{"consecutive dots local", "paul..atreides@arrakis.com", "", true},
+		{"consecutive dots domain", "paul@arrakis..com", "", true},
+		{"leading dot", ".paul@arrakis.com", "", true},
+		{"display name", "Paul <paul@arrakis.com>", "", true},
+		{"domain literal", "paul@[127.0.0.1]", "", true},
+		{"numeric tld", "paul@1.2.3.4", "", true},
+		{"hyphen label", "paul@-arrakis.com", "", true},
+		{"local part too long",
+			strings.Repeat("a", MAX_EMAIL_LOCAL_LENGTH+1) + "@arrakis.com",
+			"", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewEmail(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewEmail() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.expected {
+				t.Errorf("NewEmail() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEmailPolicy(t *testing.T) {
+	policy := EmailPolicy{DeniedDomains: []string{"mailinator.com", "münchen.de"}}
+
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{"paul@arrakis.com", false},
+		{"paul@mailinator.com", true},
+		{"paul@MAILINATOR.COM", true},
+		{"paul@eu.mailinator.com", true},
+		{"paul@notmailinator.com", false},
+		{"paul@xn--mnchen-3ya.de", true},
+	}
+
+	for _, tt := range tests {
+		_, err := policy.NewEmail(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewEmail(%q) error = %v, wantErr %v",
+				tt.input, err, tt.wantErr)
+		}
+	}
+}
+
+func TestStoredEmail(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Email
+	}{
+		{"Paul@XN--MNCHEN-3YA.DE", "Paul@münchen.de"},
+		// NewEmail rejects these, they still load
+		{"a..b@x.com", "a..b@x.com"},
+		{" paul@localhost ", "paul@localhost"},
+	}
+
+	for _, tt := range tests {
+		if got := StoredEmail(tt.input); got != tt.expected {
+			t.Errorf("StoredEmail(%q) = %q, want %q", tt.input, got,
+				tt.expected)
+		}
+	}
+}
+
+func TestEmailCanonical(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Paul@Arrakis.COM", "paul@arrakis.com"},
+		{"paul@münchen.de", "paul@xn--mnchen-3ya.de"},
+		{"PAUL@XN--MNCHEN-3YA.DE", "paul@xn--mnchen-3ya.de"},
+		{"not an email", "not an email"},
+	}
+
+	for _, tt := range tests {
+		if got := CanonicalEmail(tt.input); got != tt.expected {
+			t.Errorf("CanonicalEmail(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+
+	email, err := NewEmail("Paul@münchen.de")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if email.Canonical() != "paul@xn--mnchen-3ya.de" {
+		t.Errorf("expected canonical paul@xn--mnchen-3ya.de, got %q",
+			email.Canonical())
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MatchEvent is one action taken in a match. Seq numbers the events of a
+// match from 1 without gaps, the event store rejects a seq already taken
+type MatchEvent struct {
+	MatchUUID string
+	Seq       int64
+	// ActorUUID is the user who acted, empty for actions of the game itself
+	ActorUUID string
+	Faction   string
+	Type      string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// MatchSnapshot is the state of a match once every event up to Seq has been
+// applied, its encoding is up to the game package
+type MatchSnapshot struct {
+	MatchUUID string
+	Seq       int64
+	State     json.RawMessage
+	CreatedAt time.Time
+}
@@ -1,5 +1,10 @@
 package models
 
+import "time"
+
+// One seat per faction
+const MAX_PLAYERS = 6
+
 type MatchState int
 
 const (
@@ -12,6 +17,19 @@ type Match struct {
 	UUID          string
 	MatchState    MatchState
 	CreatedByUser string
+	CreatedAt     time.Time
+	// FinishedAt is zero until the match moves to Finish
+	FinishedAt time.Time
+	// Version is bumped on every state change, see
+	// database.MatchRepository.UpdateMatchState
+	Version int64
+	// Seats are the players in the match, in the order they joined
+	Seats []Seat
+}
+
+type Seat struct {
+	UserUUID string
+	JoinedAt time.Time
 }
 
 func NewMatch(uuid string, matchState MatchState) Match {
@@ -20,3 +38,23 @@ func NewMatch(uuid string, matchState MatchState) Match {
 		MatchState: matchState,
 	}
 }
+
+func (s MatchState) Valid() bool {
+	return s >= WaitingPlayers && s <= Finish
+}
+
+// CanTransitionTo tells whether a match may go from s to next, matches only
+// move forward: WaitingPlayers -> InGame -> Finish
+func (s MatchState) CanTransitionTo(next MatchState) bool {
+	return s.Valid() && next == s+1 && next.Valid()
+}
+
+func (m Match) HasPlayer(userUUID string) bool {
+	for _, seat := range m.Seats {
+		if seat.UserUUID == userUUID {
+			return true
+		}
+	}
+
+	return false
+}
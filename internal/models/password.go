@@ -74,6 +74,11 @@ func (p Password) Compare(incomingPassword string) bool {
 	return p.hash.Compare(p.value, incomingPassword)
 }
 
+// Hashed returns the encoded password, as it should be persisted
+func (p Password) Hashed() string {
+	return p.value
+}
+
 // Always obfuscate when converted to string
 func (p Password) String() string {
 	return "********"
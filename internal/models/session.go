@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is a login of a user. The token handed to the client is not kept,
+// only its hash, see auth.HashToken
+type Session struct {
+	TokenHash string    `json:"-"`
+	UserUUID  string    `json:"user_uuid"`
+	CSRFToken string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
@@ -1,40 +1,77 @@
 package models
 
-import "duna/internal/hash"
+import (
+	"duna/internal/hash"
+	"fmt"
+)
 
+// UUIDStrategy generates identifiers for new entities, see the uuid package
+// for the implementations
 type UUIDStrategy interface {
 	New() string
 }
 
+// Role grants permissions on top of playing
+type Role string
+
+const (
+	PLAYER_ROLE Role = "player"
+	ADMIN_ROLE  Role = "admin"
+)
+
+var ROLES = []Role{PLAYER_ROLE, ADMIN_ROLE}
+
+func ParseRole(role string) (Role, error) {
+	if r := Role(role); r.Valid() {
+		return r, nil
+	}
+
+	return "", fmt.Errorf("unknown role %q, expected one of %v", role, ROLES)
+}
+
+func (r Role) Valid() bool {
+	return r == PLAYER_ROLE || r == ADMIN_ROLE
+}
+
 type User struct {
-	UUID     string `json:"uuid"`
-	Username string `json:"username"`
-	Email    Email  `json:"email"`
+	UUID     string   `json:"uuid"`
+	Username Username `json:"username"`
+	Email    Email    `json:"email"`
+	Role     Role     `json:"role"`
+	// Disabled users can't log in
+	Disabled bool `json:"disabled"`
 	password Password
 }
 
-func NewUser(UUID, Username string, Email Email, Password Password) User {
+// NewUser builds an enabled player
+func NewUser(UUID string, Username Username, Email Email,
+	Password Password) User {
 	return User{
 		UUID:     UUID,
 		Username: Username,
 		Email:    Email,
+		Role:     PLAYER_ROLE,
 		password: Password,
 	}
 }
 
-func NewUserFromPrimitives(UUID, Username, Email, Password string,
-	passwordAlreadyHashed bool, hash hash.HashStrategy) (User, error) {
-	emailObj, err := NewEmail(Email)
-	if err != nil {
-		return User{}, err
-	}
+// CreateUser builds a brand new user whose UUID is assigned by uuids
+func CreateUser(uuids UUIDStrategy, Username Username, Email Email,
+	Password Password) User {
+	return NewUser(uuids.New(), Username, Email, Password)
+}
 
-	passwordObj, err := NewPassword(Password, true, nil)
+func NewUserFromPrimitives(UUID, username, Email, Password string,
+	passwordAlreadyHashed bool, hash hash.HashStrategy) (User, error) {
+	passwordObj, err := NewPassword(Password, passwordAlreadyHashed, hash)
 	if err != nil {
 		return User{}, err
 	}
 
-	return NewUser(UUID, Username, emailObj, passwordObj), nil
+	// usernames and emails are not validated again, they were checked when
+	// the user registered and the rules may have tightened since then
+	return NewUser(UUID, Username(username), StoredEmail(Email),
+		passwordObj), nil
 }
 
 func (u *User) Password() Password {
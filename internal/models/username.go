@@ -0,0 +1,205 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	MIN_USERNAME_LENGTH = 3
+	MAX_USERNAME_LENGTH = 32
+)
+
+// Names nobody can register, compared against the canonical form with
+// separators removed so "Bene-Gesserit" is caught as well
+var DefaultReservedUsernames = []string{
+	"admin",
+	"administrator",
+	"root",
+	"system",
+	"moderator",
+	"support",
+	"duna",
+	"atreides",
+	"harkonnen",
+	"fremen",
+	"emperor",
+	"guild",
+	"spacingguild",
+	"benegesserit",
+}
+
+// ProfanityFilter decides if a canonical username is offensive
+type ProfanityFilter interface {
+	IsProfane(canonical string) bool
+}
+
+// WordListProfanityFilter flags usernames containing any of its words
+type WordListProfanityFilter struct {
+	words []string
+}
+
+func NewWordListProfanityFilter(words []string) WordListProfanityFilter {
+	canonical := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = CanonicalUsername(word); word != "" {
+			canonical = append(canonical, stripUsernameSeparators(word))
+		}
+	}
+
+	return WordListProfanityFilter{words: canonical}
+}
+
+func (f WordListProfanityFilter) IsProfane(canonical string) bool {
+	stripped := stripUsernameSeparators(canonical)
+	for _, word := range f.words {
+		if strings.Contains(stripped, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UsernamePolicy holds the rules a username is validated against
+type UsernamePolicy struct {
+	MinLength int
+	MaxLength int
+	Reserved  []string
+	Profanity ProfanityFilter
+}
+
+var DefaultUsernamePolicy = UsernamePolicy{
+	MinLength: MIN_USERNAME_LENGTH,
+	MaxLength: MAX_USERNAME_LENGTH,
+	Reserved:  DefaultReservedUsernames,
+}
+
+// Username is stored NFKC normalised, preserving the case the user typed.
+// Uniqueness and lookups go through Canonical
+type Username string
+
+func NewUsername(username string) (Username, error) {
+	return DefaultUsernamePolicy.NewUsername(username)
+}
+
+func (p UsernamePolicy) NewUsername(username string) (Username, error) {
+	normalized := norm.NFKC.String(strings.TrimSpace(username))
+
+	length := utf8.RuneCountInString(normalized)
+	if length < p.MinLength {
+		return "", fmt.Errorf("username must be at least %d characters long",
+			p.MinLength)
+	}
+	if length > p.MaxLength {
+		return "", fmt.Errorf("username must be at most %d characters long",
+			p.MaxLength)
+	}
+
+	if err := checkUsernameCharacters(normalized); err != nil {
+		return "", err
+	}
+
+	canonical := CanonicalUsername(normalized)
+	stripped := stripUsernameSeparators(canonical)
+	for _, reserved := range p.Reserved {
+		if stripped == stripUsernameSeparators(CanonicalUsername(reserved)) {
+			return "", errors.New("username is reserved")
+		}
+	}
+
+	if p.Profanity != nil && p.Profanity.IsProfane(canonical) {
+		return "", errors.New("username is not allowed")
+	}
+
+	return Username(normalized), nil
+}
+
+// Canonical is the case folded form used to compare usernames
+func (u Username) Canonical() string {
+	return CanonicalUsername(string(u))
+}
+
+func (u Username) String() string {
+	return string(u)
+}
+
+// CanonicalUsername applies NFKC and Unicode case folding to a raw string,
+// so "ＡＤＭＩＮ" and "admin" compare equal
+func CanonicalUsername(username string) string {
+	folded := cases.Fold().String(norm.NFKC.String(strings.TrimSpace(username)))
+	// folding can produce denormalised sequences, normalise once more
+	return norm.NFKC.String(folded)
+}
+
+// Scripts a username may be written in, letters from two different scripts
+// in one name are rejected since that is how most lookalikes are built
+var usernameScripts = []*unicode.RangeTable{
+	unicode.Latin,
+	unicode.Greek,
+	unicode.Cyrillic,
+	unicode.Arabic,
+	unicode.Hebrew,
+	unicode.Han,
+	unicode.Hiragana,
+	unicode.Katakana,
+	unicode.Hangul,
+}
+
+func checkUsernameCharacters(username string) error {
+	var script *unicode.RangeTable
+	for i, c := range username {
+		switch {
+		case c == '_' || c == '-' || c == '.':
+			if i == 0 {
+				return errors.New("username must start with a letter or number")
+			}
+		case unicode.IsDigit(c):
+		case unicode.IsLetter(c) &&
+			unicode.In(c, unicode.Common, unicode.Inherited):
+			// marks such as the katakana 'ー' belong to no script in particular
+		case unicode.IsLetter(c):
+			current := letterScript(c)
+			if current == nil {
+				return fmt.Errorf("username contains unsupported letter %q", c)
+			}
+
+			// Han is written alongside kana in japanese names
+			if script != nil && script != current &&
+				!(isJapaneseScript(script) && isJapaneseScript(current)) {
+				return errors.New("username mixes letters from different scripts")
+			}
+			script = current
+		default:
+			return fmt.Errorf("username contains invalid character %q", c)
+		}
+	}
+
+	return nil
+}
+
+func letterScript(c rune) *unicode.RangeTable {
+	for _, script := range usernameScripts {
+		if unicode.Is(script, c) {
+			return script
+		}
+	}
+
+	return nil
+}
+
+func isJapaneseScript(script *unicode.RangeTable) bool {
+	return script == unicode.Han ||
+		script == unicode.Hiragana ||
+		script == unicode.Katakana
+}
+
+func stripUsernameSeparators(username string) string {
+	return strings.NewReplacer("_", "", "-", "", ".", "").Replace(username)
+}
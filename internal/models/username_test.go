@@ -0,0 +1,101 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Username
+		wantErr  bool
+	}{
+		{"simple", "paul", "paul", false},
+		{"keeps case", "PaulMuadDib", "PaulMuadDib", false},
+		{"separators", "paul_muad-dib.1", "paul_muad-dib.1", false},
+		{"trims spaces", "  paul  ", "paul", false},
+		{"fullwidth is normalised", "ｐａｕｌ", "paul", false},
+		{"accented latin", "jéssica", "jéssica", false},
+		{"japanese", "ポール太郎", "ポール太郎", false},
+		{"too short", "pa", "", true},
+		{"too long", strings.Repeat("a", MAX_USERNAME_LENGTH+1), "", true},
+		{"leading separator", "_paul", "", true},
+		{"spaces inside", "paul atreides", "", true},
+		{"symbols", "paul!", "", true},
+		{"mixed scripts", "pаul", "", true}, // cyrillic а
+		{"reserved", "admin", "", true},
+		{"reserved ignoring case", "ADMIN", "", true},
+		{"reserved fullwidth", "ＡＤＭＩＮ", "", true},
+		{"reserved faction", "Bene-Gesserit", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewUsername(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewUsername() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.expected {
+				t.Errorf("NewUsername() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUsernamePolicy(t *testing.T) {
+	policy := UsernamePolicy{
+		MinLength: 1,
+		MaxLength: 10,
+		Reserved:  []string{"gurney"},
+		Profanity: NewWordListProfanityFilter([]string{"worm"}),
+	}
+
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{"p", false},
+		{"admin", false},
+		{"Gurney", true},
+		{"sandworm", true},
+		{"SAND_WORM", true},
+		{"paulatreides", true},
+	}
+
+	for _, tt := range tests {
+		_, err := policy.NewUsername(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewUsername(%q) error = %v, wantErr %v",
+				tt.input, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUsernameCanonical(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"Paul", "paul"},
+		{"ＰＡＵＬ", "paul"},
+		{"STRASSE", "straße"},
+	}
+
+	for _, tt := range tests {
+		if CanonicalUsername(tt.a) != CanonicalUsername(tt.b) {
+			t.Errorf("expected %q and %q to have the same canonical form, "+
+				"got %q and %q", tt.a, tt.b,
+				CanonicalUsername(tt.a), CanonicalUsername(tt.b))
+		}
+	}
+
+	username, err := NewUsername("Paul")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if username.Canonical() != "paul" {
+		t.Errorf("expected canonical paul, got %q", username.Canonical())
+	}
+}
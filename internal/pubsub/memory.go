@@ -0,0 +1,47 @@
+package pubsub
+
+import "context"
+
+// MemoryPubSub delivers messages within the process, it is enough for a
+// single instance and for tests
+type MemoryPubSub struct {
+	hub *hub
+}
+
+var _ PubSub = (*MemoryPubSub)(nil)
+
+func NewMemoryPubSub() *MemoryPubSub {
+	return &MemoryPubSub{hub: newHub()}
+}
+
+func (m *MemoryPubSub) Publish(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.hub.dispatch(msg)
+	return nil
+}
+
+func (m *MemoryPubSub) Subscribe(
+	ctx context.Context,
+	matchUUID string,
+	afterSeq int64,
+) (*Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s, _, err := m.hub.subscribe(matchUUID, afterSeq, true)
+	if err != nil {
+		return nil, err
+	}
+
+	endWith(ctx, s)
+	return s, nil
+}
+
+func (m *MemoryPubSub) Close() error {
+	m.hub.close()
+	return nil
+}
@@ -0,0 +1,329 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"duna/internal/database"
+	"duna/internal/database/postgres"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CHANNEL_PREFIX names the LISTEN/NOTIFY channel of each match, followed by
+// the match uuid
+const CHANNEL_PREFIX = "match_"
+
+// execer publishes, *sql.DB and *sql.Tx both implement it
+type execer interface {
+	ExecContext(
+		ctx context.Context,
+		query string,
+		args ...any,
+	) (sql.Result, error)
+}
+
+// listenerConn is the dedicated connection receiving the notifications,
+// *pgx.Conn implements it
+type listenerConn interface {
+	Exec(
+		ctx context.Context,
+		sql string,
+		arguments ...any,
+	) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Close(ctx context.Context) error
+}
+
+// PostgresPubSub carries messages between instances with LISTEN/NOTIFY.
+// Publishing goes through the pool, receiving holds one connection of its
+// own, reopened with backoff when it is lost. Notifications sent while it
+// was down are gone, so every subscriber gets a gap once it is back
+type PostgresPubSub struct {
+	hub     *hub
+	db      execer
+	connect func(ctx context.Context) (listenerConn, error)
+	// report is told about lost connections, it may be nil
+	report func(err error)
+	// wake interrupts the wait for notifications when the matches to
+	// listen to change
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var _ PubSub = (*PostgresPubSub)(nil)
+
+// NewPostgresPubSub starts listening in the background, connection errors
+// are passed to report
+func NewPostgresPubSub(
+	db *sql.DB,
+	connectionString string,
+	report func(err error),
+) *PostgresPubSub {
+	return newPostgresPubSub(db, func(
+		ctx context.Context,
+	) (listenerConn, error) {
+		return pgx.Connect(ctx, connectionString)
+	}, report)
+}
+
+func newPostgresPubSub(
+	db execer,
+	connect func(ctx context.Context) (listenerConn, error),
+	report func(err error),
+) *PostgresPubSub {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := &PostgresPubSub{
+		hub:     newHub(),
+		db:      db,
+		connect: connect,
+		report:  report,
+		wake:    make(chan struct{}, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go p.run(ctx)
+
+	return p
+}
+
+// New picks the implementation matching db: instances sharing a postgres
+// database notify each other, the memory database only has one
+func New(db database.Database, report func(err error)) PubSub {
+	if pg, ok := db.(*postgres.PostgresDatabase); ok {
+		return NewPostgresPubSub(pg.DB, pg.ConnectionString(), report)
+	}
+
+	return NewMemoryPubSub()
+}
+
+// Channel returns the notification channel of a match
+func Channel(matchUUID string) string {
+	return CHANNEL_PREFIX + matchUUID
+}
+
+// Publish notifies every instance, itself included. NOTIFY is
+// transactional: use PublishTx to send it with the commit of the events
+func (p *PostgresPubSub) Publish(ctx context.Context, msg Message) error {
+	return PublishTx(ctx, p.db, msg)
+}
+
+// PublishTx notifies through tx, the message is only sent if tx commits
+func PublishTx(ctx context.Context, tx execer, msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2)",
+		Channel(msg.MatchUUID), string(payload)); err != nil {
+		return fmt.Errorf("failed to publish seq %d of match %s: %w",
+			msg.Seq, msg.MatchUUID, err)
+	}
+
+	return nil
+}
+
+// Subscribe waits until the match is listened to, so it blocks while the
+// connection is down
+func (p *PostgresPubSub) Subscribe(
+	ctx context.Context,
+	matchUUID string,
+	afterSeq int64,
+) (*Subscription, error) {
+	s, ready, err := p.hub.subscribe(matchUUID, afterSeq, false)
+	if err != nil {
+		return nil, err
+	}
+	p.wakeUp()
+
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		s.Close()
+		return nil, ctx.Err()
+	case <-p.done:
+		s.Close()
+		return nil, ErrClosed
+	}
+
+	endWith(ctx, s)
+	return s, nil
+}
+
+func (p *PostgresPubSub) Close() error {
+	p.cancel()
+	<-p.done
+	p.hub.close()
+	return nil
+}
+
+func (p *PostgresPubSub) wakeUp() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run keeps a listening connection open until ctx is done
+func (p *PostgresPubSub) run(ctx context.Context) {
+	defer close(p.done)
+
+	delay := database.CONNECT_RETRY_DELAY
+	reconnecting := false
+	for {
+		connected, err := p.listen(ctx, reconnecting)
+		if ctx.Err() != nil {
+			return
+		}
+		if p.report != nil {
+			p.report(fmt.Errorf("lost the notification connection: %w", err))
+		}
+
+		if connected {
+			delay = database.CONNECT_RETRY_DELAY
+			reconnecting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay/2 + rand.N(delay/2)):
+		}
+
+		delay = min(delay*2, database.MAX_CONNECT_RETRY_DELAY)
+	}
+}
+
+// listen receives notifications on one connection until it fails, it
+// reports whether the connection was established
+func (p *PostgresPubSub) listen(
+	ctx context.Context,
+	reconnecting bool,
+) (bool, error) {
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	listening := map[string]bool{}
+	for {
+		if err := p.syncChannels(ctx, conn, listening); err != nil {
+			return true, err
+		}
+		if reconnecting {
+			p.hub.lost()
+			reconnecting = false
+		}
+
+		notification, err := p.waitForNotification(ctx, conn)
+		if errors.Is(err, errWoken) {
+			continue
+		}
+		if err != nil {
+			return true, err
+		}
+
+		p.dispatch(notification)
+	}
+}
+
+// syncChannels listens to the matches with subscribers and stops listening
+// to the others
+func (p *PostgresPubSub) syncChannels(
+	ctx context.Context,
+	conn listenerConn,
+	listening map[string]bool,
+) error {
+	wanted := map[string]bool{}
+	for _, matchUUID := range p.hub.matches() {
+		wanted[matchUUID] = true
+	}
+
+	for matchUUID := range listening {
+		if wanted[matchUUID] {
+			continue
+		}
+
+		if _, err := conn.Exec(ctx, "UNLISTEN "+
+			pgx.Identifier{Channel(matchUUID)}.Sanitize()); err != nil {
+			return err
+		}
+		delete(listening, matchUUID)
+	}
+
+	for matchUUID := range wanted {
+		if listening[matchUUID] {
+			continue
+		}
+
+		if _, err := conn.Exec(ctx, "LISTEN "+
+			pgx.Identifier{Channel(matchUUID)}.Sanitize()); err != nil {
+			return err
+		}
+		listening[matchUUID] = true
+		p.hub.markReady(matchUUID)
+	}
+
+	return nil
+}
+
+var errWoken = errors.New("woken")
+
+// waitForNotification returns errWoken when a subscription changed the
+// matches to listen to. pgx leaves the connection usable when the wait is
+// interrupted
+func (p *PostgresPubSub) waitForNotification(
+	ctx context.Context,
+	conn listenerConn,
+) (*pgconn.Notification, error) {
+	waitCtx, cancel := context.WithCancel(ctx)
+
+	woken := false
+	watcher := make(chan struct{})
+	go func() {
+		defer close(watcher)
+		select {
+		case <-p.wake:
+			woken = true
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	notification, err := conn.WaitForNotification(waitCtx)
+	cancel()
+	// a wake up taken by the watcher after the wait returned is not lost,
+	// the channels are synced before every wait
+	<-watcher
+
+	if err != nil && woken {
+		return nil, errWoken
+	}
+
+	return notification, err
+}
+
+// dispatch drops malformed payloads, anyone may NOTIFY
+func (p *PostgresPubSub) dispatch(notification *pgconn.Notification) {
+	var msg Message
+	if err := json.Unmarshal([]byte(notification.Payload), &msg); err != nil {
+		return
+	}
+
+	matchUUID, ok := strings.CutPrefix(notification.Channel, CHANNEL_PREFIX)
+	if !ok || matchUUID != msg.MatchUUID {
+		return
+	}
+
+	p.hub.dispatch(msg)
+}
@@ -0,0 +1,188 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeConn hands out the notifications sent to it until it fails
+type fakeConn struct {
+	notifications chan *pgconn.Notification
+	failed        chan struct{}
+
+	mu        sync.Mutex
+	listening map[string]bool
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		notifications: make(chan *pgconn.Notification),
+		failed:        make(chan struct{}),
+		listening:     map[string]bool{},
+	}
+}
+
+func (c *fakeConn) Exec(
+	ctx context.Context,
+	sql string,
+	arguments ...any,
+) (pgconn.CommandTag, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	command, channel, _ := strings.Cut(sql, " ")
+	c.listening[strings.Trim(channel, `"`)] = command == "LISTEN"
+	return pgconn.CommandTag{}, nil
+}
+
+func (c *fakeConn) WaitForNotification(
+	ctx context.Context,
+) (*pgconn.Notification, error) {
+	select {
+	case notification := <-c.notifications:
+		return notification, nil
+	case <-c.failed:
+		return nil, errors.New("connection reset by peer")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakeConn) Close(ctx context.Context) error {
+	return nil
+}
+
+func (c *fakeConn) isListening(channel string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.listening[channel]
+}
+
+func (c *fakeConn) notify(t *testing.T, matchUUID string, seq int64) {
+	t.Helper()
+
+	select {
+	case c.notifications <- &pgconn.Notification{
+		Channel: Channel(matchUUID),
+		Payload: fmt.Sprintf(`{"match_uuid":%q,"seq":%d}`, matchUUID, seq),
+	}:
+	case <-time.After(time.Second):
+		t.Fatalf("timed out notifying seq %d", seq)
+	}
+}
+
+// newFakePubSub connects to conns in order
+func newFakePubSub(t *testing.T, conns ...*fakeConn) *PostgresPubSub {
+	t.Helper()
+
+	var mu sync.Mutex
+	ps := newPostgresPubSub(nil, func(
+		ctx context.Context,
+	) (listenerConn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(conns) == 0 {
+			return nil, errors.New("connection refused")
+		}
+		conn := conns[0]
+		conns = conns[1:]
+		return conn, nil
+	}, nil)
+	t.Cleanup(func() { ps.Close() })
+
+	return ps
+}
+
+func TestPostgresListensPerMatch(t *testing.T) {
+	conn := newFakeConn()
+	ps := newFakePubSub(t, conn)
+
+	s := subscribe(t, ps, MATCH_A, 0)
+	if !conn.isListening(Channel(MATCH_A)) {
+		t.Fatal("expected Subscribe to return once listening")
+	}
+
+	conn.notify(t, MATCH_A, 1)
+	expectMessage(t, s, Message{MatchUUID: MATCH_A, Seq: 1})
+
+	s.Close()
+	// the next wake up unlistens, the fake drops the notification
+	other := subscribe(t, ps, MATCH_B, 0)
+	if conn.isListening(Channel(MATCH_A)) {
+		t.Error("expected the match without subscribers to be unlistened")
+	}
+	conn.notify(t, MATCH_B, 3)
+	expectMessage(t, other, Message{MatchUUID: MATCH_B, Seq: 3, Gap: true})
+}
+
+func TestPostgresReconnectSendsGap(t *testing.T) {
+	first, second := newFakeConn(), newFakeConn()
+	ps := newFakePubSub(t, first, second)
+
+	s := subscribe(t, ps, MATCH_A, 0)
+	first.notify(t, MATCH_A, 1)
+	expectMessage(t, s, Message{MatchUUID: MATCH_A, Seq: 1})
+
+	close(first.failed)
+
+	// notifications sent while reconnecting are lost, the subscriber must
+	// reload what follows seq 1
+	expectMessage(t, s, Message{MatchUUID: MATCH_A, Seq: 1, Gap: true})
+	if !second.isListening(Channel(MATCH_A)) {
+		t.Error("expected the match to be listened to again")
+	}
+
+	second.notify(t, MATCH_A, 2)
+	expectMessage(t, s, Message{MatchUUID: MATCH_A, Seq: 2})
+}
+
+func TestPostgresDropsForeignPayloads(t *testing.T) {
+	conn := newFakeConn()
+	ps := newFakePubSub(t, conn)
+
+	s := subscribe(t, ps, MATCH_A, 0)
+
+	for _, payload := range []string{"not json",
+		fmt.Sprintf(`{"match_uuid":%q,"seq":1}`, MATCH_B)} {
+		conn.notifications <- &pgconn.Notification{
+			Channel: Channel(MATCH_A),
+			Payload: payload,
+		}
+	}
+
+	conn.notify(t, MATCH_A, 2)
+	expectMessage(t, s, Message{MatchUUID: MATCH_A, Seq: 2, Gap: true})
+}
+
+func TestPublishNotifies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("unexpected error opening sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`SELECT pg_notify\(\$1, \$2\)`).
+		WithArgs(Channel(MATCH_A),
+			fmt.Sprintf(`{"match_uuid":%q,"seq":7}`, MATCH_A)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = PublishTx(context.Background(), db,
+		Message{MatchUUID: MATCH_A, Seq: 7, Gap: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
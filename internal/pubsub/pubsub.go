@@ -0,0 +1,277 @@
+// Package pubsub tells every server instance about the events appended to
+// a match, so a player connected to one instance sees the moves processed
+// on another. Messages only carry the seq of the last event, subscribers
+// load the events themselves from database.EventRepository
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrClosed = errors.New("pubsub closed")
+
+// Message announces that the events of a match up to Seq were appended.
+// Publish it once they are committed
+type Message struct {
+	MatchUUID string `json:"match_uuid"`
+	Seq       int64  `json:"seq"`
+	// Deleted announces the match is gone along with its events, Seq is
+	// the last one it had. It is delivered whatever the seq and nothing
+	// follows it
+	Deleted bool `json:"deleted,omitempty"`
+	// Gap is set on delivery when messages were missed since the previous
+	// one: the subscriber was too slow, a publisher skipped a seq or the
+	// connection was lost. Events after the last seq the subscriber applied
+	// must be reloaded from the event store
+	Gap bool `json:"-"`
+}
+
+type PubSub interface {
+	Publish(ctx context.Context, msg Message) error
+	// Subscribe delivers the messages of a match with a seq above afterSeq,
+	// the seq the subscriber already has. When it returns, messages
+	// published afterwards are guaranteed to be delivered. The subscription
+	// ends with ctx or Close
+	Subscribe(ctx context.Context, matchUUID string,
+		afterSeq int64) (*Subscription, error)
+	// Close ends every subscription
+	Close() error
+}
+
+// Subscription holds at most one undelivered message: when the subscriber
+// is slow, pending messages are merged into the latest one, flagged as a
+// gap
+type Subscription struct {
+	matchUUID string
+	messages  chan Message
+	remove    func(s *Subscription)
+
+	mu      sync.Mutex
+	lastSeq int64
+	closed  bool
+}
+
+func newSubscription(
+	matchUUID string,
+	afterSeq int64,
+	remove func(s *Subscription),
+) *Subscription {
+	return &Subscription{
+		matchUUID: matchUUID,
+		messages:  make(chan Message, 1),
+		remove:    remove,
+		lastSeq:   afterSeq,
+	}
+}
+
+// Messages is closed when the subscription ends
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+func (s *Subscription) Close() {
+	s.remove(s)
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.messages)
+	}
+}
+
+// deliver drops messages already delivered, which publishers racing on the
+// same match or a redelivery after a reconnect may produce
+func (s *Subscription) deliver(msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || (msg.Seq <= s.lastSeq && !msg.Deleted) {
+		return
+	}
+
+	// there is nothing left to catch up on in a deleted match
+	msg.Seq = max(msg.Seq, s.lastSeq)
+	msg.Gap = !msg.Deleted && msg.Seq > s.lastSeq+1
+	s.push(msg)
+	s.lastSeq = msg.Seq
+}
+
+// lost tells the subscriber messages may have been missed, the connection
+// to the other instances was down
+func (s *Subscription) lost() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.push(Message{MatchUUID: s.matchUUID, Seq: s.lastSeq, Gap: true})
+}
+
+// push must be called with the lock held, it never blocks
+func (s *Subscription) push(msg Message) {
+	select {
+	case pending := <-s.messages:
+		// the subscriber never saw pending, it has to catch up past it
+		msg.Deleted = msg.Deleted || pending.Deleted
+		msg.Gap = !msg.Deleted
+		msg.Seq = max(msg.Seq, pending.Seq)
+	default:
+	}
+
+	s.messages <- msg
+}
+
+// hub fans messages out to the subscriptions of each match, both
+// implementations share it
+type hub struct {
+	mu     sync.Mutex
+	topics map[string]*topic
+	closed bool
+}
+
+type topic struct {
+	subscriptions map[*Subscription]struct{}
+	// ready is closed once messages of the match are received
+	ready chan struct{}
+}
+
+func newHub() *hub {
+	return &hub{topics: map[string]*topic{}}
+}
+
+// subscribe returns the subscription and the ready channel of its topic,
+// created already closed when ready is true
+func (h *hub) subscribe(
+	matchUUID string,
+	afterSeq int64,
+	ready bool,
+) (*Subscription, <-chan struct{}, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, nil, ErrClosed
+	}
+
+	t, ok := h.topics[matchUUID]
+	if !ok {
+		t = &topic{
+			subscriptions: map[*Subscription]struct{}{},
+			ready:         make(chan struct{}),
+		}
+		if ready {
+			close(t.ready)
+		}
+		h.topics[matchUUID] = t
+	}
+
+	s := newSubscription(matchUUID, afterSeq, h.unsubscribe)
+	t.subscriptions[s] = struct{}{}
+	return s, t.ready, nil
+}
+
+func (h *hub) unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.topics[s.matchUUID]
+	if !ok {
+		return
+	}
+
+	delete(t.subscriptions, s)
+	if len(t.subscriptions) == 0 {
+		delete(h.topics, s.matchUUID)
+	}
+}
+
+func (h *hub) dispatch(msg Message) {
+	for _, s := range h.subscriptionsOf(msg.MatchUUID) {
+		s.deliver(msg)
+	}
+}
+
+func (h *hub) subscriptionsOf(matchUUID string) []*Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.topics[matchUUID]
+	if !ok {
+		return nil
+	}
+
+	subscriptions := make([]*Subscription, 0, len(t.subscriptions))
+	for s := range t.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+
+	return subscriptions
+}
+
+// matches lists the matches with subscribers
+func (h *hub) matches() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	matches := make([]string, 0, len(h.topics))
+	for matchUUID := range h.topics {
+		matches = append(matches, matchUUID)
+	}
+
+	return matches
+}
+
+// markReady closes the ready channel of a match, messages of it are now
+// received
+func (h *hub) markReady(matchUUID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.topics[matchUUID]
+	if !ok {
+		return
+	}
+
+	select {
+	case <-t.ready:
+	default:
+		close(t.ready)
+	}
+}
+
+// lost sends a gap to every subscription
+func (h *hub) lost() {
+	for _, matchUUID := range h.matches() {
+		for _, s := range h.subscriptionsOf(matchUUID) {
+			s.lost()
+		}
+	}
+}
+
+func (h *hub) close() {
+	h.mu.Lock()
+	topics := h.topics
+	h.topics = map[string]*topic{}
+	h.closed = true
+	h.mu.Unlock()
+
+	for _, t := range topics {
+		for s := range t.subscriptions {
+			s.close()
+		}
+	}
+}
+
+// endWith closes s when ctx is done
+func endWith(ctx context.Context, s *Subscription) {
+	context.AfterFunc(ctx, s.Close)
+}
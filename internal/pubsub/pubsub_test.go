@@ -0,0 +1,204 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const (
+	MATCH_A = "00000000-0000-4000-8000-00000000000a"
+	MATCH_B = "00000000-0000-4000-8000-00000000000b"
+)
+
+func subscribe(
+	t *testing.T,
+	ps PubSub,
+	matchUUID string,
+	afterSeq int64,
+) *Subscription {
+	t.Helper()
+
+	s, err := ps.Subscribe(context.Background(), matchUUID, afterSeq)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %v", err)
+	}
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func publish(t *testing.T, ps PubSub, matchUUID string, seqs ...int64) {
+	t.Helper()
+
+	for _, seq := range seqs {
+		err := ps.Publish(context.Background(),
+			Message{MatchUUID: matchUUID, Seq: seq})
+		if err != nil {
+			t.Fatalf("unexpected error publishing %d: %v", seq, err)
+		}
+	}
+}
+
+func expectMessage(t *testing.T, s *Subscription, want Message) {
+	t.Helper()
+
+	select {
+	case got, ok := <-s.Messages():
+		if !ok {
+			t.Fatalf("subscription closed, want %+v", want)
+		}
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %+v", want)
+	}
+}
+
+func expectNothing(t *testing.T, s *Subscription) {
+	t.Helper()
+
+	select {
+	case got := <-s.Messages():
+		t.Errorf("unexpected message %+v", got)
+	default:
+	}
+}
+
+func TestMemoryFansOutPerMatch(t *testing.T) {
+	ps := NewMemoryPubSub()
+	defer ps.Close()
+
+	first := subscribe(t, ps, MATCH_A, 0)
+	second := subscribe(t, ps, MATCH_A, 0)
+	other := subscribe(t, ps, MATCH_B, 0)
+
+	publish(t, ps, MATCH_A, 1)
+
+	for _, s := range []*Subscription{first, second} {
+		expectMessage(t, s, Message{MatchUUID: MATCH_A, Seq: 1})
+	}
+	expectNothing(t, other)
+}
+
+func TestSubscriptionDetectsGaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		afterSeq int64
+		seqs     []int64
+		want     Message
+	}{
+		{"next seq", 4, []int64{5}, Message{Seq: 5}},
+		{"skipped seq", 4, []int64{6}, Message{Seq: 6, Gap: true}},
+		{"already seen", 4, []int64{3, 4, 5}, Message{Seq: 5}},
+		{"slow subscriber", 4, []int64{5, 6, 7}, Message{Seq: 7, Gap: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := NewMemoryPubSub()
+			defer ps.Close()
+
+			s := subscribe(t, ps, MATCH_A, tt.afterSeq)
+			publish(t, ps, MATCH_A, tt.seqs...)
+
+			tt.want.MatchUUID = MATCH_A
+			expectMessage(t, s, tt.want)
+			expectNothing(t, s)
+		})
+	}
+}
+
+func TestSubscriptionDropsDuplicates(t *testing.T) {
+	ps := NewMemoryPubSub()
+	defer ps.Close()
+
+	s := subscribe(t, ps, MATCH_A, 0)
+
+	publish(t, ps, MATCH_A, 1)
+	expectMessage(t, s, Message{MatchUUID: MATCH_A, Seq: 1})
+
+	publish(t, ps, MATCH_A, 1, 2)
+	expectMessage(t, s, Message{MatchUUID: MATCH_A, Seq: 2})
+	expectNothing(t, s)
+}
+
+func TestSubscriptionDeliversDeletion(t *testing.T) {
+	deleted := func(seq int64) Message {
+		return Message{MatchUUID: MATCH_A, Seq: seq, Deleted: true}
+	}
+
+	t.Run("at the last seq", func(t *testing.T) {
+		ps := NewMemoryPubSub()
+		defer ps.Close()
+
+		s := subscribe(t, ps, MATCH_A, 3)
+		if err := ps.Publish(context.Background(), deleted(3)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expectMessage(t, s, deleted(3))
+	})
+
+	t.Run("slow subscriber", func(t *testing.T) {
+		ps := NewMemoryPubSub()
+		defer ps.Close()
+
+		s := subscribe(t, ps, MATCH_A, 3)
+		publish(t, ps, MATCH_A, 4)
+		if err := ps.Publish(context.Background(), deleted(2)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expectMessage(t, s, deleted(4))
+		expectNothing(t, s)
+	})
+}
+
+func TestSubscriptionEnds(t *testing.T) {
+	t.Run("close", func(t *testing.T) {
+		ps := NewMemoryPubSub()
+		defer ps.Close()
+
+		s := subscribe(t, ps, MATCH_A, 0)
+		s.Close()
+		publish(t, ps, MATCH_A, 1)
+
+		if _, ok := <-s.Messages(); ok {
+			t.Error("expected the messages to be closed")
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ps := NewMemoryPubSub()
+		defer ps.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		s, err := ps.Subscribe(ctx, MATCH_A, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cancel()
+
+		select {
+		case _, ok := <-s.Messages():
+			if ok {
+				t.Error("expected the messages to be closed")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscription outlived its context")
+		}
+	})
+
+	t.Run("pubsub close", func(t *testing.T) {
+		ps := NewMemoryPubSub()
+		s := subscribe(t, ps, MATCH_A, 0)
+		ps.Close()
+
+		if _, ok := <-s.Messages(); ok {
+			t.Error("expected the messages to be closed")
+		}
+		if _, err := ps.Subscribe(context.Background(), MATCH_A, 0); err != ErrClosed {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	})
+}
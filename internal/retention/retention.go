@@ -0,0 +1,288 @@
+// Package retention keeps the matches table from growing without bound:
+// finished matches are moved to the archive once old enough, keeping a
+// summary and their compressed event log, and lobbies nobody started are
+// deleted
+package retention
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"duna/internal/config"
+	"duna/internal/database"
+	"duna/internal/game"
+	"duna/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const DAY = 24 * time.Hour
+
+type Policy struct {
+	// ArchiveAfter is the time since a match finished it is archived after
+	ArchiveAfter time.Duration
+	// AbandonAfter is the age a lobby still waiting for players is deleted
+	// at
+	AbandonAfter time.Duration
+}
+
+func NewPolicy(cfg config.RetentionConfig) Policy {
+	return Policy{
+		ArchiveAfter: time.Duration(cfg.ArchiveAfterDays) * DAY,
+		AbandonAfter: time.Duration(cfg.AbandonedLobbyDays) * DAY,
+	}
+}
+
+// Result counts what a run did
+type Result struct {
+	Archived       int
+	DeletedLobbies int
+}
+
+// Run archives the matches finished and deletes the lobbies created before
+// now minus the policy ages. Every match is handled in its own transaction, an error
+// stops the run and the result counts what was done until then. Running it
+// again picks up where it stopped
+func (p Policy) Run(
+	ctx context.Context,
+	db database.Database,
+	now time.Time,
+) (Result, error) {
+	// a lagging replica could list matches already handled
+	ctx = database.WithPrimaryReads(ctx)
+
+	var result Result
+	finish := models.MatchState(models.Finish)
+	finishedBefore := now.Add(-p.ArchiveAfter)
+	err := forEachMatch(ctx, db, database.MatchFilter{
+		State:          &finish,
+		FinishedBefore: finishedBefore,
+	}, func(match models.Match) error {
+		archived, err := archiveMatch(ctx, db, match.UUID, finishedBefore, now)
+		if archived {
+			result.Archived++
+		}
+		return err
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to archive matches: %w", err)
+	}
+
+	waiting := models.MatchState(models.WaitingPlayers)
+	err = forEachMatch(ctx, db, database.MatchFilter{
+		State:         &waiting,
+		CreatedBefore: now.Add(-p.AbandonAfter),
+	}, func(match models.Match) error {
+		deleted, err := deleteAbandonedLobby(ctx, db, match.UUID)
+		if deleted {
+			result.DeletedLobbies++
+		}
+		return err
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to delete abandoned lobbies: %w",
+			err)
+	}
+
+	return result, nil
+}
+
+// Schedule runs the policy right away and then every interval until ctx is
+// done, report is called after every run
+func (p Policy) Schedule(
+	ctx context.Context,
+	db database.Database,
+	interval time.Duration,
+	report func(result Result, err error),
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := p.Run(ctx, db, time.Now())
+		if ctx.Err() != nil {
+			return
+		}
+		report(result, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// forEachMatch pages through the matches of filter, fn may delete them
+func forEachMatch(
+	ctx context.Context,
+	db database.Database,
+	filter database.MatchFilter,
+	fn func(match models.Match) error,
+) error {
+	page := database.PageRequest{Limit: database.MAX_PAGE_LIMIT}
+	for {
+		matches, err := db.ListMatches(ctx, filter, page)
+		if err != nil {
+			return err
+		}
+
+		for _, match := range matches.Items {
+			if err := fn(match); err != nil {
+				return fmt.Errorf("match %s: %w", match.UUID, err)
+			}
+		}
+
+		if matches.NextCursor == "" {
+			return nil
+		}
+		page.Cursor = matches.NextCursor
+	}
+}
+
+// archiveMatch replaces the match by its archive if it is still finished
+// before finishedBefore, it may have changed since it was listed. Its seats,
+// events and snapshots go away with it
+func archiveMatch(
+	ctx context.Context,
+	db database.Database,
+	uuid string,
+	finishedBefore time.Time,
+	now time.Time,
+) (bool, error) {
+	archived := false
+	err := db.WithTx(ctx, func(repos database.Repos) error {
+		archived = false
+
+		match, err := repos.GetMatch(ctx, uuid)
+		if errors.Is(err, database.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if match.MatchState != models.Finish || match.FinishedAt.IsZero() ||
+			!match.FinishedAt.Before(finishedBefore) {
+			return nil
+		}
+
+		events, err := repos.LoadEvents(ctx, match.UUID, 0)
+		if err != nil {
+			return err
+		}
+
+		compressed, err := compressEvents(events)
+		if err != nil {
+			return err
+		}
+
+		// a log the rules reject still gets archived, with what could be
+		// folded of it
+		state, _ := game.Fold(game.NewState(), events)
+
+		players := make([]models.ArchivedPlayer, 0, len(match.Seats))
+		for _, seat := range match.Seats {
+			players = append(players, models.ArchivedPlayer{
+				UserUUID: seat.UserUUID,
+				Faction:  state.Factions[seat.UserUUID],
+			})
+		}
+
+		if err := repos.InsertMatchArchive(ctx, models.MatchArchive{
+			MatchUUID:     match.UUID,
+			CreatedByUser: match.CreatedByUser,
+			CreatedAt:     match.CreatedAt,
+			ArchivedAt:    now,
+			Players:       players,
+			Winner:        state.Winner,
+			EventCount:    len(events),
+			Events:        compressed,
+		}); err != nil {
+			return err
+		}
+
+		if err := repos.DeleteMatch(ctx, match.UUID); err != nil {
+			return err
+		}
+		archived = true
+		return nil
+	})
+
+	return archived && err == nil, err
+}
+
+// deleteAbandonedLobby deletes the match if it is still waiting for
+// players, it may have started since it was listed
+func deleteAbandonedLobby(
+	ctx context.Context,
+	db database.Database,
+	uuid string,
+) (bool, error) {
+	deleted := false
+	err := db.WithTx(ctx, func(repos database.Repos) error {
+		deleted = false
+
+		match, err := repos.GetMatch(ctx, uuid)
+		if errors.Is(err, database.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if match.MatchState != models.WaitingPlayers {
+			return nil
+		}
+
+		if err := repos.DeleteMatch(ctx, uuid); err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+
+	return deleted && err == nil, err
+}
+
+func compressEvents(events []models.MatchEvent) ([]byte, error) {
+	if events == nil {
+		events = []models.MatchEvent{}
+	}
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if err := json.NewEncoder(writer).Encode(events); err != nil {
+		return nil, fmt.Errorf("failed to encode events: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress events: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// ArchivedEvents decompresses the event log of an archived match
+func ArchivedEvents(archive models.MatchArchive) ([]models.MatchEvent, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(archive.Events))
+	if err != nil {
+		return nil, fmt.Errorf("malformed archive of match %s: %w",
+			archive.MatchUUID, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("malformed archive of match %s: %w",
+			archive.MatchUUID, err)
+	}
+
+	var events []models.MatchEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("malformed archive of match %s: %w",
+			archive.MatchUUID, err)
+	}
+
+	return events, nil
+}
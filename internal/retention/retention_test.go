@@ -0,0 +1,147 @@
+package retention
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/database/databasetest"
+	"duna/internal/database/memory"
+	"duna/internal/game"
+	"duna/internal/models"
+	"duna/internal/uuid"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	policy := Policy{ArchiveAfter: 90 * DAY, AbandonAfter: 7 * DAY}
+	uuids := &uuid.FakeStrategy{}
+	db := memory.NewMemoryDatabase()
+
+	// finished matches are finished at half their age
+	insert := func(state models.MatchState, age time.Duration) models.Match {
+		t.Helper()
+
+		match := game.CreateMatch(uuids, "creator")
+		match.MatchState = state
+		match.CreatedAt = now.Add(-age)
+		if state == models.Finish {
+			match.FinishedAt = now.Add(-age / 2)
+		}
+		if err := db.InsertMatch(ctx, match); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return match
+	}
+
+	finished := insert(models.Finish, 200*DAY)
+	// created before the archive age but finished after it
+	recentlyFinished := insert(models.Finish, 100*DAY)
+	abandoned := insert(models.WaitingPlayers, 8*DAY)
+	lobby := insert(models.WaitingPlayers, 2*DAY)
+	playing := insert(models.InGame, 100*DAY)
+
+	user := databasetest.NewTestUser(t)
+	if err := db.InsertUser(ctx, user); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := db.AddPlayer(ctx, finished.UUID, user.UUID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := []models.MatchEvent{
+		{MatchUUID: finished.UUID, Seq: 1, Type: game.JOIN_ACTION,
+			ActorUUID: user.UUID, Faction: "fremen"},
+		{MatchUUID: finished.UUID, Seq: 2, Type: game.START_ACTION},
+		{MatchUUID: finished.UUID, Seq: 3, Type: game.FINISH_ACTION,
+			Payload: []byte(`{"winner":"fremen"}`)},
+	}
+	if err := db.AppendEvents(ctx, events...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := policy.Run(ctx, db, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != (Result{Archived: 1, DeletedLobbies: 1}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	for _, match := range []models.Match{finished, abandoned} {
+		if _, err := db.GetMatch(ctx, match.UUID); !errors.Is(
+			err, database.ErrNotFound) {
+			t.Errorf("expected match %s to be gone, got %v", match.UUID, err)
+		}
+	}
+	for _, match := range []models.Match{recentlyFinished, lobby, playing} {
+		if _, err := db.GetMatch(ctx, match.UUID); err != nil {
+			t.Errorf("expected match %s to be kept, got %v", match.UUID, err)
+		}
+	}
+
+	archive, err := db.GetMatchArchive(ctx, finished.UUID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if archive.Winner != "fremen" || archive.EventCount != 3 ||
+		len(archive.Players) != 1 || archive.Players[0].Faction != "fremen" {
+		t.Errorf("unexpected archive summary %+v", archive)
+	}
+
+	archived, err := ArchivedEvents(archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(archived) != len(events) ||
+		archived[2].Type != game.FINISH_ACTION {
+		t.Errorf("unexpected archived events %+v", archived)
+	}
+
+	// nothing left to do
+	result, err = policy.Run(ctx, db, now)
+	if err != nil || result != (Result{}) {
+		t.Errorf("Run() = %+v, %v, want nothing done", result, err)
+	}
+}
+
+func TestArchiveMatchSkipsChangedMatches(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	finishedBefore := now.Add(-90 * DAY)
+	uuids := &uuid.FakeStrategy{}
+	db := memory.NewMemoryDatabase()
+
+	// what the listing saw no longer holds by the time it is archived
+	reopened := game.CreateMatch(uuids, "creator")
+	reopened.MatchState = models.InGame
+	refinished := game.CreateMatch(uuids, "creator")
+	refinished.MatchState = models.Finish
+	refinished.FinishedAt = now
+	for _, match := range []models.Match{reopened, refinished} {
+		if err := db.InsertMatch(ctx, match); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for _, uuid := range []string{reopened.UUID, refinished.UUID, "gone"} {
+		archived, err := archiveMatch(ctx, db, uuid, finishedBefore, now)
+		if err != nil || archived {
+			t.Errorf("archiveMatch(%s) = %v, %v, want it skipped", uuid,
+				archived, err)
+		}
+	}
+
+	for _, match := range []models.Match{reopened, refinished} {
+		if _, err := db.GetMatch(ctx, match.UUID); err != nil {
+			t.Errorf("expected match %s to be kept, got %v", match.UUID, err)
+		}
+		if _, err := db.GetMatchArchive(ctx, match.UUID); !errors.Is(
+			err, database.ErrNotFound) {
+			t.Errorf("expected match %s not to be archived, got %v",
+				match.UUID, err)
+		}
+	}
+}
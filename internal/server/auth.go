@@ -0,0 +1,331 @@
+package server
+
+import (
+	"duna/internal/auth"
+	"duna/internal/database"
+	"duna/internal/models"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	// CSRF_HEADER must echo the csrf token on every authenticated request,
+	// a cross site form can't set it
+	CSRF_HEADER = "X-CSRF-Token"
+	// CSRF_COOKIE_SUFFIX names the cookie holding the csrf token after the
+	// session cookie, unlike the session it is readable by scripts so the
+	// client finds the token again after a reload
+	CSRF_COOKIE_SUFFIX = "_csrf"
+)
+
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// UserResponse carries the csrf token when a session was just created
+type UserResponse struct {
+	User      models.User `json:"user"`
+	CSRFToken string      `json:"csrf_token,omitempty"`
+}
+
+type SessionResponse struct {
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Current is the session of the request
+	Current bool `json:"current"`
+}
+
+type SessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// userHandler serves a request of a logged in user
+type userHandler func(w http.ResponseWriter, r *http.Request, user models.User)
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var request RegisterRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	username, err := s.usernames.NewUsername(request.Username)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	email, err := s.emails.NewEmail(request.Email)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	password, err := models.NewPassword(request.Password, false, s.hash)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := models.CreateUser(s.uuids, username, email, password)
+	err = s.db.InsertUser(r.Context(), user)
+	var conflict *database.ConflictError
+	if errors.As(err, &conflict) {
+		switch conflict.Constraint {
+		case "users_username_canonical_key":
+			writeError(w, http.StatusConflict, "username is taken")
+			return
+		case "users_email_canonical_key":
+			writeError(w, http.StatusConflict, "email is already registered")
+			return
+		}
+	}
+	if err != nil {
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, UserResponse{User: user})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var request LoginRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	s.login(w, r, request.Username, request.Password)
+}
+
+// login starts a session and answers with the user and the csrf token
+func (s *Server) login(
+	w http.ResponseWriter,
+	r *http.Request,
+	username, password string,
+) {
+	ctx := r.Context()
+	sessionToken, csrfToken, err := s.auth.Authenticate(
+		ctx, username, password)
+	switch {
+	case errors.Is(err, database.ErrNotFound),
+		errors.Is(err, auth.ErrWrongPassword):
+		// the same answer for both, it does not tell who has an account
+		writeError(w, http.StatusUnauthorized, "wrong username or password")
+		return
+	case errors.Is(err, auth.ErrUserDisabled):
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	user, err := s.db.GetUserByUsername(ctx, username, s.hash)
+	if err != nil {
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	s.setSessionCookies(w, sessionToken, csrfToken)
+	writeJSON(w, http.StatusOK, UserResponse{User: user, CSRFToken: csrfToken})
+}
+
+func (s *Server) handleLogout(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	cookie, _ := r.Cookie(s.session.CookieName)
+	if err := s.auth.Logout(r.Context(), cookie.Value); err != nil &&
+		!errors.Is(err, database.ErrNotFound) {
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	s.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleMe(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	writeJSON(w, http.StatusOK, UserResponse{User: user})
+}
+
+// handleChangePassword logs the user out everywhere else, the session of
+// the request is replaced by a new one
+func (s *Server) handleChangePassword(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	var request ChangePasswordRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	if !user.Password().Compare(request.CurrentPassword) {
+		writeError(w, http.StatusForbidden, "wrong current password")
+		return
+	}
+
+	password, err := models.NewPassword(request.NewPassword, false, s.hash)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	if err := s.db.UpdateUserPassword(ctx, user.UUID, password); err != nil {
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	if _, err := s.auth.RevokeSessions(ctx, user.UUID); err != nil {
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	// a lagging replica would still hold the old hash and turn the user,
+	// just logged out everywhere, away
+	r = r.WithContext(database.WithPrimaryReads(ctx))
+	s.login(w, r, user.Username.String(), request.NewPassword)
+}
+
+func (s *Server) handleSessions(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	sessions, err := s.db.ListUserSessions(r.Context(), user.UUID, s.now())
+	if err != nil {
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	cookie, _ := r.Cookie(s.session.CookieName)
+	current := auth.HashToken(cookie.Value)
+
+	response := SessionsResponse{Sessions: []SessionResponse{}}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, SessionResponse{
+			CreatedAt: session.CreatedAt,
+			ExpiresAt: session.ExpiresAt,
+			Current:   session.TokenHash == current,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// requireUser resolves the user of the session cookie, the csrf token must
+// be sent in the CSRF_HEADER
+func (s *Server) requireUser(next userHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(s.session.CookieName)
+		if err != nil || cookie.Value == "" {
+			writeError(w, http.StatusUnauthorized, "not logged in")
+			return
+		}
+
+		csrfToken := r.Header.Get(CSRF_HEADER)
+		if csrfToken == "" {
+			writeError(w, http.StatusForbidden,
+				"missing "+CSRF_HEADER+" header")
+			return
+		}
+
+		ctx := r.Context()
+		userUUID, err := s.auth.GetUserUUID(ctx, cookie.Value, csrfToken)
+		switch {
+		case errors.Is(err, auth.ErrWrongCsrftToken):
+			writeError(w, http.StatusForbidden, "wrong csrf token")
+			return
+		case errors.Is(err, database.ErrNotFound),
+			errors.Is(err, auth.ErrSessionExpired):
+			s.clearSessionCookies(w)
+			writeError(w, http.StatusUnauthorized,
+				"session expired, log in again")
+			return
+		case err != nil:
+			writeDatabaseError(w, r, err)
+			return
+		}
+
+		// from the primary, a disabling or a role change must apply to the
+		// very next request
+		user, err := s.db.GetUserByUUID(database.WithPrimaryReads(ctx),
+			userUUID, s.hash)
+		if errors.Is(err, database.ErrNotFound) {
+			s.clearSessionCookies(w)
+			writeError(w, http.StatusUnauthorized, "user no longer exists")
+			return
+		}
+		if err != nil {
+			writeDatabaseError(w, r, err)
+			return
+		}
+
+		// disabling revokes the sessions, unless another store kept them
+		if user.Disabled {
+			writeError(w, http.StatusForbidden, auth.ErrUserDisabled.Error())
+			return
+		}
+
+		next(w, r, user)
+	}
+}
+
+func (s *Server) setSessionCookies(
+	w http.ResponseWriter,
+	sessionToken, csrfToken string,
+) {
+	maxAge := int(s.session.MaxAge.Seconds())
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.session.CookieName,
+		Value:    sessionToken,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.session.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.session.CookieName + CSRF_COOKIE_SUFFIX,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   s.session.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Server) clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{
+		s.session.CookieName,
+		s.session.CookieName + CSRF_COOKIE_SUFFIX,
+	} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   s.session.Secure,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
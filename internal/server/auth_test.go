@@ -0,0 +1,531 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"duna/internal/auth"
+	"duna/internal/config"
+	"duna/internal/database"
+	"duna/internal/hash"
+	"duna/internal/models"
+	"duna/internal/uuid"
+	"duna/internal/version"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testHash = models.HashStrategyMock{
+	FuncEncode: func(str string) (string, error) {
+		return "hashed:" + str, nil
+	},
+	FuncCompare: func(enconded, str string) bool {
+		return enconded == "hashed:"+str
+	},
+}
+
+// fakeAccounts backs the mock database and session store with maps
+type fakeAccounts struct {
+	mu       sync.Mutex
+	users    map[string]models.User
+	sessions map[string]auth.SessionUserUUIDAndCsrftTokenPair
+	// replica serves the reads without database.WithPrimaryReads, it stops
+	// following users while lagging is set
+	replica map[string]models.User
+	lagging bool
+}
+
+// setUser must be called with the lock held
+func (f *fakeAccounts) setUser(user models.User) {
+	f.users[user.UUID] = user
+	if !f.lagging {
+		f.replica[user.UUID] = user
+	}
+}
+
+func (f *fakeAccounts) userBy(
+	ctx context.Context,
+	match func(models.User) bool,
+) (models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	users := f.replica
+	if database.PrimaryReads(ctx) {
+		users = f.users
+	}
+
+	for _, user := range users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return models.User{}, fmt.Errorf("user %w", database.ErrNotFound)
+}
+
+func (f *fakeAccounts) database() *database.MockDatabase {
+	return &database.MockDatabase{
+		FuncInsertUser: func(ctx context.Context, user models.User) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			for _, existing := range f.users {
+				if existing.Username.Canonical() == user.Username.Canonical() {
+					return &database.ConflictError{
+						Constraint: "users_username_canonical_key"}
+				}
+			}
+			f.setUser(user)
+			return nil
+		},
+		FuncGetUserByUsername: func(ctx context.Context, username string,
+			hash hash.HashStrategy) (models.User, error) {
+			return f.userBy(ctx, func(user models.User) bool {
+				return user.Username.Canonical() ==
+					models.CanonicalUsername(username)
+			})
+		},
+		FuncGetUserByUUID: func(ctx context.Context, uuid string,
+			hash hash.HashStrategy) (models.User, error) {
+			return f.userBy(ctx, func(user models.User) bool {
+				return user.UUID == uuid
+			})
+		},
+		FuncUpdateUserPassword: func(ctx context.Context, uuid string,
+			password models.Password) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			user := f.users[uuid]
+			f.setUser(models.NewUser(
+				user.UUID, user.Username, user.Email, password))
+			return nil
+		},
+		FuncListUserSessions: func(ctx context.Context, userUUID string,
+			now time.Time) ([]models.Session, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			var sessions []models.Session
+			for token, pair := range f.sessions {
+				if pair.UserUUID == userUUID {
+					sessions = append(sessions, models.Session{
+						TokenHash: auth.HashToken(token),
+						UserUUID:  userUUID,
+						ExpiresAt: now.Add(time.Hour),
+					})
+				}
+			}
+			return sessions, nil
+		},
+	}
+}
+
+func (f *fakeAccounts) store() *auth.MockSessionStore {
+	return &auth.MockSessionStore{
+		FuncSet: func(key string,
+			value auth.SessionUserUUIDAndCsrftTokenPair) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			f.sessions[key] = value
+			return nil
+		},
+		FuncGet: func(key string) (auth.SessionUserUUIDAndCsrftTokenPair,
+			error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			pair, ok := f.sessions[key]
+			if !ok {
+				return pair, fmt.Errorf("session %w", database.ErrNotFound)
+			}
+			return pair, nil
+		},
+		FuncRemove: func(key string) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			delete(f.sessions, key)
+			return nil
+		},
+		FuncRemoveUser: func(userUUID string) (int, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			removed := 0
+			for key, pair := range f.sessions {
+				if pair.UserUUID == userUUID {
+					delete(f.sessions, key)
+					removed++
+				}
+			}
+			return removed, nil
+		},
+	}
+}
+
+// newAuthServer serves the auth endpoints over the fake accounts
+func newAuthServer(
+	t *testing.T,
+	now func() time.Time,
+) (*httptest.Server, *fakeAccounts) {
+	t.Helper()
+
+	accounts := &fakeAccounts{
+		users:    make(map[string]models.User),
+		sessions: make(map[string]auth.SessionUserUUIDAndCsrftTokenPair),
+		replica:  make(map[string]models.User),
+	}
+	db := accounts.database()
+	usernames := models.DefaultUsernamePolicy
+	usernames.Profanity = models.NewWordListProfanityFilter([]string{"worm"})
+
+	server := httptest.NewServer(New(db, version.Info{}, Options{
+		Auth: auth.New(db, accounts.store(), testHash),
+		Hash: testHash,
+		Session: config.SessionConfig{
+			CookieName: "duna_session",
+			MaxAge:     time.Hour,
+		},
+		Usernames: &usernames,
+		Emails: &models.EmailPolicy{
+			DeniedDomains: []string{"tempmail.org"},
+		},
+		UUIDs: uuid.V7Strategy{},
+		Now:   now,
+	}))
+	t.Cleanup(server.Close)
+
+	return server, accounts
+}
+
+// client keeps the cookies and the csrf token of a browser
+type client struct {
+	t         *testing.T
+	http      *http.Client
+	url       string
+	csrfToken string
+}
+
+func newClient(t *testing.T, server *httptest.Server) *client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return &client{
+		t:    t,
+		http: &http.Client{Jar: jar},
+		url:  server.URL,
+	}
+}
+
+// do sends body as JSON and decodes the response into out when given
+func (c *client) do(method, path string, body any, out any) int {
+	c.t.Helper()
+
+	var reader *bytes.Reader
+	switch body := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(body))
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatalf("unexpected error: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		c.t.Fatalf("unexpected error: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if c.csrfToken != "" {
+		request.Header.Set(CSRF_HEADER, c.csrfToken)
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		c.t.Fatalf("unexpected error: %v", err)
+	}
+	defer response.Body.Close()
+
+	if got := response.Header.Get("Content-Type"); response.StatusCode !=
+		http.StatusNoContent && got != "application/json" {
+		c.t.Errorf("%s %s: Content-Type = %q", method, path, got)
+	}
+	if out != nil {
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+			c.t.Fatalf("%s %s: unexpected error decoding: %v", method, path,
+				err)
+		}
+	}
+
+	return response.StatusCode
+}
+
+// login keeps the csrf token of the session it starts
+func (c *client) login(username, password string) int {
+	c.t.Helper()
+
+	var response UserResponse
+	status := c.do(http.MethodPost, "/auth/login",
+		LoginRequest{Username: username, Password: password}, &response)
+	if status == http.StatusOK {
+		c.csrfToken = response.CSRFToken
+	}
+	return status
+}
+
+func expectStatus(t *testing.T, name string, got, want int) {
+	t.Helper()
+
+	if got != want {
+		t.Errorf("%s: status = %d, want %d", name, got, want)
+	}
+}
+
+func TestAuthEndpoints(t *testing.T) {
+	server, accounts := newAuthServer(t, nil)
+	paul := newClient(t, server)
+	// setLagging(false) lets the replica catch up
+	setLagging := func(lagging bool) {
+		accounts.mu.Lock()
+		defer accounts.mu.Unlock()
+		accounts.lagging = lagging
+		if !lagging {
+			accounts.replica = maps.Clone(accounts.users)
+		}
+	}
+
+	var registered UserResponse
+	expectStatus(t, "register", paul.do(http.MethodPost, "/auth/register",
+		RegisterRequest{
+			Username: "Paul",
+			Email:    "paul@arrakis.com",
+			Password: "Sp1ce-must-flow",
+		}, &registered), http.StatusCreated)
+	if registered.User.Username != "Paul" || registered.CSRFToken != "" {
+		t.Errorf("unexpected registration %+v", registered)
+	}
+
+	t.Run("register errors", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			body    any
+			status  int
+			message string
+		}{
+			{"taken username", RegisterRequest{Username: "PAUL",
+				Email: "other@arrakis.com", Password: "Sp1ce-must-flow"},
+				http.StatusConflict, "username is taken"},
+			{"reserved username", RegisterRequest{Username: "Fremen",
+				Email: "stilgar@arrakis.com", Password: "Sp1ce-must-flow"},
+				http.StatusBadRequest, "username is reserved"},
+			{"profane username", RegisterRequest{Username: "Sandworm",
+				Email: "liet@arrakis.com", Password: "Sp1ce-must-flow"},
+				http.StatusBadRequest, "username is not allowed"},
+			{"denied email domain", RegisterRequest{Username: "Alia",
+				Email: "alia@mail.tempmail.org", Password: "Sp1ce-must-flow"},
+				http.StatusBadRequest, "email domain is not allowed"},
+			{"weak password", RegisterRequest{Username: "Alia",
+				Email: "alia@arrakis.com", Password: "spice"},
+				http.StatusBadRequest, "at least 8 characters"},
+			{"unknown field", `{"username": "Alia", "role": "admin"}`,
+				http.StatusBadRequest, `unknown field "role"`},
+			{"malformed", `{"username":`, http.StatusBadRequest,
+				"invalid request body"},
+			{"empty", "", http.StatusBadRequest, "empty body"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var response ErrorResponse
+				status := newClient(t, server).do(http.MethodPost,
+					"/auth/register", tt.body, &response)
+				expectStatus(t, tt.name, status, tt.status)
+				if !strings.Contains(response.Error, tt.message) {
+					t.Errorf("expected %q in %q", tt.message, response.Error)
+				}
+			})
+		}
+	})
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		anonymous := newClient(t, server)
+		expectStatus(t, "wrong password",
+			anonymous.login("paul", "Sp1ce-must-flaw"), http.StatusUnauthorized)
+		expectStatus(t, "unknown user",
+			anonymous.login("feyd", "Sp1ce-must-flow"), http.StatusUnauthorized)
+	})
+
+	expectStatus(t, "login", paul.login("paul", "Sp1ce-must-flow"),
+		http.StatusOK)
+	if paul.csrfToken == "" {
+		t.Fatal("expected a csrf token")
+	}
+
+	t.Run("csrf", func(t *testing.T) {
+		token := paul.csrfToken
+		defer func() { paul.csrfToken = token }()
+
+		paul.csrfToken = ""
+		expectStatus(t, "missing token",
+			paul.do(http.MethodGet, "/me", nil, nil), http.StatusForbidden)
+
+		paul.csrfToken = "forged"
+		expectStatus(t, "wrong token",
+			paul.do(http.MethodGet, "/me", nil, nil), http.StatusForbidden)
+	})
+
+	t.Run("not logged in", func(t *testing.T) {
+		var response ErrorResponse
+		status := newClient(t, server).do(http.MethodGet, "/me", nil,
+			&response)
+		expectStatus(t, "me", status, http.StatusUnauthorized)
+		if response.Error != "not logged in" {
+			t.Errorf("unexpected error %q", response.Error)
+		}
+	})
+
+	var me UserResponse
+	expectStatus(t, "me", paul.do(http.MethodGet, "/me", nil, &me),
+		http.StatusOK)
+	if me.User.UUID != registered.User.UUID {
+		t.Errorf("me = %+v, want %+v", me.User, registered.User)
+	}
+
+	other := newClient(t, server)
+	expectStatus(t, "second login", other.login("Paul", "Sp1ce-must-flow"),
+		http.StatusOK)
+
+	var sessions SessionsResponse
+	expectStatus(t, "sessions", paul.do(http.MethodGet, "/me/sessions", nil,
+		&sessions), http.StatusOK)
+	current := 0
+	for _, session := range sessions.Sessions {
+		if session.Current {
+			current++
+		}
+	}
+	if len(sessions.Sessions) != 2 || current != 1 {
+		t.Errorf("unexpected sessions %+v", sessions)
+	}
+
+	t.Run("change password", func(t *testing.T) {
+		expectStatus(t, "wrong current password", paul.do(http.MethodPut,
+			"/me/password", ChangePasswordRequest{
+				CurrentPassword: "Sp1ce-must-flaw",
+				NewPassword:     "Sh4i-hulud!",
+			}, nil), http.StatusForbidden)
+
+		// the new hash only reaches the replica once the test is done
+		setLagging(true)
+
+		oldToken := paul.csrfToken
+		var changed UserResponse
+		expectStatus(t, "change password", paul.do(http.MethodPut,
+			"/me/password", ChangePasswordRequest{
+				CurrentPassword: "Sp1ce-must-flow",
+				NewPassword:     "Sh4i-hulud!",
+			}, &changed), http.StatusOK)
+		if changed.CSRFToken == "" || changed.CSRFToken == oldToken {
+			t.Fatalf("expected a new csrf token, got %+v", changed)
+		}
+		paul.csrfToken = changed.CSRFToken
+
+		expectStatus(t, "same client", paul.do(http.MethodGet, "/me", nil,
+			nil), http.StatusOK)
+		expectStatus(t, "other sessions are revoked", other.do(
+			http.MethodGet, "/me", nil, nil), http.StatusUnauthorized)
+
+		setLagging(false)
+		expectStatus(t, "old password", newClient(t, server).login("Paul",
+			"Sp1ce-must-flow"), http.StatusUnauthorized)
+	})
+
+	expectStatus(t, "logout", paul.do(http.MethodPost, "/auth/logout", nil,
+		nil), http.StatusNoContent)
+	expectStatus(t, "after logout", paul.do(http.MethodGet, "/me", nil, nil),
+		http.StatusUnauthorized)
+
+	t.Run("disabled user", func(t *testing.T) {
+		expectStatus(t, "login before disabling",
+			paul.login("Paul", "Sh4i-hulud!"), http.StatusOK)
+
+		setLagging(true)
+		accounts.mu.Lock()
+		user := accounts.users[registered.User.UUID]
+		user.Disabled = true
+		accounts.setUser(user)
+		accounts.mu.Unlock()
+
+		expectStatus(t, "session of a disabled user", paul.do(
+			http.MethodGet, "/me", nil, nil), http.StatusForbidden)
+
+		setLagging(false)
+
+		var response ErrorResponse
+		expectStatus(t, "login", newClient(t, server).do(http.MethodPost,
+			"/auth/login", LoginRequest{
+				Username: "Paul",
+				Password: "Sh4i-hulud!",
+			}, &response), http.StatusForbidden)
+		if response.Error != auth.ErrUserDisabled.Error() {
+			t.Errorf("unexpected error %q", response.Error)
+		}
+	})
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2025, 7, 21, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	server, _ := newAuthServer(t, clock)
+	attacker := newClient(t, server)
+
+	for i := 0; i < AUTH_RATE_BURST; i++ {
+		expectStatus(t, "within the burst", attacker.login("paul", "guess"),
+			http.StatusUnauthorized)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/auth/login",
+		strings.NewReader(`{"username": "paul", "password": "guess"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response.Body.Close()
+	expectStatus(t, "over the limit", response.StatusCode,
+		http.StatusTooManyRequests)
+	if got := response.Header.Get("Retry-After"); got != "6" {
+		t.Errorf("Retry-After = %q, want 6", got)
+	}
+
+	mu.Lock()
+	now = now.Add(AUTH_RATE_EVERY / AUTH_RATE_LIMIT)
+	mu.Unlock()
+	expectStatus(t, "refilled", attacker.login("paul", "guess"),
+		http.StatusUnauthorized)
+	expectStatus(t, "empty again", attacker.login("paul", "guess"),
+		http.StatusTooManyRequests)
+}
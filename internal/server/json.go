@@ -0,0 +1,71 @@
+package server
+
+import (
+	"duna/internal/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// MAX_BODY_BYTES bounds the request bodies, none of them needs more
+const MAX_BODY_BYTES = 1 << 20
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{Error: message})
+}
+
+// readJSON decodes the body into dst, rejecting unknown fields so typos
+// don't go unnoticed. It answers 400 itself and returns false on failure
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_BODY_BYTES))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after the JSON object")
+	}
+	if errors.Is(err, io.EOF) {
+		err = errors.New("empty body")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+
+	return true
+}
+
+// writeDatabaseError maps the database errors to status codes, unexpected
+// ones are logged and hidden from the client
+func writeDatabaseError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrConflict):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, database.ErrInvalid):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrUnavailable):
+		writeError(w, http.StatusServiceUnavailable,
+			"database unavailable, retry later")
+	default:
+		slog.Error("request failed", "method", r.Method,
+			"path", r.URL.Path, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
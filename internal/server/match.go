@@ -0,0 +1,423 @@
+package server
+
+import (
+	"duna/internal/database"
+	"duna/internal/game"
+	"duna/internal/models"
+	"duna/internal/pubsub"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	googleuuid "github.com/google/uuid"
+)
+
+// names of the match states in requests and responses
+const (
+	WAITING_PLAYERS_STATE = "waiting_players"
+	IN_GAME_STATE         = "in_game"
+	FINISH_STATE          = "finish"
+)
+
+var matchStateNames = map[models.MatchState]string{
+	models.WaitingPlayers: WAITING_PLAYERS_STATE,
+	models.InGame:         IN_GAME_STATE,
+	models.Finish:         FINISH_STATE,
+}
+
+// CreateMatchRequest seats the creator as Faction right away
+type CreateMatchRequest struct {
+	Faction string `json:"faction"`
+}
+
+type JoinMatchRequest struct {
+	Faction string `json:"faction"`
+}
+
+type SeatResponse struct {
+	UserUUID string `json:"user_uuid"`
+	// Faction is left out of listings, only the endpoints of a single match
+	// read the event log
+	Faction  string    `json:"faction,omitempty"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type MatchResponse struct {
+	UUID          string         `json:"uuid"`
+	State         string         `json:"state"`
+	CreatedByUser string         `json:"created_by_user"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Version       int64          `json:"version"`
+	Seats         []SeatResponse `json:"seats"`
+	// OpenSeats is zero once the match started
+	OpenSeats int `json:"open_seats"`
+}
+
+type MatchesResponse struct {
+	Matches    []MatchResponse `json:"matches"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// handleListMatches pages through the matches newest first. The query
+// takes state, open=true for lobbies with a free seat, mine=true for the
+// matches of the user, limit and the cursor of the previous page
+func (s *Server) handleListMatches(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	query := r.URL.Query()
+	var filter database.MatchFilter
+	var page database.PageRequest
+
+	if name := query.Get("state"); name != "" {
+		state, ok := parseMatchState(name)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "unknown state "+
+				strconv.Quote(name)+", expected "+WAITING_PLAYERS_STATE+
+				", "+IN_GAME_STATE+" or "+FINISH_STATE)
+			return
+		}
+		filter.State = &state
+	}
+
+	open, ok := queryBool(w, r, "open")
+	if !ok {
+		return
+	}
+	if open {
+		waiting := models.MatchState(models.WaitingPlayers)
+		filter.State = &waiting
+		filter.OpenSeats = true
+	}
+
+	mine, ok := queryBool(w, r, "mine")
+	if !ok {
+		return
+	}
+	if mine {
+		filter.Player = user.UUID
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest,
+				"limit must be a positive number")
+			return
+		}
+		page.Limit = limit
+	}
+	page.Cursor = query.Get("cursor")
+
+	matches, err := s.db.ListMatches(r.Context(), filter, page)
+	if err != nil {
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	response := MatchesResponse{
+		Matches:    []MatchResponse{},
+		NextCursor: matches.NextCursor,
+	}
+	for _, match := range matches.Items {
+		response.Matches = append(response.Matches,
+			s.matchResponse(match, nil))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleCreateMatch(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	var request CreateMatchRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	ctx := r.Context()
+	var match models.Match
+	var state game.State
+	err := s.db.WithTx(ctx, func(repos database.Repos) error {
+		var err error
+		match, state, err = s.lobby.Open(ctx, repos, s.uuids, user.UUID,
+			request.Faction)
+		return err
+	})
+	if err != nil {
+		writeGameError(w, r, err)
+		return
+	}
+	s.publish(r, match.UUID, state)
+
+	writeJSON(w, http.StatusCreated, s.matchResponse(match, &state))
+}
+
+func (s *Server) handleGetMatch(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	matchUUID, ok := pathMatchUUID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	match, err := s.db.GetMatch(ctx, matchUUID)
+	if err != nil {
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	state, err := game.LoadState(ctx, s.db, matchUUID)
+	if err != nil {
+		writeDatabaseError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.matchResponse(match, &state))
+}
+
+func (s *Server) handleJoinMatch(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	matchUUID, ok := pathMatchUUID(w, r)
+	if !ok {
+		return
+	}
+
+	var request JoinMatchRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	ctx := r.Context()
+	var match models.Match
+	var state game.State
+	err := s.db.WithTx(ctx, func(repos database.Repos) error {
+		var err error
+		match, state, err = s.lobby.Join(ctx, repos, matchUUID, user.UUID,
+			request.Faction)
+		return err
+	})
+	if err != nil {
+		writeGameError(w, r, err)
+		return
+	}
+	s.publish(r, matchUUID, state)
+
+	writeJSON(w, http.StatusOK, s.matchResponse(match, &state))
+}
+
+func (s *Server) handleLeaveMatch(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	matchUUID, ok := pathMatchUUID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	var state game.State
+	err := s.db.WithTx(ctx, func(repos database.Repos) error {
+		var err error
+		state, err = s.lobby.Leave(ctx, repos, matchUUID, user.UUID)
+		return err
+	})
+	if err != nil {
+		writeGameError(w, r, err)
+		return
+	}
+	s.publish(r, matchUUID, state)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleStartMatch(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	matchUUID, ok := pathMatchUUID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	var match models.Match
+	var state game.State
+	err := s.db.WithTx(ctx, func(repos database.Repos) error {
+		var err error
+		match, state, err = s.lobby.Start(ctx, repos, matchUUID, user.UUID)
+		return err
+	})
+	if err != nil {
+		writeGameError(w, r, err)
+		return
+	}
+	s.publish(r, matchUUID, state)
+
+	writeJSON(w, http.StatusOK, s.matchResponse(match, &state))
+}
+
+// handleCancelMatch deletes a lobby or finishes a match in game without a
+// winner
+func (s *Server) handleCancelMatch(
+	w http.ResponseWriter,
+	r *http.Request,
+	user models.User,
+) {
+	matchUUID, ok := pathMatchUUID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	var state game.State
+	var deleted bool
+	err := s.db.WithTx(ctx, func(repos database.Repos) error {
+		var err error
+		state, deleted, err = s.lobby.Cancel(ctx, repos, matchUUID,
+			user.UUID)
+		return err
+	})
+	if err != nil {
+		writeGameError(w, r, err)
+		return
+	}
+	if deleted {
+		s.send(r, pubsub.Message{
+			MatchUUID: matchUUID,
+			Seq:       state.Seq,
+			Deleted:   true,
+		})
+	} else {
+		s.publish(r, matchUUID, state)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publish announces the events of the match up to the seq of state once
+// their transaction committed
+func (s *Server) publish(r *http.Request, matchUUID string, state game.State) {
+	s.send(r, pubsub.Message{MatchUUID: matchUUID, Seq: state.Seq})
+}
+
+func (s *Server) send(r *http.Request, msg pubsub.Message) {
+	if s.pubsub == nil {
+		return
+	}
+
+	// the change is committed, subscribers catch up with the next message
+	if err := s.pubsub.Publish(r.Context(), msg); err != nil {
+		slog.Warn("failed to publish match events", "match", msg.MatchUUID,
+			"seq", msg.Seq, "deleted", msg.Deleted, "error", err)
+	}
+}
+
+// matchResponse fills in the factions when the state of the match is given
+func (s *Server) matchResponse(
+	match models.Match,
+	state *game.State,
+) MatchResponse {
+	response := MatchResponse{
+		UUID:          match.UUID,
+		State:         matchStateNames[match.MatchState],
+		CreatedByUser: match.CreatedByUser,
+		CreatedAt:     match.CreatedAt,
+		Version:       match.Version,
+		Seats:         []SeatResponse{},
+	}
+
+	for _, seat := range match.Seats {
+		seatResponse := SeatResponse{
+			UserUUID: seat.UserUUID,
+			JoinedAt: seat.JoinedAt,
+		}
+		if state != nil {
+			seatResponse.Faction = state.Factions[seat.UserUUID]
+		}
+		response.Seats = append(response.Seats, seatResponse)
+	}
+
+	if match.MatchState == models.WaitingPlayers {
+		maxPlayers := min(s.lobby.MaxPlayers, models.MAX_PLAYERS)
+		response.OpenSeats = max(maxPlayers-len(match.Seats), 0)
+	}
+
+	return response
+}
+
+// queryBool answers 400 itself when the parameter is set to anything but a
+// boolean, a missing one is false
+func queryBool(
+	w http.ResponseWriter,
+	r *http.Request,
+	name string,
+) (bool, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, true
+	}
+
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, name+" must be true or false")
+		return false, false
+	}
+
+	return on, true
+}
+
+func parseMatchState(name string) (models.MatchState, bool) {
+	for state, stateName := range matchStateNames {
+		if stateName == name {
+			return state, true
+		}
+	}
+
+	return 0, false
+}
+
+// pathMatchUUID answers 404 itself when the path doesn't hold a uuid, no
+// match could have it
+func pathMatchUUID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	matchUUID := r.PathValue("uuid")
+	if _, err := googleuuid.Parse(matchUUID); err != nil {
+		writeError(w, http.StatusNotFound, "match "+database.ErrNotFound.Error())
+		return "", false
+	}
+
+	return matchUUID, true
+}
+
+// writeGameError maps the rules broken in the lobby to status codes, other
+// errors are left to writeDatabaseError
+func writeGameError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, game.ErrNotCreator):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, game.ErrUnknownFaction):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, game.ErrIllegalAction),
+		errors.Is(err, game.ErrIllegalTransition):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, database.ErrConflict):
+		// another player acted on the match at the same time
+		writeError(w, http.StatusConflict,
+			"the match changed meanwhile, load it and try again")
+	default:
+		writeDatabaseError(w, r, err)
+	}
+}
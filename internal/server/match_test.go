@@ -0,0 +1,346 @@
+package server
+
+import (
+	"context"
+	"duna/internal/auth"
+	"duna/internal/config"
+	"duna/internal/database/memory"
+	"duna/internal/models"
+	"duna/internal/pubsub"
+	"duna/internal/version"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMatchServer serves every endpoint over a memory database seeded with
+// three factions, matches seat up to three players. The lobby publishes to
+// the returned pubsub
+func newMatchServer(t *testing.T) (*httptest.Server, pubsub.PubSub) {
+	t.Helper()
+
+	db := memory.NewMemoryDatabase()
+	if _, err := db.UpsertContent(context.Background(), models.GameContent{
+		Factions: []models.FactionDef{
+			{Key: "atreides", Name: "Atreides", Reserves: 20},
+			{Key: "harkonnen", Name: "Harkonnen", Reserves: 20},
+			{Key: "fremen", Name: "Fremen", Reserves: 20},
+		},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hub := pubsub.NewMemoryPubSub()
+	t.Cleanup(func() { hub.Close() })
+
+	server := httptest.NewServer(New(db, version.Info{}, Options{
+		Auth: auth.New(db, auth.DatabaseSessionStore(db, time.Hour),
+			testHash),
+		Hash: testHash,
+		Session: config.SessionConfig{
+			CookieName: "duna_session",
+			MaxAge:     time.Hour,
+		},
+		Game:   config.GameConfig{MinPlayers: 2, MaxPlayers: 3},
+		PubSub: hub,
+	}))
+	t.Cleanup(server.Close)
+
+	return server, hub
+}
+
+// newPlayer registers username and logs them in
+func newPlayer(t *testing.T, server *httptest.Server, username string) (
+	*client,
+	models.User,
+) {
+	t.Helper()
+
+	player := newClient(t, server)
+	var registered UserResponse
+	expectStatus(t, "register "+username, player.do(http.MethodPost,
+		"/auth/register", RegisterRequest{
+			Username: username,
+			Email:    username + "@arrakis.com",
+			Password: "Sp1ce-must-flow",
+		}, &registered), http.StatusCreated)
+	expectStatus(t, "login "+username,
+		player.login(username, "Sp1ce-must-flow"), http.StatusOK)
+
+	return player, registered.User
+}
+
+func TestMatchEndpoints(t *testing.T) {
+	server, _ := newMatchServer(t)
+	paul, paulUser := newPlayer(t, server, "paul")
+	feyd, _ := newPlayer(t, server, "feyd")
+	jessica, _ := newPlayer(t, server, "jessica")
+	leto, _ := newPlayer(t, server, "leto")
+
+	var match MatchResponse
+	expectStatus(t, "create", paul.do(http.MethodPost, "/matches",
+		CreateMatchRequest{Faction: "atreides"}, &match), http.StatusCreated)
+	if match.State != WAITING_PLAYERS_STATE ||
+		match.CreatedByUser != paulUser.UUID || len(match.Seats) != 1 ||
+		match.Seats[0].Faction != "atreides" || match.OpenSeats != 2 {
+		t.Fatalf("unexpected match %+v", match)
+	}
+	path := "/matches/" + match.UUID
+
+	steps := []struct {
+		name    string
+		player  *client
+		path    string
+		body    any
+		status  int
+		message string
+	}{
+		{"unknown faction", feyd, "/join", JoinMatchRequest{Faction: "guild"},
+			http.StatusBadRequest, "pick one of atreides, fremen, harkonnen"},
+		{"faction taken", feyd, "/join",
+			JoinMatchRequest{Faction: "atreides"}, http.StatusConflict,
+			"faction atreides already taken"},
+		{"start alone", paul, "/start", nil, http.StatusConflict,
+			"2 players needed to start, 1 joined"},
+		{"join", feyd, "/join", JoinMatchRequest{Faction: "harkonnen"},
+			http.StatusOK, ""},
+		{"join twice", feyd, "/join", JoinMatchRequest{Faction: "fremen"},
+			http.StatusConflict, "already in the match"},
+		{"join", jessica, "/join", JoinMatchRequest{Faction: "fremen"},
+			http.StatusOK, ""},
+		{"full", leto, "/join", JoinMatchRequest{Faction: "fremen"},
+			http.StatusConflict, "match is full"},
+		{"creator leaves", paul, "/leave", nil, http.StatusConflict,
+			"cancels the match instead"},
+		{"leave", jessica, "/leave", nil, http.StatusNoContent, ""},
+		{"leave twice", jessica, "/leave", nil, http.StatusConflict,
+			"not in the match"},
+		{"start by a player", feyd, "/start", nil, http.StatusForbidden,
+			"only the creator"},
+		{"cancel by a player", feyd, "/cancel", nil, http.StatusForbidden,
+			"only the creator"},
+		{"start", paul, "/start", nil, http.StatusOK, ""},
+		{"start twice", paul, "/start", nil, http.StatusConflict,
+			"illegal match state transition"},
+		{"join after start", leto, "/join",
+			JoinMatchRequest{Faction: "fremen"}, http.StatusConflict,
+			"match already started"},
+	}
+
+	for _, step := range steps {
+		var response ErrorResponse
+		var out any = &response
+		if step.status == http.StatusOK || step.status ==
+			http.StatusNoContent {
+			out = nil
+		}
+
+		status := step.player.do(http.MethodPost, path+step.path, step.body,
+			out)
+		expectStatus(t, step.name, status, step.status)
+		if !strings.Contains(response.Error, step.message) {
+			t.Errorf("%s: expected %q in %q", step.name, step.message,
+				response.Error)
+		}
+	}
+
+	expectStatus(t, "get", leto.do(http.MethodGet, path, nil, &match),
+		http.StatusOK)
+	factions := map[string]string{}
+	for _, seat := range match.Seats {
+		factions[seat.UserUUID] = seat.Faction
+	}
+	if match.State != IN_GAME_STATE || len(factions) != 2 ||
+		factions[paulUser.UUID] != "atreides" || match.OpenSeats != 0 {
+		t.Errorf("unexpected match %+v", match)
+	}
+
+	expectStatus(t, "cancel", paul.do(http.MethodPost, path+"/cancel", nil,
+		nil), http.StatusNoContent)
+	expectStatus(t, "get finished", paul.do(http.MethodGet, path, nil,
+		&match), http.StatusOK)
+	if match.State != FINISH_STATE {
+		t.Errorf("expected the match finished, got %s", match.State)
+	}
+
+	t.Run("cancel lobby", func(t *testing.T) {
+		var lobby MatchResponse
+		expectStatus(t, "create", leto.do(http.MethodPost, "/matches",
+			CreateMatchRequest{Faction: "fremen"}, &lobby), http.StatusCreated)
+		expectStatus(t, "cancel", leto.do(http.MethodPost,
+			"/matches/"+lobby.UUID+"/cancel", nil, nil), http.StatusNoContent)
+		expectStatus(t, "get", leto.do(http.MethodGet,
+			"/matches/"+lobby.UUID, nil, nil), http.StatusNotFound)
+	})
+
+	t.Run("not a match", func(t *testing.T) {
+		expectStatus(t, "malformed uuid", paul.do(http.MethodGet,
+			"/matches/arrakis", nil, nil), http.StatusNotFound)
+		expectStatus(t, "missing faction", paul.do(http.MethodPost,
+			"/matches", CreateMatchRequest{}, nil), http.StatusBadRequest)
+	})
+}
+
+func TestMatchEndpointsPublish(t *testing.T) {
+	server, hub := newMatchServer(t)
+	paul, _ := newPlayer(t, server, "paul")
+	feyd, _ := newPlayer(t, server, "feyd")
+	jessica, _ := newPlayer(t, server, "jessica")
+
+	var match MatchResponse
+	expectStatus(t, "create", paul.do(http.MethodPost, "/matches",
+		CreateMatchRequest{Faction: "atreides"}, &match), http.StatusCreated)
+	path := "/matches/" + match.UUID
+
+	// the join of the creator is seq 1
+	subscription, err := hub.Subscribe(context.Background(), match.UUID, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer subscription.Close()
+
+	steps := []struct {
+		name   string
+		player *client
+		path   string
+		body   any
+		status int
+	}{
+		{"join", feyd, "/join", JoinMatchRequest{Faction: "harkonnen"},
+			http.StatusOK},
+		{"join", jessica, "/join", JoinMatchRequest{Faction: "fremen"},
+			http.StatusOK},
+		{"leave", jessica, "/leave", nil, http.StatusNoContent},
+		{"start", paul, "/start", nil, http.StatusOK},
+		{"cancel", paul, "/cancel", nil, http.StatusNoContent},
+	}
+
+	for i, step := range steps {
+		expectStatus(t, step.name, step.player.do(http.MethodPost,
+			path+step.path, step.body, nil), step.status)
+
+		select {
+		case msg := <-subscription.Messages():
+			want := pubsub.Message{MatchUUID: match.UUID, Seq: int64(i + 2)}
+			if msg != want {
+				t.Errorf("%s: got %+v, want %+v", step.name, msg, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: nothing published", step.name)
+		}
+	}
+
+	expectStatus(t, "start a finished match", paul.do(http.MethodPost,
+		path+"/start", nil, nil), http.StatusConflict)
+	select {
+	case msg := <-subscription.Messages():
+		t.Errorf("unexpected message %+v after a rejected action", msg)
+	default:
+	}
+
+	t.Run("cancel lobby", func(t *testing.T) {
+		var lobby MatchResponse
+		expectStatus(t, "create", feyd.do(http.MethodPost, "/matches",
+			CreateMatchRequest{Faction: "harkonnen"}, &lobby),
+			http.StatusCreated)
+
+		subscription, err := hub.Subscribe(context.Background(), lobby.UUID,
+			1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer subscription.Close()
+
+		expectStatus(t, "cancel", feyd.do(http.MethodPost,
+			"/matches/"+lobby.UUID+"/cancel", nil, nil), http.StatusNoContent)
+
+		select {
+		case msg := <-subscription.Messages():
+			want := pubsub.Message{MatchUUID: lobby.UUID, Seq: 1,
+				Deleted: true}
+			if msg != want {
+				t.Errorf("got %+v, want %+v", msg, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the deletion was not published")
+		}
+	})
+}
+
+func TestListMatches(t *testing.T) {
+	server, _ := newMatchServer(t)
+	paul, _ := newPlayer(t, server, "paul")
+	feyd, _ := newPlayer(t, server, "feyd")
+
+	create := func(player *client, faction string) string {
+		t.Helper()
+
+		var match MatchResponse
+		expectStatus(t, "create", player.do(http.MethodPost, "/matches",
+			CreateMatchRequest{Faction: faction}, &match), http.StatusCreated)
+		return match.UUID
+	}
+
+	paulsLobby := create(paul, "atreides")
+	feydsLobby := create(feyd, "harkonnen")
+	started := create(feyd, "harkonnen")
+	expectStatus(t, "join", paul.do(http.MethodPost,
+		"/matches/"+started+"/join", JoinMatchRequest{Faction: "atreides"},
+		nil), http.StatusOK)
+	expectStatus(t, "start", feyd.do(http.MethodPost,
+		"/matches/"+started+"/start", nil, nil), http.StatusOK)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{started, feydsLobby, paulsLobby}},
+		{"?open=true", []string{feydsLobby, paulsLobby}},
+		{"?state=in_game", []string{started}},
+		{"?mine=true", []string{started, paulsLobby}},
+		{"?open=true&mine=true", []string{paulsLobby}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var response MatchesResponse
+			expectStatus(t, "list", paul.do(http.MethodGet,
+				"/matches"+tt.query, nil, &response), http.StatusOK)
+
+			var got []string
+			for _, match := range response.Matches {
+				got = append(got, match.UUID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		var first, second MatchesResponse
+		expectStatus(t, "first page", paul.do(http.MethodGet,
+			"/matches?limit=2", nil, &first), http.StatusOK)
+		if len(first.Matches) != 2 || first.NextCursor == "" {
+			t.Fatalf("unexpected first page %+v", first)
+		}
+
+		expectStatus(t, "second page", paul.do(http.MethodGet,
+			"/matches?limit=2&cursor="+first.NextCursor, nil, &second),
+			http.StatusOK)
+		if len(second.Matches) != 1 || second.NextCursor != "" ||
+			second.Matches[0].UUID != paulsLobby {
+			t.Errorf("unexpected second page %+v", second)
+		}
+	})
+
+	t.Run("bad queries", func(t *testing.T) {
+		for _, query := range []string{"?state=playing", "?open=maybe",
+			"?limit=0", "?cursor=%25%25"} {
+			expectStatus(t, query, paul.do(http.MethodGet, "/matches"+query,
+				nil, nil), http.StatusBadRequest)
+		}
+	})
+}
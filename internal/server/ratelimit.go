@@ -0,0 +1,117 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// limits of each endpoint checking passwords, per client address
+const (
+	AUTH_RATE_LIMIT = 10
+	AUTH_RATE_BURST = 10
+	AUTH_RATE_EVERY = time.Minute
+	// MAX_RATE_BUCKETS bounds the memory of a limiter, full buckets are
+	// dropped past it
+	MAX_RATE_BUCKETS = 10000
+)
+
+// rateLimiter is a token bucket per key, it lives in the process so every
+// server instance counts on its own
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// rate is the tokens refilled per second
+	rate  float64
+	burst float64
+	now   func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newRateLimiter allows limit requests every period after a burst
+func newRateLimiter(
+	limit int,
+	period time.Duration,
+	burst int,
+	now func() time.Time,
+) *rateLimiter {
+	return &rateLimiter{
+		buckets: make(map[string]*bucket),
+		rate:    float64(limit) / period.Seconds(),
+		burst:   float64(burst),
+		now:     now,
+	}
+}
+
+// allow takes a token from the bucket of key, when it is empty it returns
+// how long until the next token
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= MAX_RATE_BUCKETS {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst,
+		b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// prune drops the buckets refilled by now, they behave like new ones
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limit answers 429 once the client address ran out of tokens, every
+// endpoint has its own budget
+func (l *rateLimiter) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.allow(r.Pattern + " " + clientAddress(r))
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, http.StatusTooManyRequests,
+				"too many requests, retry in "+strconv.Itoa(seconds)+"s")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// clientAddress is the host of the peer, headers set by proxies are not
+// trusted since any client can send them
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,129 @@
+// Package server exposes the application over HTTP, every response body is
+// JSON
+package server
+
+import (
+	"duna/internal/auth"
+	"duna/internal/config"
+	"duna/internal/database"
+	"duna/internal/game"
+	"duna/internal/hash"
+	"duna/internal/models"
+	"duna/internal/pubsub"
+	"duna/internal/uuid"
+	"duna/internal/version"
+	"net/http"
+	"time"
+)
+
+type Server struct {
+	db      database.Database
+	info    version.Info
+	auth    auth.SessionAuthenticator
+	hash    hash.HashStrategy
+	uuids   models.UUIDStrategy
+	session config.SessionConfig
+	// usernames and emails validate registrations
+	usernames models.UsernamePolicy
+	emails    models.EmailPolicy
+	lobby     game.Lobby
+	pubsub    pubsub.PubSub
+	now       func() time.Time
+	// authLimiter guards the endpoints checking passwords
+	authLimiter *rateLimiter
+	mux         *http.ServeMux
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// Options holds the dependencies of the endpoints beyond the database, the
+// zero value serves /version only
+type Options struct {
+	Auth    auth.SessionAuthenticator
+	Hash    hash.HashStrategy
+	Session config.SessionConfig
+	// Game bounds the players of the matches
+	Game config.GameConfig
+	// PubSub is told about the events the lobby appends, nothing is
+	// published when nil
+	PubSub pubsub.PubSub
+	// Usernames and Emails validate registrations, models.DefaultUsernamePolicy
+	// and models.DefaultEmailPolicy when nil
+	Usernames *models.UsernamePolicy
+	Emails    *models.EmailPolicy
+	// UUIDs names new users and matches, uuid.V7Strategy when nil
+	UUIDs models.UUIDStrategy
+	// Now is time.Now when nil, tests move it to refill the rate limits
+	Now func() time.Time
+}
+
+func New(db database.Database, info version.Info, opts Options) *Server {
+	if opts.UUIDs == nil {
+		opts.UUIDs = uuid.V7Strategy{}
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.Usernames == nil {
+		opts.Usernames = &models.DefaultUsernamePolicy
+	}
+	if opts.Emails == nil {
+		opts.Emails = &models.DefaultEmailPolicy
+	}
+
+	s := &Server{
+		db:        db,
+		info:      info,
+		auth:      opts.Auth,
+		hash:      opts.Hash,
+		uuids:     opts.UUIDs,
+		session:   opts.Session,
+		usernames: *opts.Usernames,
+		emails:    *opts.Emails,
+		lobby: game.Lobby{
+			MinPlayers: opts.Game.MinPlayers,
+			MaxPlayers: opts.Game.MaxPlayers,
+		},
+		pubsub: opts.PubSub,
+		now:    opts.Now,
+		authLimiter: newRateLimiter(AUTH_RATE_LIMIT, AUTH_RATE_EVERY,
+			AUTH_RATE_BURST, opts.Now),
+		mux: http.NewServeMux(),
+	}
+	s.routes()
+
+	return s
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET /version", s.handleVersion)
+
+	if s.auth == nil {
+		return
+	}
+
+	s.mux.HandleFunc("POST /auth/register",
+		s.authLimiter.limit(s.handleRegister))
+	s.mux.HandleFunc("POST /auth/login", s.authLimiter.limit(s.handleLogin))
+	s.mux.HandleFunc("POST /auth/logout", s.requireUser(s.handleLogout))
+	s.mux.HandleFunc("GET /me", s.requireUser(s.handleMe))
+	s.mux.HandleFunc("PUT /me/password",
+		s.authLimiter.limit(s.requireUser(s.handleChangePassword)))
+	s.mux.HandleFunc("GET /me/sessions", s.requireUser(s.handleSessions))
+
+	s.mux.HandleFunc("GET /matches", s.requireUser(s.handleListMatches))
+	s.mux.HandleFunc("POST /matches", s.requireUser(s.handleCreateMatch))
+	s.mux.HandleFunc("GET /matches/{uuid}", s.requireUser(s.handleGetMatch))
+	s.mux.HandleFunc("POST /matches/{uuid}/join",
+		s.requireUser(s.handleJoinMatch))
+	s.mux.HandleFunc("POST /matches/{uuid}/leave",
+		s.requireUser(s.handleLeaveMatch))
+	s.mux.HandleFunc("POST /matches/{uuid}/start",
+		s.requireUser(s.handleStartMatch))
+	s.mux.HandleFunc("POST /matches/{uuid}/cancel",
+		s.requireUser(s.handleCancelMatch))
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"duna/internal/database"
+	"duna/internal/version"
+	"net/http"
+)
+
+type VersionResponse struct {
+	version.Info
+	// AppliedSchemaVersion is the latest migration run on the database, it
+	// is left out when the database has no migrations or can't be reached
+	AppliedSchemaVersion int64 `json:"applied_schema_version,omitempty"`
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	response := VersionResponse{Info: s.info}
+
+	if versioner, ok := s.db.(database.SchemaVersioner); ok {
+		// the build values are still worth answering with
+		if applied, err := versioner.SchemaVersion(r.Context()); err == nil {
+			response.AppliedSchemaVersion = applied
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
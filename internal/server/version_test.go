@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"duna/internal/database"
+	"duna/internal/version"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// versionedDatabase adds a schema version to the mock
+type versionedDatabase struct {
+	database.MockDatabase
+	version int64
+	err     error
+}
+
+func (d *versionedDatabase) SchemaVersion(ctx context.Context) (int64, error) {
+	return d.version, d.err
+}
+
+func TestVersion(t *testing.T) {
+	info := version.New("0.1.0", "2025-07-21T10:00:00+0000", "abc1234", 42)
+
+	tests := []struct {
+		name string
+		db   database.Database
+		want int64
+	}{
+		{"applied version", &versionedDatabase{version: 41}, 41},
+		{"unreachable database", &versionedDatabase{
+			err: database.ErrUnavailable}, 0},
+		{"no migrations", &database.MockDatabase{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			New(tt.db, info, Options{}).ServeHTTP(recorder,
+				httptest.NewRequest(http.MethodGet, "/version", nil))
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+			}
+
+			var got VersionResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&got); err != nil {
+				t.Fatalf("unexpected error decoding: %v", err)
+			}
+			if got.Info != info {
+				t.Errorf("Info = %+v, want %+v", got.Info, info)
+			}
+			if got.AppliedSchemaVersion != tt.want {
+				t.Errorf("AppliedSchemaVersion = %d, want %d",
+					got.AppliedSchemaVersion, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionRejectsOtherMethods(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	New(&database.MockDatabase{}, version.Info{}, Options{}).ServeHTTP(recorder,
+		httptest.NewRequest(http.MethodPost, "/version", nil))
+
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", recorder.Code,
+			http.StatusMethodNotAllowed)
+	}
+}
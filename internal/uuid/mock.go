@@ -0,0 +1,21 @@
+package uuid
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FakeStrategy returns predictable UUIDs for tests: the first call returns
+// 00000000-0000-4000-8000-000000000001, the second ...0002 and so on
+type FakeStrategy struct {
+	mu      sync.Mutex
+	counter uint64
+}
+
+func (f *FakeStrategy) New() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.counter++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", f.counter)
+}
@@ -0,0 +1,21 @@
+package uuid
+
+import (
+	guuid "github.com/google/uuid"
+)
+
+// V4Strategy generates random (version 4) UUIDs
+type V4Strategy struct{}
+
+func (V4Strategy) New() string {
+	return guuid.NewString()
+}
+
+// V7Strategy generates time-ordered (version 7) UUIDs. Consecutive values
+// sort by creation time, which keeps btree indexes on the matches and
+// event tables append-mostly instead of scattering inserts across pages.
+type V7Strategy struct{}
+
+func (V7Strategy) New() string {
+	return guuid.Must(guuid.NewV7()).String()
+}
@@ -0,0 +1,61 @@
+package uuid
+
+import (
+	"testing"
+
+	guuid "github.com/google/uuid"
+)
+
+func TestV4Strategy(t *testing.T) {
+	id, err := guuid.Parse(V4Strategy{}.New())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if id.Version() != 4 {
+		t.Errorf("expected version 4, got %d", id.Version())
+	}
+}
+
+func TestV7Strategy(t *testing.T) {
+	strategy := V7Strategy{}
+
+	previous := strategy.New()
+	for i := 0; i < 100; i++ {
+		current := strategy.New()
+
+		id, err := guuid.Parse(current)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if id.Version() != 7 {
+			t.Errorf("expected version 7, got %d", id.Version())
+		}
+
+		if current <= previous {
+			t.Errorf("expected %s to sort after %s", current, previous)
+		}
+		previous = current
+	}
+}
+
+func TestFakeStrategy(t *testing.T) {
+	strategy := &FakeStrategy{}
+
+	expected := []string{
+		"00000000-0000-4000-8000-000000000001",
+		"00000000-0000-4000-8000-000000000002",
+		"00000000-0000-4000-8000-000000000003",
+	}
+
+	for _, want := range expected {
+		got := strategy.New()
+		if got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+
+		if _, err := guuid.Parse(got); err != nil {
+			t.Errorf("expected a valid UUID, got %s: %v", got, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Package version describes the running binary. cmd/main.go fills it from
+// the variables the makefile sets with -ldflags
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// placeholders of the values a plain go build leaves unset
+const (
+	DEV_VERSION = "dev"
+	UNKNOWN     = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	BuildTime string `json:"build_time"`
+	GitCommit string `json:"git_commit"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	// SchemaVersion is the latest migration embedded in the binary, the
+	// database may be behind until migrated
+	SchemaVersion int64 `json:"schema_version"`
+}
+
+// New fills the values missing with what the go toolchain recorded, the
+// commit is known when building from a git checkout
+func New(version, buildTime, gitCommit string, schemaVersion int64) Info {
+	info := Info{
+		Version:       version,
+		BuildTime:     buildTime,
+		GitCommit:     gitCommit,
+		GoVersion:     runtime.Version(),
+		Platform:      runtime.GOOS + "/" + runtime.GOARCH,
+		SchemaVersion: schemaVersion,
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.GitCommit == "":
+				info.GitCommit = setting.Value[:min(7, len(setting.Value))]
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = DEV_VERSION
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = UNKNOWN
+	}
+	if info.GitCommit == "" {
+		info.GitCommit = UNKNOWN
+	}
+
+	return info
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("duna %s (commit %s, built %s)\n%s %s\nschema %d\n",
+		i.Version, i.GitCommit, i.BuildTime, i.GoVersion, i.Platform,
+		i.SchemaVersion)
+}
@@ -0,0 +1,34 @@
+package version
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("ldflags win", func(t *testing.T) {
+		info := New("0.1.0", "2025-07-21T10:00:00+0000", "abc1234", 42)
+
+		if info.Version != "0.1.0" || info.GitCommit != "abc1234" ||
+			info.BuildTime != "2025-07-21T10:00:00+0000" {
+			t.Errorf("unexpected build values %+v", info)
+		}
+		if info.GoVersion != runtime.Version() {
+			t.Errorf("GoVersion = %s, want %s", info.GoVersion, runtime.Version())
+		}
+		if !strings.Contains(info.String(), "schema 42") {
+			t.Errorf("expected the schema version in %q", info)
+		}
+	})
+
+	t.Run("placeholders", func(t *testing.T) {
+		info := New("", "", "", 0)
+
+		// tests are built without vcs stamping
+		if info.Version != DEV_VERSION || info.GitCommit != UNKNOWN ||
+			info.BuildTime != UNKNOWN {
+			t.Errorf("unexpected placeholders %+v", info)
+		}
+	})
+}